@@ -2,25 +2,37 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag" // Import flag
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"reflect"
+	"slices"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/mohammedhabas11/admin-bot/pkg/cachearchive"
 	"github.com/mohammedhabas11/admin-bot/pkg/cachecleaner"
 	"github.com/mohammedhabas11/admin-bot/pkg/config"
 	"github.com/mohammedhabas11/admin-bot/pkg/httpserver"
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+	"github.com/mohammedhabas11/admin-bot/pkg/metrics"
+	"github.com/mohammedhabas11/admin-bot/pkg/reloadhook"
 )
 
 // --- Command Line Flags ---
 var (
 	validatePath = flag.String("validate", "", "Path to config file to validate only.")
 	configPath   = flag.String("config", "", "Path to config file (overrides ENV var).") // Optional explicit path flag
+	cacheExport  = flag.String("cache-export", "", "Export the configured proxy cache to a .tar.gz file and exit.")
+	cacheImport  = flag.String("cache-import", "", "Import a .tar.gz cache archive into the configured proxy cache and exit.")
+	initPath     = flag.String("init", "", "Write a commented starter config file to the given path and exit.")
+	initConfig   = flag.String("init-config", "", "Deprecated alias of -init.")
+	forceInit    = flag.Bool("force", false, "Let -init overwrite an existing file.")
 )
 
 // --- Environment Variable ---
@@ -38,13 +50,30 @@ var (
 func main() {
 	flag.Parse() // Parse command line flags first
 
+	// --- Handle Config Bootstrap Command ---
+	if *initConfig != "" {
+		if *initPath != "" {
+			fmt.Fprintln(os.Stderr, "-init-config is an alias of -init, give only one of them")
+			os.Exit(2)
+		}
+		*initPath = *initConfig
+	}
+	if *initPath != "" {
+		if err := config.WriteSampleConfig(*initPath, *forceInit); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write starter config: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Starter configuration written to %s\n", *initPath)
+		os.Exit(0)
+	}
+
 	// --- Handle Validation Command ---
 	if *validatePath != "" {
 		fmt.Printf("Validating configuration file: %s\n", *validatePath)
 		// Use the dedicated validation function from the config package
 		err := config.ValidateConfigFile(*validatePath)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Validation Failed: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Validation Failed (%s): %v\n", describeConfigError(err), err)
 			os.Exit(1) // Exit with error code
 		}
 		fmt.Println("Configuration file is valid.")
@@ -55,57 +84,112 @@ func main() {
 	finalConfigPath := "config.yaml" // Default path
 	if *configPath != "" {
 		finalConfigPath = *configPath // Use -config flag if provided
-		log.Printf("Using config path from -config flag: %s", finalConfigPath)
+		logging.Infof("Using config path from -config flag: %s", finalConfigPath)
 	} else {
 		envPath := os.Getenv(ConfigPathEnvVar)
 		if envPath != "" {
 			finalConfigPath = envPath // Use ENV var if provided and -config wasn't
-			log.Printf("Using config path from %s environment variable: %s", ConfigPathEnvVar, finalConfigPath)
+			logging.Infof("Using config path from %s environment variable: %s", ConfigPathEnvVar, finalConfigPath)
 		} else {
-			log.Printf("Using default config path: %s", finalConfigPath)
+			logging.Infof("Using default config path: %s", finalConfigPath)
 		}
 	}
 
+	// --- Handle Cache Archive Commands ---
+	if *cacheExport != "" || *cacheImport != "" {
+		os.Exit(runCacheArchiveCommand(finalConfigPath))
+	}
+
 	// --- Initial Setup ---
-	log.Println("Starting admin-bot...")
+	logging.Infof("Starting admin-bot...")
 
 	// Channel for signaling config reloads
 	reloadChan := make(chan bool, 1)
 
 	// Load initial configuration and start watching
 	// LoadConfig now FATALS on unrecoverable initial load errors (except file not found with defaults)
+	config.OnReloadFailure(func(err error) {
+		appStateMutex.Lock()
+		defer appStateMutex.Unlock()
+		if activeConfig != nil { // The rejected file's hook isn't trusted, use the running one
+			reloadhook.Notify(activeConfig.ReloadWebhook, reloadhook.Event{Error: err.Error()})
+		}
+	})
 	initialCfg, err := config.LoadConfig(finalConfigPath, reloadChan)
 	if err != nil {
 		log.Fatalf("FATAL: Failed to load initial configuration from %s: %v", finalConfigPath, err)
 	}
 	activeConfig = initialCfg // Set the initial active config
+	logging.SetLevel(activeConfig.Log.Level)
 
 	// Start initial services based on the first loaded config
-	startServices(activeConfig)
+	if err := startServices(activeConfig); errors.Is(err, httpserver.ErrNoListeners) {
+		// Nothing to serve, don't idle: let the supervisor see the failure
+		log.Fatalf("FATAL: %v", err)
+	}
+
+	if fp := activeConfig.HTTP.ForwardProxy; activeConfig.HTTP.Enabled && fp.Enabled && fp.SelfTest.Enabled {
+		if err := runSelfTest(activeConfig); err != nil {
+			if activeConfig.Strict {
+				log.Fatalf("FATAL: Proxy self-test failed (strict mode): %v", err)
+			}
+			logging.Errorf("Proxy self-test failed: %v", err)
+		}
+	}
 
 	// --- Graceful Shutdown / Reload Handling ---
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
-	log.Println("Application started. Press Ctrl+C to shut down.")
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	logging.Infof("Application started. Press Ctrl+C to shut down.")
 
 	// Main loop to wait for signals or reload triggers
 	keepRunning := true
 	for keepRunning {
 		select {
 		case sig := <-signalChan:
-			log.Printf("Shutdown signal received: %v. Starting graceful shutdown...", sig)
+			logging.Infof("Shutdown signal received: %v. Starting graceful shutdown...", sig)
 			keepRunning = false      // Exit loop after handling shutdown
 			stopServices(true, true) // Stop all services on shutdown
 
+		case <-hupChan:
+			// Re-read the file ourselves, fsnotify misses some updates (symlink swaps, NFS).
+			// A valid config arrives on reloadChan just like a watcher reload.
+			logging.Infof("SIGHUP received, reloading %s...", finalConfigPath)
+			config.Reload()
+
 		case <-reloadChan:
-			log.Println("Reload signal received. Checking for necessary restarts...")
+			logging.Infof("Reload signal received. Checking for necessary restarts...")
 			newCfg := config.GetConfig() // Get the newly loaded config
+			logging.SetLevel(newCfg.Log.Level)
 
 			// --- Compare configurations ---
-			restartServer, restartCleaner := compareConfigs(activeConfig, newCfg)
+			restartServer, reloadServer, restartCleaner := compareConfigs(activeConfig, newCfg)
+
+			if reloadServer && !restartServer {
+				// Handler-only changes (cache, static dirs, ...) are applied on the live listener
+				appStateMutex.Lock()
+				if currentHttpServer != nil {
+					currentHttpServer.Reload(newCfg)
+				}
+				appStateMutex.Unlock()
+			}
+
+			var restarted []string // For the reload webhook
+			if reloadServer && !restartServer {
+				restarted = append(restarted, "http-handlers")
+			}
+			if restartServer {
+				restarted = append(restarted, "http-server")
+			}
+			if restartCleaner {
+				restarted = append(restarted, "cache-cleaner")
+			}
 
 			if !restartServer && !restartCleaner {
-				log.Println("No configuration changes requiring service restart detected.")
+				logging.Infof("No configuration changes requiring service restart detected.")
+				reloadhook.Notify(newCfg.ReloadWebhook, reloadhook.Event{Success: true, Restarted: restarted})
 				// Update activeConfig even if no restart, so next comparison is correct
 				appStateMutex.Lock()
 				activeConfig = newCfg
@@ -113,7 +197,11 @@ func main() {
 				continue // Go back to waiting for signals
 			}
 
-			log.Println("Configuration changes detected, restarting relevant services...")
+			logging.Infof("Configuration changes detected, restarting relevant services...")
+			if restartServer && newCfg.HTTP.Enabled && activeConfig.HTTP.Enabled && newCfg.HTTP.BindThenSwap &&
+				listenersDisjoint(activeConfig.HTTP, newCfg.HTTP) && swapHttpServer(newCfg) {
+				restartServer = false // Already running on the new listeners
+			}
 			stopServices(restartServer, restartCleaner) // Stop only affected services
 
 			// Update active config *before* starting with it
@@ -122,122 +210,295 @@ func main() {
 			appStateMutex.Unlock()
 
 			startServices(activeConfig) // Start services (will only start those stopped)
-			log.Println("Relevant services restarted with new configuration.")
+			logging.Infof("Relevant services restarted with new configuration.")
+			reloadhook.Notify(newCfg.ReloadWebhook, reloadhook.Event{Success: true, Restarted: restarted})
 		}
 	}
 
 	// --- Wait for Services to Finish on Shutdown ---
-	log.Println("Waiting for background tasks (HTTP server) to complete...")
+	logging.Infof("Waiting for background tasks (HTTP server) to complete...")
 	serverWg.Wait() // Wait for HTTP server goroutine to finish its shutdown
 
-	log.Println("Application exiting.")
+	logging.Infof("Application exiting.")
+}
+
+// describeConfigError names the kind of a config loading error for CLI output.
+func describeConfigError(err error) string {
+	switch {
+	case errors.Is(err, config.ErrNotFound):
+		return "file not found"
+	case errors.Is(err, config.ErrParse):
+		return "parse error"
+	case errors.Is(err, config.ErrValidation):
+		return "invalid configuration"
+	default:
+		return "unexpected error"
+	}
+}
+
+// runCacheArchiveCommand handles the -cache-export / -cache-import flags
+// against the cache dir from the config file. Returns the process exit code.
+func runCacheArchiveCommand(cfgPath string) int {
+	cfg, err := config.ReadConfigFile(cfgPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cache archive failed: %v\n", err)
+		return 1
+	}
+	cacheDirs := cfg.HTTP.ForwardProxy.Cache.GetCacheDirs()
+	if len(cacheDirs) == 0 {
+		fmt.Fprintln(os.Stderr, "Cache archive failed: http.forward-proxy.cache.cache-dir is not set.")
+		return 1
+	}
+
+	if *cacheExport != "" {
+		count, err := cachearchive.Export(cacheDirs, *cacheExport)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cache export failed after %d files: %v\n", count, err)
+			return 1
+		}
+		fmt.Printf("Exported %d cache files from %s to %s\n", count, strings.Join(cacheDirs, ","), *cacheExport)
+	}
+	if *cacheImport != "" {
+		count, err := cachearchive.Import(*cacheImport, cacheDirs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cache import failed after %d files: %v\n", count, err)
+			return 1
+		}
+		fmt.Printf("Imported %d cache files from %s into %s\n", count, *cacheImport, strings.Join(cacheDirs, ","))
+	}
+	return 0
 }
 
 // compareConfigs checks if restarts are needed based on config differences.
-func compareConfigs(oldCfg, newCfg *config.Config) (restartServer bool, restartCleaner bool) {
+// reloadServer means only the handlers changed and can be rebuilt in place.
+func compareConfigs(oldCfg, newCfg *config.Config) (restartServer bool, reloadServer bool, restartCleaner bool) {
 	if oldCfg == nil || newCfg == nil {
-		log.Println("WARN: Comparing nil configurations, forcing restart.")
-		return true, true // Force restart if something went wrong
+		logging.Warnf("Comparing nil configurations, forcing restart.")
+		return true, false, true // Force restart if something went wrong
 	}
 
 	// 1. Check for HTTP Server restart conditions
-	// Use DeepEqual for simplicity and robustness across all HTTP settings
-	if !reflect.DeepEqual(oldCfg.HTTP, newCfg.HTTP) {
-		log.Println("Change detected in HTTP configuration requiring server restart.")
+	// Listener settings need a full restart; anything else only rebuilds the handlers
+	// (e.g. toggling cache.enabled recreates the proxy handler with a cache)
+	if listenerConfigChanged(oldCfg.HTTP, newCfg.HTTP) {
+		logging.Infof("Change detected in HTTP listener configuration requiring server restart.")
 		restartServer = true
+	} else if !reflect.DeepEqual(oldCfg.HTTP, newCfg.HTTP) || oldCfg.ProxyCacheCleanup.TTL != newCfg.ProxyCacheCleanup.TTL {
+		logging.Infof("Change detected in HTTP handler configuration, handlers will be rebuilt.")
+		reloadServer = true
 	}
 
 	// 2. Check for Cache Cleaner restart conditions
 	// Cleaner depends on interval and the proxy cache settings
-	oldProxyCacheEnabled := oldCfg.HTTP.ForwardProxy.Enabled && oldCfg.HTTP.ForwardProxy.Cache.Enabled && oldCfg.HTTP.ForwardProxy.Cache.CacheDir != ""
-	newProxyCacheEnabled := newCfg.HTTP.ForwardProxy.Enabled && newCfg.HTTP.ForwardProxy.Cache.Enabled && newCfg.HTTP.ForwardProxy.Cache.CacheDir != ""
+	oldProxyCacheEnabled := oldCfg.HTTP.ForwardProxy.Enabled && oldCfg.HTTP.ForwardProxy.Cache.Enabled && len(oldCfg.HTTP.ForwardProxy.Cache.GetCacheDirs()) > 0
+	newProxyCacheEnabled := newCfg.HTTP.ForwardProxy.Enabled && newCfg.HTTP.ForwardProxy.Cache.Enabled && len(newCfg.HTTP.ForwardProxy.Cache.GetCacheDirs()) > 0
 
 	// Compare relevant fields only if the cleaner *should* be running in the new config
 	if newProxyCacheEnabled {
 		// Restart if cleaner wasn't running before OR if its settings changed
 		if !oldProxyCacheEnabled ||
-			oldCfg.ProxyCacheCleanup.Interval != newCfg.ProxyCacheCleanup.Interval ||
-			oldCfg.HTTP.ForwardProxy.Cache.CacheDir != newCfg.HTTP.ForwardProxy.Cache.CacheDir ||
+			oldCfg.ProxyCacheCleanup != newCfg.ProxyCacheCleanup ||
+			!slices.Equal(oldCfg.HTTP.ForwardProxy.Cache.GetCacheDirs(), newCfg.HTTP.ForwardProxy.Cache.GetCacheDirs()) ||
 			oldCfg.HTTP.ForwardProxy.Cache.CacheTTL != newCfg.HTTP.ForwardProxy.Cache.CacheTTL {
-			log.Println("Change detected in Cache Cleaner or relevant Proxy Cache configuration requiring cleaner restart.")
+			logging.Infof("Change detected in Cache Cleaner or relevant Proxy Cache configuration requiring cleaner restart.")
 			restartCleaner = true
 		}
 	} else {
 		// If cleaner should NOT be running in new config, check if it WAS running before
 		if oldProxyCacheEnabled {
-			log.Println("Cache Cleaner disabled in new configuration, requires stopping.")
+			logging.Infof("Cache Cleaner disabled in new configuration, requires stopping.")
 			restartCleaner = true // Signal stop needed
 		}
 	}
 
-	return restartServer, restartCleaner
+	return restartServer, reloadServer, restartCleaner
+}
+
+// listenerConfigChanged reports whether HTTP settings that affect the listener
+// itself (and so can't be applied to a running server) differ.
+func listenerConfigChanged(oldHTTP, newHTTP config.HTTPConfig) bool {
+	// Streaming content types are applied by the proxy handler on reload
+	oldTimeouts, newTimeouts := oldHTTP.Timeouts, newHTTP.Timeouts
+	oldTimeouts.StreamingContentTypes, newTimeouts.StreamingContentTypes = nil, nil
+	return oldHTTP.Enabled != newHTTP.Enabled ||
+		oldHTTP.Addr != newHTTP.Addr ||
+		oldHTTP.Port != newHTTP.Port ||
+		!reflect.DeepEqual(oldHTTP.Listeners, newHTTP.Listeners) ||
+		!reflect.DeepEqual(oldTimeouts, newTimeouts) ||
+		oldHTTP.ProxyProtocol != newHTTP.ProxyProtocol ||
+		oldHTTP.TLS != newHTTP.TLS
 }
 
 // startServices starts services based on config, only if they aren't already running.
-func startServices(cfg *config.Config) {
+// It returns the error of an HTTP server that was started but isn't listening.
+func startServices(cfg *config.Config) error {
 	appStateMutex.Lock()
 	defer appStateMutex.Unlock()
 
-	log.Println("Attempting to start necessary services...")
+	logging.Infof("Attempting to start necessary services...")
+	var httpErr error
 
 	// --- Start HTTP Server ---
 	if cfg.HTTP.Enabled {
 		if currentHttpServer == nil { // Only start if not already running
-			currentHttpServer = httpserver.NewServer(cfg)
-			serverWg.Add(1)
-			go func(server *httpserver.Server) {
-				defer serverWg.Done()
-				log.Println("Starting HTTP server goroutine...")
-				// Use a background context - shutdown is handled by stopServices
-				if err := server.Start(context.Background()); err != nil {
-					log.Printf("HTTP server error: %v", err)
-				}
-				log.Println("HTTP server goroutine finished.")
-			}(currentHttpServer)
+			var err error
+			currentHttpServer, err = launchHttpServer(cfg)
+			if err != nil {
+				logging.Errorf("HTTP server did not start listening: %v", err)
+				httpErr = err
+			} else {
+				logging.Infof("HTTP server is accepting connections.")
+			}
 		} else {
-			log.Println("HTTP server already running.")
+			logging.Infof("HTTP server already running.")
 		}
 	} else {
-		log.Println("HTTP server is disabled by configuration.")
+		logging.Infof("HTTP server is disabled by configuration.")
 		// Ensure server is stopped if it was running and is now disabled
 		if currentHttpServer != nil {
-			log.Println("Stopping HTTP server as it's now disabled...")
+			logging.Infof("Stopping HTTP server as it's now disabled...")
 			if err := currentHttpServer.Stop(); err != nil {
-				log.Printf("Error stopping disabled HTTP server: %v", err)
+				logging.Errorf("Failed to stop disabled HTTP server: %v", err)
 			}
 			currentHttpServer = nil
 		}
 	}
 
 	// --- Start Cache Cleaner ---
-	shouldRunCleaner := cfg.HTTP.ForwardProxy.Enabled && cfg.HTTP.ForwardProxy.Cache.Enabled && cfg.HTTP.ForwardProxy.Cache.CacheDir != ""
+	shouldRunCleaner := cfg.HTTP.ForwardProxy.Enabled && cfg.HTTP.ForwardProxy.Cache.Enabled && len(cfg.HTTP.ForwardProxy.Cache.GetCacheDirs()) > 0
 	if shouldRunCleaner {
 		if currentCleanerStop == nil { // Only start if not already running
 			cleanerInterval, err := cfg.ProxyCacheCleanup.GetInterval()
 			if err != nil {
-				log.Printf("WARNING: Invalid cache cleanup interval, using default: %v", err)
+				logging.Warnf("Invalid cache cleanup interval, using default: %v", err)
 				cleanerInterval = time.Hour
 			}
-			cacheDir := cfg.HTTP.ForwardProxy.Cache.CacheDir
+			cacheDirs := cfg.HTTP.ForwardProxy.Cache.GetCacheDirs()
 			cacheTTL, err := cfg.HTTP.ForwardProxy.Cache.GetCacheTTL()
 			if err != nil {
-				log.Printf("WARNING: Invalid cache TTL, using default for cleanup: %v", err)
+				logging.Warnf("Invalid cache TTL, using default for cleanup: %v", err)
 				cacheTTL, _ = config.StrToDuration("7d")
 			}
-			currentCleanerStop = cachecleaner.StartCleaner(context.Background(), cleanerInterval, cacheDir, cacheTTL)
+			keepStale, err := cfg.GetStaleRetention()
+			if err != nil {
+				logging.Warnf("Invalid cleanup TTL, deleting entries at cache TTL: %v", err)
+			}
+			maxSize, err := cfg.ProxyCacheCleanup.GetMaxSize()
+			if err != nil {
+				logging.Warnf("Invalid cleanup max-size, not capping the cache size: %v", err)
+			}
+			currentCleanerStop = cachecleaner.StartCleaner(context.Background(), cachecleaner.Options{
+				Interval:   cleanerInterval,
+				Dirs:       cacheDirs,
+				CacheTTL:   cacheTTL,
+				KeepStale:  keepStale,
+				MaxSize:    maxSize,
+				RunOnStart: cfg.ProxyCacheCleanup.RunOnStart,
+				OnRun:      recordCleanup,
+			})
 		} else {
-			log.Println("Cache cleaner already running.")
+			logging.Infof("Cache cleaner already running.")
 		}
 	} else {
-		log.Println("Proxy cache cleaning is disabled by configuration.")
+		logging.Infof("Proxy cache cleaning is disabled by configuration.")
 		// Ensure cleaner is stopped if it was running and is now disabled
 		if currentCleanerStop != nil {
-			log.Println("Stopping cache cleaner as it's now disabled...")
+			logging.Infof("Stopping cache cleaner as it's now disabled...")
 			currentCleanerStop()
 			currentCleanerStop = nil
 		}
 	}
-	log.Println("startServices completed.")
+	logging.Infof("startServices completed.")
+	return httpErr
+}
+
+// launchHttpServer starts a server for cfg in its own goroutine and waits
+// until its listeners are bound. The server is returned even on error, since
+// some listeners may be serving. Callers must hold appStateMutex.
+func launchHttpServer(cfg *config.Config) (*httpserver.Server, error) {
+	server := httpserver.NewServer(cfg)
+	serverWg.Add(1)
+	go func() {
+		defer serverWg.Done()
+		logging.Infof("Starting HTTP server goroutine...")
+		// Use a background context - shutdown is handled by stopServices
+		if err := server.Start(context.Background()); err != nil {
+			logging.Errorf("HTTP server failed: %v", err)
+		}
+		logging.Infof("HTTP server goroutine finished.")
+	}()
+
+	// Confirm the listener is bound before reporting the server as started
+	listenTimeout, err := cfg.HTTP.GetListenTimeout()
+	if err != nil {
+		logging.Warnf("Invalid listen timeout, using default: %v", err)
+		listenTimeout = 5 * time.Second
+	}
+	return server, server.WaitReady(listenTimeout)
+}
+
+// recordCleanup feeds the outcome of a cache cleaner pass into the metrics.
+func recordCleanup(res cachecleaner.Result) {
+	result := "ok"
+	if res.Err != nil {
+		result = "error"
+	}
+	metrics.CleanupRuns.Inc(result)
+	metrics.CleanupDeletedFiles.Add(float64(res.Expired), "expired")
+	metrics.CleanupDeletedFiles.Add(float64(res.Evicted), "max-size")
+	metrics.CleanupFreedBytes.Add(float64(res.BytesFreed))
+	metrics.CleanupDuration.ObserveDuration(res.Duration)
+}
+
+// listenersDisjoint reports whether the new listeners use none of the old
+// ports, so both sets can be bound at once. Ports are compared regardless of
+// address since 0.0.0.0:8080 and 127.0.0.1:8080 can't both be bound.
+func listenersDisjoint(oldHTTP, newHTTP config.HTTPConfig) bool {
+	oldPorts := make(map[int]bool)
+	for _, lc := range oldHTTP.GetListeners() {
+		oldPorts[lc.Port] = true
+	}
+	for _, lc := range newHTTP.GetListeners() {
+		if oldPorts[lc.Port] {
+			return false
+		}
+	}
+	return true
+}
+
+// swapHttpServer replaces the running server for a listener change without
+// a gap: the new listeners are bound first, and only then is the old server
+// shut down, draining its in-flight requests. Returns false (leaving the old
+// server running) if the new server couldn't bind all its listeners, in which
+// case the caller falls back to stop-then-start.
+func swapHttpServer(newCfg *config.Config) bool {
+	appStateMutex.Lock()
+	defer appStateMutex.Unlock()
+
+	oldServer := currentHttpServer
+	if oldServer == nil {
+		return false
+	}
+	logging.Infof("Binding new HTTP listeners before closing the old ones...")
+	newServer, err := launchHttpServer(newCfg)
+	if err == nil && newServer.ListenerCount() < len(newCfg.HTTP.GetListeners()) {
+		err = errors.New("some listeners failed to bind")
+	}
+	if err != nil {
+		logging.Warnf("New HTTP listeners not ready (%v), falling back to a full restart.", err)
+		if stopErr := newServer.Stop(); stopErr != nil {
+			logging.Errorf("Failed to stop partially started HTTP server: %v", stopErr)
+		}
+		return false
+	}
+
+	currentHttpServer = newServer
+	logging.Infof("New HTTP listeners are accepting connections, draining the old server...")
+	if err := oldServer.Stop(); err != nil {
+		logging.Errorf("Failed to stop old HTTP server: %v", err)
+	}
+	logging.Infof("HTTP server switched to the new listeners.")
+	return true
 }
 
 // stopServices gracefully stops running services selectively.
@@ -245,29 +506,29 @@ func stopServices(stopServer bool, stopCleaner bool) {
 	appStateMutex.Lock()
 	defer appStateMutex.Unlock()
 
-	log.Println("Attempting to stop services...")
+	logging.Infof("Attempting to stop services...")
 
 	// Stop HTTP Server
 	if stopServer && currentHttpServer != nil {
-		log.Println("Stopping HTTP server...")
+		logging.Infof("Stopping HTTP server...")
 		if err := currentHttpServer.Stop(); err != nil {
-			log.Printf("Error stopping HTTP server: %v", err)
+			logging.Errorf("Failed to stop HTTP server: %v", err)
 		} else {
-			log.Println("HTTP server stop initiated.")
+			logging.Infof("HTTP server stop initiated.")
 		}
 		currentHttpServer = nil // Clear variable after initiating stop
 	} else if stopServer {
-		log.Println("HTTP server stop requested but was not running.")
+		logging.Infof("HTTP server stop requested but was not running.")
 	}
 
 	// Stop Cache Cleaner
 	if stopCleaner && currentCleanerStop != nil {
-		log.Println("Stopping cache cleaner...")
+		logging.Infof("Stopping cache cleaner...")
 		currentCleanerStop()
-		log.Println("Cache cleaner stopped.")
+		logging.Infof("Cache cleaner stopped.")
 		currentCleanerStop = nil // Clear variable
 	} else if stopCleaner {
-		log.Println("Cache cleaner stop requested but was not running.")
+		logging.Infof("Cache cleaner stop requested but was not running.")
 	}
-	log.Println("stopServices completed.")
+	logging.Infof("stopServices completed.")
 }
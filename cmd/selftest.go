@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/config"
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+)
+
+// runSelfTest fetches the self-test URL through the proxy's own listener, as a
+// client would, and reports whether the origin answered with a 2xx or 3xx.
+// A 407 only proves the proxy is up: the self-test has no credentials.
+func runSelfTest(cfg *config.Config) error {
+	target := cfg.HTTP.ForwardProxy.SelfTestURL()
+	timeout, err := cfg.HTTP.ForwardProxy.SelfTest.GetTimeout()
+	if err != nil {
+		return err
+	}
+	proxyURL, err := selfTestProxyURL(cfg.HTTP)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyURL(proxyURL),
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // Our own listener, possibly reached by IP
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	defer client.CloseIdleConnections()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch of %s via %s failed: %w", target, proxyURL.Host, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body) // Proves the body makes it through too
+
+	switch {
+	case resp.StatusCode == http.StatusProxyAuthRequired:
+		logging.Warnf("Proxy self-test: %s answered 407, proxy is up but the origin was not tested (auth is enabled).", proxyURL.Host)
+		return nil
+	case resp.StatusCode >= 400:
+		return fmt.Errorf("fetch of %s via %s returned %s", target, proxyURL.Host, resp.Status)
+	}
+	cacheStatus := ""
+	if name := cfg.HTTP.ForwardProxy.Cache.StatusHeader.Name; name != "" {
+		cacheStatus = fmt.Sprintf(" (%s: %s)", name, resp.Header.Get(name))
+	}
+	logging.Infof("Proxy self-test passed: %s via %s returned %s in %s%s.",
+		target, proxyURL.Host, resp.Status, time.Since(start).Round(time.Millisecond), cacheStatus)
+	return nil
+}
+
+// selfTestProxyURL returns the proxy URL of the first listener serving the
+// forward proxy, with wildcard bind addresses replaced by loopback.
+func selfTestProxyURL(httpCfg config.HTTPConfig) (*url.URL, error) {
+	for _, l := range httpCfg.GetListeners() {
+		if !l.ServesFeature(config.FeatureProxy) {
+			continue
+		}
+		host := l.Addr
+		if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+			host = "127.0.0.1"
+			if ip != nil && ip.To4() == nil {
+				host = "::1"
+			}
+		}
+		scheme := "http"
+		if l.TLS {
+			scheme = "https"
+		}
+		return &url.URL{Scheme: scheme, Host: net.JoinHostPort(host, fmt.Sprint(l.Port))}, nil
+	}
+	return nil, errors.New("no listener serves the forward proxy")
+}
@@ -3,8 +3,9 @@ module github.com/mohammedhabas11/admin-bot
 go 1.23.0
 
 require (
-	github.com/spf13/viper v1.20.1
 	github.com/fsnotify/fsnotify v1.8.0
+	github.com/spf13/viper v1.20.1
+	golang.org/x/crypto v0.32.0
 )
 
 require (
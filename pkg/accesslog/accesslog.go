@@ -0,0 +1,238 @@
+// Package accesslog writes one structured record per proxied request, as
+// logfmt-style text or JSON lines, to stdout, stderr or a file.
+package accesslog
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/config"
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+)
+
+// Record is a single access log entry.
+type Record struct {
+	Time        time.Time     `json:"time"`
+	ClientIP    string        `json:"client_ip"`
+	Method      string        `json:"method"`
+	Host        string        `json:"host"` // Target host, host:port for CONNECT
+	Path        string        `json:"path,omitempty"`
+	Status      int           `json:"status"`
+	Bytes       int64         `json:"bytes"` // Body bytes sent to the client (tunnel bytes for CONNECT)
+	CacheStatus string        `json:"cache_status,omitempty"`
+	Duration    time.Duration `json:"-"`
+	DurationMs  float64       `json:"duration_ms"`
+	UserAgent   string        `json:"user_agent,omitempty"`
+	Referer     string        `json:"referer,omitempty"`
+	TLSVersion  string        `json:"tls_version,omitempty"` // Set for requests received over TLS
+	TLSCipher   string        `json:"tls_cipher,omitempty"`
+}
+
+// NewRecord fills in the request side of a record; the caller adds the
+// outcome (status, bytes, cache status) once the response is done.
+func NewRecord(r *http.Request, start time.Time) Record {
+	rec := Record{
+		Time:      start,
+		ClientIP:  r.RemoteAddr,
+		Method:    r.Method,
+		Host:      r.URL.Host,
+		Path:      r.URL.Path,
+		UserAgent: r.UserAgent(),
+		Referer:   r.Referer(),
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		rec.ClientIP = host
+	}
+	if rec.Host == "" {
+		rec.Host = r.Host
+	}
+	if r.TLS != nil {
+		rec.TLSVersion = tls.VersionName(r.TLS.Version)
+		rec.TLSCipher = tls.CipherSuiteName(r.TLS.CipherSuite)
+	}
+	return rec
+}
+
+// logger is one configured destination.
+type logger struct {
+	mu     sync.Mutex // Serializes writes so lines never interleave
+	out    io.Writer
+	file   *os.File // Non-nil when writing to a file, closed on reconfigure
+	json   bool
+	fields []field // Selected fields, nil writes all of them
+}
+
+// field is one selectable access log field: its text key (empty for the
+// leading timestamp), its JSON key and how to read it from a record.
+type field struct {
+	name    string // Name in http.access-log.fields
+	textKey string
+	jsonKey string
+	value   func(Record) any
+}
+
+// fields lists every field in the order they are written, matching
+// config.AccessLogFields and the historical text and JSON keys.
+var fields = []field{
+	{"time", "", "time", func(r Record) any { return r.Time }},
+	{"client-ip", "client", "client_ip", func(r Record) any { return r.ClientIP }},
+	{"method", "method", "method", func(r Record) any { return r.Method }},
+	{"host", "host", "host", func(r Record) any { return r.Host }},
+	{"path", "path", "path", func(r Record) any { return r.Path }},
+	{"status", "status", "status", func(r Record) any { return r.Status }},
+	{"bytes", "bytes", "bytes", func(r Record) any { return r.Bytes }},
+	{"cache-status", "cache", "cache_status", func(r Record) any { return r.CacheStatus }},
+	{"duration", "duration", "duration_ms", func(r Record) any { return r.Duration }},
+	{"tls-version", "tls", "tls_version", func(r Record) any { return r.TLSVersion }},
+	{"tls-cipher", "cipher", "tls_cipher", func(r Record) any { return r.TLSCipher }},
+	{"user-agent", "ua", "user_agent", func(r Record) any { return r.UserAgent }},
+	{"referer", "referer", "referer", func(r Record) any { return r.Referer }},
+}
+
+// selectFields returns the fields named in names in record order, nil (all
+// fields) when names is empty. Unknown names are skipped, config validation
+// reports them.
+func selectFields(names []string) []field {
+	if len(names) == 0 {
+		return nil
+	}
+	selected := []field{}
+	for _, f := range fields {
+		for _, name := range names {
+			if strings.EqualFold(name, f.name) {
+				selected = append(selected, f)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// current is the active logger, nil when access logging is off. Package
+// level so handlers rebuilt on reload don't need to carry it around.
+var current atomic.Pointer[logger]
+
+// Configure (re)opens the access log from cfg, replacing and closing the
+// previous one. A disabled config turns access logging off.
+func Configure(cfg config.AccessLogConfig) error {
+	var next *logger
+	if cfg.Enabled {
+		next = &logger{json: strings.EqualFold(cfg.Format, config.AccessLogJSON), fields: selectFields(cfg.Fields)}
+		switch output := cfg.GetOutput(); output {
+		case config.AccessLogStdout:
+			next.out = os.Stdout
+		case config.AccessLogStderr:
+			next.out = os.Stderr
+		default:
+			f, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+			if err != nil {
+				return fmt.Errorf("failed to open access log %s: %w", output, err)
+			}
+			next.out, next.file = f, f
+		}
+		logging.Infof("Access log enabled: format=%s, output=%s", cfg.Format, cfg.GetOutput())
+	}
+	if prev := current.Swap(next); prev != nil && prev.file != nil {
+		prev.mu.Lock()
+		prev.file.Close() // Writers still holding prev fail quietly
+		prev.mu.Unlock()
+	}
+	return nil
+}
+
+// Log writes rec to the access log, if one is configured.
+func Log(rec Record) {
+	l := current.Load()
+	if l == nil {
+		return
+	}
+	rec.DurationMs = float64(rec.Duration.Microseconds()) / 1000
+	var line []byte
+	switch {
+	case l.json && l.fields == nil:
+		var err error
+		if line, err = json.Marshal(rec); err != nil {
+			logging.Warnf("Failed to encode access log record: %v", err)
+			return
+		}
+	case l.json:
+		line = formatJSON(rec, l.fields)
+	default:
+		selected := l.fields
+		if selected == nil {
+			selected = fields
+		}
+		line = []byte(formatText(rec, selected))
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(line)
+}
+
+// formatText renders the selected fields of rec as space separated key=value
+// pairs after the timestamp, quoting values that contain spaces or quotes.
+// Empty values are left out.
+func formatText(rec Record, selected []field) string {
+	var b strings.Builder
+	for _, f := range selected {
+		var value string
+		switch v := f.value(rec).(type) {
+		case time.Time:
+			value = v.UTC().Format(time.RFC3339Nano)
+		case time.Duration:
+			value = v.Round(time.Microsecond).String()
+		default:
+			value = fmt.Sprint(v)
+		}
+		if value == "" {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		if f.textKey != "" {
+			b.WriteString(f.textKey + "=")
+		}
+		if strings.ContainsAny(value, " \"=") {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(value)
+	}
+	return b.String()
+}
+
+// formatJSON renders exactly the selected fields of rec as a JSON object,
+// in record order. Unlike the full record, empty values are kept so every
+// line has the same keys.
+func formatJSON(rec Record, selected []field) []byte {
+	line := []byte{'{'}
+	for i, f := range selected {
+		if i > 0 {
+			line = append(line, ',')
+		}
+		line = strconv.AppendQuote(line, f.jsonKey)
+		line = append(line, ':')
+		v := f.value(rec)
+		if d, ok := v.(time.Duration); ok {
+			v = float64(d.Microseconds()) / 1000 // duration_ms, like the full record
+		}
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			encoded = []byte("null")
+		}
+		line = append(line, encoded...)
+	}
+	return append(line, '}')
+}
@@ -0,0 +1,119 @@
+// Package basicauth checks HTTP Basic credentials against configured users
+// whose passwords are stored as bcrypt hashes.
+package basicauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"strings"
+	"sync"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/config"
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxVerified caps the remembered successful logins; the set is emptied when full.
+const maxVerified = 1024
+
+// credential is a configured user with the bcrypt hash of its password.
+type credential struct {
+	username [sha256.Size]byte // Digest, so comparisons are fixed length
+	hash     []byte
+}
+
+// Checker holds the accepted credentials.
+type Checker struct {
+	credentials []credential
+
+	// bcrypt is deliberately slow and proxy clients send credentials with
+	// every request, so credentials that passed are remembered (as a digest
+	// keyed with a per-checker random salt) until the checker is replaced.
+	// verified is nil, and every check runs bcrypt, if no salt could be drawn.
+	mu       sync.Mutex
+	salt     [32]byte
+	verified map[[sha256.Size]byte]struct{}
+}
+
+// New builds a checker for users. Entries with an unparsable hash are skipped
+// (config validation rejects them); what names the users in that warning.
+func New(users []config.ProxyUser, what string) *Checker {
+	c := &Checker{}
+	if _, err := rand.Read(c.salt[:]); err != nil {
+		logging.Errorf("No random salt for the %s credential cache, every request will be checked with bcrypt: %v", what, err)
+	} else {
+		c.verified = make(map[[sha256.Size]byte]struct{})
+	}
+	for _, u := range users {
+		hash, err := u.PasswordHashBytes()
+		if err != nil {
+			logging.Warnf("Skipping %s user '%s': %v", what, u.Username, err)
+			continue
+		}
+		c.credentials = append(c.credentials, credential{username: sha256.Sum256([]byte(u.Username)), hash: hash})
+	}
+	return c
+}
+
+// Users returns how many credentials the checker accepts.
+func (c *Checker) Users() int {
+	return len(c.credentials)
+}
+
+// Check reports whether header, an Authorization or Proxy-Authorization
+// value, carries valid Basic credentials. Every configured username is
+// compared in constant time and exactly one bcrypt comparison runs, against a
+// dummy hash for unknown users, so timing doesn't reveal which usernames exist.
+func (c *Checker) Check(header string) bool {
+	encoded, ok := strings.CutPrefix(header, "Basic ")
+	if !ok {
+		return false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return false
+	}
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return false
+	}
+
+	key := sha256.Sum256(append(c.salt[:], decoded...))
+	c.mu.Lock()
+	_, known := c.verified[key] // Never true for a nil map
+	c.mu.Unlock()
+	if known {
+		return true
+	}
+
+	userDigest := sha256.Sum256([]byte(username))
+	hash := dummyHash()
+	found := false
+	for _, cred := range c.credentials {
+		if subtle.ConstantTimeCompare(userDigest[:], cred.username[:]) == 1 && !found {
+			hash, found = cred.hash, true
+		}
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || !found {
+		return false
+	}
+
+	c.mu.Lock()
+	if c.verified != nil {
+		if len(c.verified) >= maxVerified {
+			clear(c.verified)
+		}
+		c.verified[key] = struct{}{}
+	}
+	c.mu.Unlock()
+	return true
+}
+
+// dummyHash is compared against for unknown usernames so they take as long as
+// known ones.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("admin-bot unknown user"), bcrypt.DefaultCost)
+	return hash
+})
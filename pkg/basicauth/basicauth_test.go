@@ -0,0 +1,84 @@
+package basicauth
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// htpasswdHash is "s3cret" as written by htpasswd -nbB (the $2y$ variant).
+const htpasswdHash = "$2y$05$WmU.vzl7IuI9evMhskZSNuGpeAFQiykXNPCXx0gpMJXlk0PUxW5EG"
+
+func basic(userpass string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(userpass))
+}
+
+func TestCheck(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New([]config.ProxyUser{
+		{Username: "ci", PasswordHash: string(hash)},
+		{Username: "ops", PasswordHash: htpasswdHash},
+		// Unsalted digests from older configs are skipped
+		{Username: "legacy", PasswordHash: "sha256:2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b"},
+	}, "test")
+	if c.Users() != 2 {
+		t.Fatalf("Users() = %d, want 2", c.Users())
+	}
+
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{basic("ci:s3cret"), true},
+		{basic("ci:s3cret"), true}, // Remembered after the first check
+		{basic("ops:s3cret"), true},
+		{basic("ci:wrong"), false},
+		{basic("CI:s3cret"), false},
+		{basic("other:s3cret"), false},
+		{basic("legacy:secret"), false},
+		{basic("ci"), false},
+		{"Bearer " + base64.StdEncoding.EncodeToString([]byte("ci:s3cret")), false},
+		{"Basic not-base64!", false},
+	}
+	for _, tt := range tests {
+		if got := c.Check(tt.header); got != tt.want {
+			t.Errorf("Check(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestPasswordHashBytes(t *testing.T) {
+	tests := []struct {
+		hash    string
+		wantErr bool
+	}{
+		{htpasswdHash, false},
+		{"sha256:2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b", true},
+		{"s3cret", true},
+		{"", true},
+	}
+	for _, tt := range tests {
+		u := config.ProxyUser{Username: "ci", PasswordHash: tt.hash}
+		if _, err := u.PasswordHashBytes(); (err != nil) != tt.wantErr {
+			t.Errorf("PasswordHashBytes(%q): err %v, want error %v", tt.hash, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckWithoutVerifiedCache(t *testing.T) {
+	c := New([]config.ProxyUser{{Username: "ops", PasswordHash: htpasswdHash}}, "test")
+	c.verified = nil // As left by New when no salt could be drawn
+	for i := 0; i < 2; i++ {
+		if !c.Check(basic("ops:s3cret")) {
+			t.Errorf("Check #%d with valid credentials = false, want true", i+1)
+		}
+	}
+	if c.Check(basic("ops:wrong")) {
+		t.Error("Check with a wrong password = true, want false")
+	}
+}
@@ -0,0 +1,183 @@
+package cachearchive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/forwardproxy"
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+)
+
+// Export writes every file under cacheDirs into a gzipped tarball at destPath,
+// with paths relative to the directory each file came from. File modification
+// times are preserved so TTLs stay accurate after import.
+// Returns the number of files exported.
+func Export(cacheDirs []string, destPath string) (int, error) {
+	if len(cacheDirs) == 0 {
+		return 0, errors.New("cache directory is not configured")
+	}
+
+	out, err := os.Create(destPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create archive %s: %w", destPath, err)
+	}
+	defer out.Close()
+
+	gzWriter := gzip.NewWriter(out)
+	tarWriter := tar.NewWriter(gzWriter)
+
+	fileCount := 0
+	for _, cacheDir := range cacheDirs {
+		if err := exportDir(tarWriter, cacheDir, &fileCount); err != nil {
+			return fileCount, fmt.Errorf("cache export failed: %w", err)
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return fileCount, fmt.Errorf("failed to finalize tar archive: %w", err)
+	}
+	if err := gzWriter.Close(); err != nil {
+		return fileCount, fmt.Errorf("failed to finalize gzip stream: %w", err)
+	}
+	return fileCount, nil
+}
+
+// exportDir archives the contents of one cache directory, counting files in fileCount.
+func exportDir(tarWriter *tar.Writer, cacheDir string, fileCount *int) error {
+	return filepath.WalkDir(cacheDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err // Abort, a partial export would silently lose entries
+		}
+		if path == cacheDir {
+			return nil // Don't archive the root itself
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			logging.Warnf("Skipping non-regular cache path %s", path)
+			return nil
+		}
+
+		relPath, err := filepath.Rel(cacheDir, path)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return fmt.Errorf("failed to build tar header for %s: %w", path, err)
+		}
+		header.Name = filepath.ToSlash(relPath)
+		header.Format = tar.FormatPAX // PAX keeps sub-second mod times
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return fmt.Errorf("failed to write tar header for %s: %w", path, err)
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := io.Copy(tarWriter, f); err != nil {
+			return fmt.Errorf("failed to archive %s: %w", path, err)
+		}
+		*fileCount++
+		return nil
+	})
+}
+
+// Import restores a tarball created by Export into cacheDirs, restoring the
+// original modification times. Each entry goes to the directory the proxy will
+// look it up in, so an archive can be imported into a different set of dirs.
+// Existing files with the same name are replaced.
+// Returns the number of files imported.
+func Import(srcPath string, cacheDirs []string) (int, error) {
+	if len(cacheDirs) == 0 {
+		return 0, errors.New("cache directory is not configured")
+	}
+
+	in, err := os.Open(srcPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open archive %s: %w", srcPath, err)
+	}
+	defer in.Close()
+
+	gzReader, err := gzip.NewReader(in)
+	if err != nil {
+		return 0, fmt.Errorf("archive %s is not gzip compressed: %w", srcPath, err)
+	}
+	defer gzReader.Close()
+	tarReader := tar.NewReader(gzReader)
+
+	for _, cacheDir := range cacheDirs {
+		if err := os.MkdirAll(cacheDir, 0750); err != nil {
+			return 0, fmt.Errorf("failed to create cache directory %s: %w", cacheDir, err)
+		}
+	}
+
+	fileCount := 0
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fileCount, fmt.Errorf("failed to read archive entry: %w", err)
+		}
+
+		// Refuse entries that would escape the cache directory
+		relPath := filepath.FromSlash(header.Name)
+		if !filepath.IsLocal(relPath) {
+			logging.Warnf("Skipping unsafe archive entry %q", header.Name)
+			continue
+		}
+		target := filepath.Join(forwardproxy.CacheDirFor(cacheDirs, relPath), relPath)
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			// Created as the files inside them are restored, in whichever dir they hash to
+		case tar.TypeReg:
+			if err := restoreFile(tarReader, target, header); err != nil {
+				return fileCount, err
+			}
+			fileCount++
+		default:
+			logging.Warnf("Skipping unsupported archive entry %q (type %c)", header.Name, header.Typeflag)
+		}
+	}
+	return fileCount, nil
+}
+
+// restoreFile writes a single archive entry to target and restores its mod time.
+func restoreFile(r io.Reader, target string, header *tar.Header) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0750); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", target, err)
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", target, err)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(target) // Don't leave a truncated cache entry behind
+		return fmt.Errorf("failed to write %s: %w", target, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", target, err)
+	}
+	// Restore the original mod time, which is what cache TTLs are measured from
+	if err := os.Chtimes(target, header.ModTime, header.ModTime); err != nil {
+		return fmt.Errorf("failed to restore mod time of %s: %w", target, err)
+	}
+	return nil
+}
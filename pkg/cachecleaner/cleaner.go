@@ -2,45 +2,104 @@ package cachecleaner
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io/fs"
-	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/forwardproxy"
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
 )
 
+// Options configures a cache cleaner.
+type Options struct {
+	Interval   time.Duration // Time between passes
+	Dirs       []string      // Cache directories, every one is cleaned on each pass
+	CacheTTL   time.Duration // Entries without an origin expiry expire this long after they're written
+	KeepStale  time.Duration // Expired entries are kept this much longer as stale fallbacks
+	MaxSize    int64         // Per-directory size cap, oldest entries are deleted beyond it (0 = no cap)
+	RunOnStart bool          // Run the first pass right away instead of after Interval
+
+	// OnRun, if set, is called with the outcome of every pass from the
+	// cleaner goroutine. It must not block for long.
+	OnRun func(Result)
+}
+
+// Result describes one cleanup pass over all directories.
+type Result struct {
+	Pass       string        // "initial" or "periodic"
+	Scanned    int           // Files looked at
+	Expired    int           // Files deleted for being expired
+	Evicted    int           // Files deleted to get a directory under MaxSize
+	DirsPruned int           // Empty subdirectories removed
+	BytesFreed int64         // Size of all deleted files
+	Duration   time.Duration // Time the pass took
+	Err        error         // Directories that couldn't be walked, nil if all were
+}
+
+// Deleted returns the number of files deleted by the pass.
+func (r Result) Deleted() int {
+	return r.Expired + r.Evicted
+}
+
 // StartCleaner begins the background cache cleaning process.
 // It returns a function that can be called to stop the cleaner.
-func StartCleaner(ctx context.Context, interval time.Duration, cacheDir string, cacheTTL time.Duration) (stopFunc func()) {
-	if interval <= 0 || cacheDir == "" || cacheTTL <= 0 {
-		log.Println("Cache cleaner not started: interval or TTL is zero/negative, or cacheDir is empty.")
+// Entries are deleted KeepStale after they expire, so they stay available as
+// stale fallbacks. A positive MaxSize caps each directory: oldest entries are
+// deleted until it fits once the expired ones are gone.
+func StartCleaner(ctx context.Context, opts Options) (stopFunc func()) {
+	if opts.Interval <= 0 || len(opts.Dirs) == 0 || opts.CacheTTL <= 0 {
+		logging.Infof("Cache cleaner not started: interval or TTL is zero/negative, or no cache dir is set.")
 		return func() {} // Return no-op stop function
 	}
 
-	log.Printf("Starting cache cleaner: Interval=%v, Dir=%s, TTL=%v", interval, cacheDir, cacheTTL)
-	ticker := time.NewTicker(interval)
+	logging.Infof("Starting cache cleaner: Interval=%v, Dirs=%s, TTL=%v, KeepStale=%v, MaxSize=%d, RunOnStart=%v",
+		opts.Interval, strings.Join(opts.Dirs, ","), opts.CacheTTL, opts.KeepStale, opts.MaxSize, opts.RunOnStart)
+	ticker := time.NewTicker(opts.Interval)
 	stopChan := make(chan struct{}) // Channel to signal stop
 
-	// Run initial cleanup immediately? Optional.
-	// go runCleanup(cacheDir, cacheTTL)
+	// cleanAll runs one pass over every dir; pass names it in the logs
+	cleanAll := func(pass string) {
+		logging.Infof("Running %s cache cleanup...", pass)
+		start := time.Now()
+		total := Result{Pass: pass}
+		var errs []error
+		for _, cacheDir := range opts.Dirs {
+			// One unreadable disk shouldn't stop the others from being cleaned
+			res, err := runCleanup(cacheDir, opts.CacheTTL, opts.KeepStale, opts.MaxSize)
+			total.add(res)
+			if err != nil {
+				logging.Errorf("Cache cleanup (%s pass) of %s failed: %v", pass, cacheDir, err)
+				errs = append(errs, fmt.Errorf("%s: %w", cacheDir, err))
+			} else {
+				logging.Infof("Cache cleanup (%s pass) of %s finished. Deleted %d expired files, %d files over max-size, %d empty dirs.", pass, cacheDir, res.Expired, res.Evicted, res.DirsPruned)
+			}
+		}
+		total.Duration, total.Err = time.Since(start), errors.Join(errs...)
+		if opts.OnRun != nil {
+			opts.OnRun(total)
+		}
+	}
 
 	go func() {
+		if opts.RunOnStart {
+			// In the goroutine so a large cache doesn't hold up startup
+			cleanAll("initial")
+		}
 		for {
 			select {
 			case <-ticker.C:
-				log.Println("Running cache cleanup...")
-				deletedCount, err := runCleanup(cacheDir, cacheTTL)
-				if err != nil {
-					log.Printf("ERROR during cache cleanup: %v", err)
-				} else {
-					log.Printf("Cache cleanup finished. Deleted %d expired files.", deletedCount)
-				}
+				cleanAll("periodic")
 			case <-stopChan:
-				log.Println("Stopping cache cleaner ticker.")
+				logging.Infof("Stopping cache cleaner ticker.")
 				ticker.Stop()
 				return
 			case <-ctx.Done(): // Listen for global context cancellation
-				log.Println("Stopping cache cleaner due to context cancellation.")
+				logging.Infof("Stopping cache cleaner due to context cancellation.")
 				ticker.Stop()
 				return
 			}
@@ -54,47 +113,73 @@ func StartCleaner(ctx context.Context, interval time.Duration, cacheDir string,
 	return stopFunc
 }
 
-// runCleanup walks the cache directory and removes expired files.
-// Returns the number of files deleted and any error encountered during the walk.
-func runCleanup(cacheDir string, cacheTTL time.Duration) (int, error) {
-	deletedCount := 0
+// add sums the counts of another directory's result into r.
+func (r *Result) add(o Result) {
+	r.Scanned += o.Scanned
+	r.Expired += o.Expired
+	r.Evicted += o.Evicted
+	r.DirsPruned += o.DirsPruned
+	r.BytesFreed += o.BytesFreed
+}
+
+// runCleanup walks the cache directory and removes files expired for longer
+// than keepStale, then, with a positive maxSize, the oldest entries until the
+// directory fits, and finally the subdirectories left empty. Returns the
+// counts of the directory (Pass, Duration and Err unset) and any error
+// encountered during the walk.
+func runCleanup(cacheDir string, cacheTTL, keepStale time.Duration, maxSize int64) (Result, error) {
+	var res Result
+	remaining := make(map[string]*entryFiles) // Surviving entries by path without extension
+	var subdirs []walkedDir                   // Domain and shard dirs, parents before children
 	now := time.Now()
-	minModTime := now.Add(-cacheTTL) // Files older than this will be deleted
+	minModTime := now.Add(-cacheTTL - keepStale) // Files older than this will be deleted
 
 	walkFunc := func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			// Log error accessing path but continue walking if possible
-			log.Printf("Error accessing path %s during cleanup walk: %v", path, err)
+			logging.Warnf("Can't access %s during cleanup walk: %v", path, err)
 			return nil // Continue walking other parts
 		}
 
-		// Skip directories, only process files
+		// Directories are pruned once their files are gone
 		if d.IsDir() {
 			// Don't delete the root cache directory itself
-			if path == cacheDir {
-				return nil
+			if path != cacheDir {
+				if info, err := d.Info(); err == nil {
+					subdirs = append(subdirs, walkedDir{path: path, modTime: info.ModTime()})
+				}
 			}
-			// Optional: Delete empty subdirectories? More complex. For now, skip.
 			return nil
 		}
 
 		// Get file info for modification time
 		info, err := d.Info() // Use DirEntry.Info() - more efficient
 		if err != nil {
-			log.Printf("Error getting info for %s: %v", path, err)
+			logging.Warnf("Can't stat %s during cleanup: %v", path, err)
 			return nil // Continue
 		}
+		res.Scanned++
 
-		// Check if file modification time is before the minimum allowed time
-		if info.ModTime().Before(minModTime) {
-			log.Printf("Deleting expired cache file: %s (ModTime: %s)", path, info.ModTime())
+		// Entries carrying an origin-supplied expiry (Cache-Control/Expires) use it,
+		// everything else expires by modification time
+		expired := info.ModTime().Before(minModTime)
+		if expiresAt, ok := forwardproxy.EntryExpiry(path); ok {
+			expired = now.After(expiresAt.Add(keepStale))
+		}
+		if expired {
+			logging.Infof("Deleting expired cache file: %s (ModTime: %s)", path, info.ModTime())
 			err := os.Remove(path)
 			if err != nil {
-				log.Printf("Error deleting file %s: %v", path, err)
+				logging.Errorf("Failed to delete expired file %s: %v", path, err)
 				// Log error but continue cleanup
 			} else {
-				deletedCount++
+				res.Expired++
+				res.BytesFreed += info.Size()
 			}
+			return nil
+		}
+		if maxSize > 0 {
+			addEntryFile(remaining, path, info)
 		}
 		return nil // Continue walking
 	}
@@ -102,8 +187,110 @@ func runCleanup(cacheDir string, cacheTTL time.Duration) (int, error) {
 	err := filepath.WalkDir(cacheDir, walkFunc)
 	if err != nil {
 		// This error is from WalkDir itself, e.g., root dir doesn't exist
-		return deletedCount, err
+		return res, err
+	}
+	if maxSize > 0 {
+		var freed int64
+		res.Evicted, freed = evictOldest(remaining, maxSize)
+		res.BytesFreed += freed
 	}
+	res.DirsPruned = pruneEmptyDirs(subdirs, now)
+	return res, nil
+}
 
-	return deletedCount, nil
+// pruneGrace spares directories changed this shortly before the walk: the
+// proxy may have just created one for an entry it is about to write.
+const pruneGrace = time.Minute
+
+// walkedDir is a subdirectory seen by the cleanup walk.
+type walkedDir struct {
+	path    string
+	modTime time.Time // As of the walk, before this pass deleted anything in it
+}
+
+// pruneEmptyDirs removes the directories in dirs (listed parents first, as
+// WalkDir visits them) that are empty, children first so a shard dir emptied
+// out leaves its parent empty too. Directories holding anything, cache files
+// or not, are kept. Returns the number removed.
+func pruneEmptyDirs(dirs []walkedDir, now time.Time) int {
+	pruned := 0
+	for i := len(dirs) - 1; i >= 0; i-- {
+		dir := dirs[i]
+		if now.Sub(dir.modTime) < pruneGrace {
+			continue
+		}
+		entries, err := os.ReadDir(dir.path)
+		if err != nil || len(entries) > 0 {
+			continue
+		}
+		// os.Remove refuses non-empty dirs, so a file written since ReadDir is safe
+		if err := os.Remove(dir.path); err != nil {
+			logging.Debugf("Not pruning cache dir %s: %v", dir.path, err)
+			continue
+		}
+		logging.Debugf("Pruned empty cache dir %s", dir.path)
+		pruned++
+	}
+	return pruned
+}
+
+// entryFiles is a cache entry on disk: its body file and metadata file.
+type entryFiles struct {
+	paths   []string
+	sizes   []int64 // Size of each file in paths
+	size    int64
+	modTime time.Time // Latest write of any of its files
+}
+
+// addEntryFile records a file that survived the expiry sweep under its entry.
+// Temp files of writes in progress are left alone.
+func addEntryFile(entries map[string]*entryFiles, path string, info fs.FileInfo) {
+	if strings.Contains(filepath.Base(path), ".tmp-") {
+		return
+	}
+	key := strings.TrimSuffix(strings.TrimSuffix(path, ".meta"), ".cache")
+	e := entries[key]
+	if e == nil {
+		e = &entryFiles{}
+		entries[key] = e
+	}
+	e.paths = append(e.paths, path)
+	e.sizes = append(e.sizes, info.Size())
+	e.size += info.Size()
+	if info.ModTime().After(e.modTime) {
+		e.modTime = info.ModTime()
+	}
+}
+
+// evictOldest deletes whole entries, least recently written first, until
+// their total size is at most maxSize. Returns the number of files deleted
+// and their size.
+func evictOldest(entries map[string]*entryFiles, maxSize int64) (deleted int, freed int64) {
+	var total int64
+	sorted := make([]*entryFiles, 0, len(entries))
+	for _, e := range entries {
+		total += e.size
+		sorted = append(sorted, e)
+	}
+	if total <= maxSize {
+		return 0, 0
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].modTime.Before(sorted[j].modTime) })
+
+	for _, e := range sorted {
+		if total <= maxSize {
+			break
+		}
+		for i, path := range e.paths {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				logging.Errorf("Failed to delete cache file %s over max-size: %v", path, err)
+				continue
+			}
+			logging.Debugf("Deleted cache file %s to stay under max-size", path)
+			deleted++
+			freed += e.sizes[i]
+		}
+		total -= e.size
+	}
+	return deleted, freed
 }
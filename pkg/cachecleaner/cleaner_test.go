@@ -0,0 +1,97 @@
+package cachecleaner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeAged creates the file at path (and its parent dirs) with a
+// modification time age ago.
+func writeAged(t *testing.T, path string, age time.Duration) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("cached"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	setAge(t, path, age)
+}
+
+func setAge(t *testing.T, path string, age time.Duration) {
+	t.Helper()
+	old := time.Now().Add(-age)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunCleanupPrunesEmptiedDirs(t *testing.T) {
+	root := t.TempDir()
+	expired := filepath.Join(root, "old.example.com", "ab", "cd", "entry.cache")
+	fresh := filepath.Join(root, "new.example.com", "ef", "entry.cache")
+	writeAged(t, expired, 48*time.Hour)
+	writeAged(t, fresh, time.Minute)
+	// Dirs older than the prune grace, as they would be on a real cache
+	for _, dir := range []string{
+		filepath.Join(root, "old.example.com", "ab", "cd"),
+		filepath.Join(root, "old.example.com", "ab"),
+		filepath.Join(root, "old.example.com"),
+		filepath.Join(root, "new.example.com", "ef"),
+		filepath.Join(root, "new.example.com"),
+		root,
+	} {
+		setAge(t, dir, 2*time.Hour)
+	}
+
+	res, err := runCleanup(root, time.Hour, 0, 0)
+	if err != nil {
+		t.Fatalf("runCleanup: %v", err)
+	}
+	if res.Expired != 1 || res.DirsPruned != 3 {
+		t.Errorf("runCleanup expired %d files and pruned %d dirs, want 1 and 3", res.Expired, res.DirsPruned)
+	}
+	if _, err := os.Stat(filepath.Join(root, "old.example.com")); !os.IsNotExist(err) {
+		t.Errorf("emptied domain dir still exists (err %v)", err)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("fresh entry was removed: %v", err)
+	}
+	if _, err := os.Stat(root); err != nil {
+		t.Errorf("cache root was removed: %v", err)
+	}
+}
+
+func TestRunCleanupKeepsRootAndRecentDirs(t *testing.T) {
+	root := t.TempDir()
+	setAge(t, root, 2*time.Hour)
+	recent := filepath.Join(root, "just-created.example.com")
+	if err := os.Mkdir(recent, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := runCleanup(root, time.Hour, 0, 0)
+	if err != nil {
+		t.Fatalf("runCleanup: %v", err)
+	}
+	if res.DirsPruned != 0 {
+		t.Errorf("pruned %d dirs, want 0", res.DirsPruned)
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Errorf("dir created within the grace period was removed: %v", err)
+	}
+
+	// With nothing left under it, the root is still kept
+	setAge(t, recent, 2*time.Hour)
+	if _, err := runCleanup(root, time.Hour, 0, 0); err != nil {
+		t.Fatalf("runCleanup: %v", err)
+	}
+	if _, err := os.Stat(recent); !os.IsNotExist(err) {
+		t.Errorf("old empty dir still exists (err %v)", err)
+	}
+	if _, err := os.Stat(root); err != nil {
+		t.Errorf("cache root was removed: %v", err)
+	}
+}
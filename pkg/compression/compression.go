@@ -0,0 +1,219 @@
+// Package compression gzips HTTP responses on the fly for clients that accept
+// it, for the static file server and the forward proxy alike.
+package compression
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/config"
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+)
+
+// Compressor decides which responses are gzipped. A nil *Compressor
+// (compression disabled) leaves every response untouched.
+type Compressor struct {
+	minSize      int64
+	contentTypes []string // Lowercase media type patterns: exact, "text/*" or "*+json"
+}
+
+// New returns the compressor for cfg, nil when compression is disabled.
+func New(cfg config.CompressionConfig) *Compressor {
+	if !cfg.Enabled {
+		return nil
+	}
+	minSize, err := cfg.GetMinSize()
+	if err != nil {
+		logging.Warnf("Invalid compression min-size, compressing all sizes: %v", err)
+	}
+	c := &Compressor{minSize: minSize}
+	for _, t := range cfg.ContentTypes {
+		c.contentTypes = append(c.contentTypes, strings.ToLower(strings.TrimSpace(t)))
+	}
+	return c
+}
+
+// Handler wraps next so its responses are compressed.
+func (c *Compressor) Handler(next http.Handler) http.Handler {
+	if c == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cw := c.Wrap(w, r)
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// Wrap returns a writer compressing the response to r where it qualifies.
+// The caller must Close it once the response is complete. Without
+// compression (nil c) the returned writer just passes everything through.
+func (c *Compressor) Wrap(w http.ResponseWriter, r *http.Request) *ResponseWriter {
+	return &ResponseWriter{
+		ResponseWriter: w,
+		c:              c,
+		accepted:       c != nil && r.Method != http.MethodHead && AcceptsGzip(r),
+	}
+}
+
+// compressible reports whether responses of contentType are compressed.
+// Event streams never are, buffering would hold back their events.
+func (c *Compressor) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "text/event-stream" {
+		return false
+	}
+	for _, pattern := range c.contentTypes {
+		switch {
+		case strings.HasSuffix(pattern, "/*"):
+			if strings.HasPrefix(mediaType, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		case strings.HasPrefix(pattern, "*+"):
+			if strings.HasSuffix(mediaType, pattern[1:]) {
+				return true
+			}
+		case mediaType == pattern:
+			return true
+		}
+	}
+	return false
+}
+
+// ResponseWriter gzips a response once it's known to be a compressible 200
+// of at least min-size. Bodies of unknown length are buffered up to min-size
+// before deciding.
+type ResponseWriter struct {
+	http.ResponseWriter
+	c        *Compressor
+	accepted bool // Client accepts gzip (and it's not a HEAD request)
+
+	status  int          // Status passed to WriteHeader, 0 until then
+	pending bool         // Eligible, buffering until min-size decides
+	buf     []byte       // Body held back while pending
+	gz      *gzip.Writer // Non-nil once compressing
+}
+
+// WriteHeader decides whether the response is compressed. Eligible responses
+// without a Content-Length are held back until min-size bytes were written.
+func (cw *ResponseWriter) WriteHeader(status int) {
+	if cw.status != 0 {
+		return
+	}
+	cw.status = status
+	h := cw.Header()
+	if cw.c == nil || status != http.StatusOK || h.Get("Content-Encoding") != "" || !cw.c.compressible(h.Get("Content-Type")) {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	h.Add("Vary", "Accept-Encoding") // The representation depends on it from here on
+	if !cw.accepted {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if n, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil {
+		if n < cw.c.minSize {
+			cw.ResponseWriter.WriteHeader(status)
+			return
+		}
+		cw.startGzip()
+		return
+	}
+	cw.pending = true
+}
+
+// Write compresses, buffers or passes through p depending on the decision
+// made by WriteHeader. Like net/http it sniffs a missing Content-Type.
+func (cw *ResponseWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		if cw.Header().Get("Content-Type") == "" && len(p) > 0 {
+			cw.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+	switch {
+	case cw.gz != nil:
+		return cw.gz.Write(p)
+	case cw.pending:
+		cw.buf = append(cw.buf, p...)
+		if int64(len(cw.buf)) >= cw.c.minSize {
+			cw.startGzip()
+			if _, err := cw.gz.Write(cw.buf); err != nil {
+				return 0, err
+			}
+			cw.buf = nil
+		}
+		return len(p), nil
+	default:
+		return cw.ResponseWriter.Write(p)
+	}
+}
+
+// startGzip sends the headers of a compressed response and starts the gzip stream.
+func (cw *ResponseWriter) startGzip() {
+	h := cw.Header()
+	h.Set("Content-Encoding", "gzip")
+	h.Del("Content-Length")
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		h.Set("ETag", "W/"+etag) // No longer byte-identical to the uncompressed representation
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	cw.pending = false
+	cw.gz = gzip.NewWriter(cw.ResponseWriter)
+}
+
+// Flush sends what was written so far, compressing a pending body regardless
+// of min-size since the handler is streaming.
+func (cw *ResponseWriter) Flush() {
+	if cw.pending {
+		cw.startGzip()
+		cw.gz.Write(cw.buf)
+		cw.buf = nil
+	}
+	if cw.gz != nil {
+		cw.gz.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Close completes the response: a body still pending is below min-size and
+// is sent uncompressed, a gzip stream is finished.
+func (cw *ResponseWriter) Close() error {
+	if cw.pending {
+		cw.pending = false
+		cw.ResponseWriter.WriteHeader(cw.status)
+		_, err := cw.ResponseWriter.Write(cw.buf)
+		cw.buf = nil
+		return err
+	}
+	if cw.gz != nil {
+		return cw.gz.Close()
+	}
+	return nil
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (cw *ResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// AcceptsGzip reports whether the client's Accept-Encoding allows gzip.
+func AcceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") && strings.TrimSpace(coding) != "*" {
+			continue
+		}
+		// "gzip;q=0" explicitly refuses it
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
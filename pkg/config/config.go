@@ -1,21 +1,33 @@
 package config
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
-	"log"
+	"io/fs"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	// "github.com/robfig/cron/v3" // Only needed if validating cron strings
 	"github.com/spf13/viper"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
 )
 
 var (
 	currentConfig *Config
 	configMutex   sync.RWMutex
-	viperInstance *viper.Viper // Keep viper instance for watching
+	viperInstance *viper.Viper   // Keep viper instance for watching
+	limiter       *reloadLimiter // Serializes watcher and Reload triggered reloads
+	reloadFailed  func(error)    // Optional, see OnReloadFailure
 )
 
 // loadAndValidate performs the core config reading, unmarshalling, and validation.
@@ -23,30 +35,27 @@ var (
 func loadAndValidate(path string) (*Config, error) {
 	v := viper.New() // Use a temporary viper instance for loading/validation
 	v.SetConfigFile(path)
-	v.SetConfigType("yaml")
+	v.SetConfigType(configType(path))
 
 	// Set defaults directly on the temporary instance
 	setDefaults(v)
+	bindEnv(v) // Same overrides as the running service, so -validate checks what would run
+
+	// Distinguish a missing file from one that exists but can't be read
+	if _, statErr := os.Stat(path); errors.Is(statErr, fs.ErrNotExist) {
+		return nil, &NotFoundError{Path: path, Err: statErr}
+	}
 
 	// Attempt to read the config file
-	err := v.ReadInConfig()
-	if err != nil {
-		// Return specific errors for handling upstream
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			// Check if it *really* doesn't exist vs. permission error etc.
-			if _, statErr := os.Stat(path); os.IsNotExist(statErr) {
-				return nil, err // Return the specific ConfigFileNotFoundError
-			}
-			// File exists but couldn't be read (permissions? format?)
-			return nil, fmt.Errorf("config file found at %s but could not be read: %w", path, err)
-		}
-		// Other error (e.g., YAML parsing error)
-		return nil, fmt.Errorf("failed to read/parse config file %s: %w", path, err)
+	if err := v.ReadInConfig(); err != nil {
+		// Permissions, YAML syntax errors, etc.
+		return nil, &ParseError{Path: path, Err: err}
 	}
+	logDefaultedSections(v, path)
 
 	var cfg Config
 	if err := v.Unmarshal(&cfg); err != nil {
-		return nil, fmt.Errorf("unable to decode config from %s into struct: %w", path, err)
+		return nil, &ParseError{Path: path, Err: fmt.Errorf("unable to decode into struct: %w", err)}
 	}
 
 	// Apply defaults that might depend on structure (like default index path)
@@ -54,30 +63,140 @@ func loadAndValidate(path string) (*Config, error) {
 
 	// Validate the loaded configuration
 	if !validateConfig(&cfg) {
-		// Return a generic validation error
-		return &cfg, errors.New("configuration validation failed (see warnings/errors above)")
+		return &cfg, &ValidationError{Path: path}
 	}
 
-	log.Printf("Configuration successfully loaded and validated from %s.", path)
+	logging.Infof("Configuration successfully loaded and validated from %s.", path)
 	return &cfg, nil
 }
 
+// configType picks the Viper config type from path's extension: "json",
+// "toml", or "yaml" for .yaml/.yml and anything unrecognized.
+func configType(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json"
+	case ".toml":
+		return "toml"
+	}
+	return "yaml"
+}
+
+// EnvPrefix prefixes environment variables that override config keys.
+const EnvPrefix = "ADMINBOT"
+
+// bindEnv lets ADMINBOT_<KEY> environment variables override config keys, with
+// the dots and dashes of the key path as underscores: ADMINBOT_HTTP_PORT sets
+// http.port, ADMINBOT_HTTP_FORWARD_PROXY_CACHE_CACHE_DIR sets
+// http.forward-proxy.cache.cache-dir. Every key of Config is bound, with or
+// without a default; lists take comma-separated values. Maps and lists of
+// sections (static dirs, routes...) can only be set from the file.
+func bindEnv(v *viper.Viper) {
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+	v.AutomaticEnv() // Still covers keys looked up directly with v.Get
+	for _, key := range configKeys(reflect.TypeOf(Config{}), "") {
+		v.BindEnv(key) // Can't fail with a key given
+	}
+}
+
+// configKeys lists the dotted mapstructure keys of every leaf field of t.
+// AutomaticEnv alone misses keys Unmarshal doesn't know about from a default
+// or the file, so they're bound explicitly.
+func configKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("mapstructure")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + name
+		ft := field.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct {
+			keys = append(keys, configKeys(ft, key+".")...)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// configSections are the sections reported by logDefaultedSections, in file order.
+var configSections = []string{
+	"log",
+	"http",
+	"http.timeouts",
+	"http.tls",
+	"http.maintenance",
+	"http.admin",
+	"http.metrics",
+	"http.health",
+	"http.access-log",
+	"http.compression",
+	"http.static",
+	"http.forward-proxy",
+	"http.forward-proxy.cache",
+	"proxy-cache-cleanup",
+}
+
+// authProblems lists what's wrong with the realm and users of the Basic auth
+// block at key, nil if nothing is.
+func authProblems(key, realm string, users []ProxyUser) []string {
+	var problems []string
+	if strings.ContainsAny(realm, "\"\r\n") {
+		problems = append(problems, fmt.Sprintf("%s.realm must not contain quotes or line breaks.", key))
+	}
+	for i, u := range users {
+		if u.Username == "" || strings.Contains(u.Username, ":") {
+			problems = append(problems, fmt.Sprintf("%s.users[%d].username must be non-empty and free of ':'.", key, i))
+		}
+		if _, err := u.PasswordHashBytes(); err != nil {
+			problems = append(problems, fmt.Sprintf("%s.users[%d] ('%s'): %v.", key, i, u.Username, err))
+		}
+	}
+	return problems
+}
+
+// logDefaultedSections logs (at debug) which config sections were present in
+// the file and which were left out and run entirely on defaults.
+func logDefaultedSections(v *viper.Viper, path string) {
+	var specified, defaulted []string
+	for _, section := range configSections {
+		if v.InConfig(section) {
+			specified = append(specified, section)
+		} else {
+			defaulted = append(defaulted, section)
+		}
+	}
+	logging.Debugf("Config %s: sections specified: [%s]; using defaults: [%s]", path, strings.Join(specified, ", "), strings.Join(defaulted, ", "))
+}
+
 // ValidateConfigFile attempts to load and validate a config file.
 // Used by the -validate CLI flag. Returns nil on success, error on failure.
 func ValidateConfigFile(path string) error {
 	_, err := loadAndValidate(path)
 	// For validation command, treat "file not found" as an error too
 	if err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			// Use the original error message from viper if possible
-			return fmt.Errorf("config file validation failed: %w", err)
-		}
-		// Return other errors (parsing, validation, read errors)
+		// Wrapping keeps the error kind (NotFoundError, ParseError, ValidationError) inspectable
 		return fmt.Errorf("config file validation failed: %w", err)
 	}
 	return nil // Success
 }
 
+// ReadConfigFile loads and validates a config file without watching it or
+// touching the global configuration. Used by one-shot CLI commands.
+func ReadConfigFile(path string) (*Config, error) {
+	cfg, err := loadAndValidate(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config file: %w", err)
+	}
+	return cfg, nil
+}
+
 // LoadConfig loads the main application configuration, sets up watching,
 // and handles the initial load, potentially using defaults if file not found.
 // It FATALS on unrecoverable errors during initial load (parsing, validation).
@@ -85,8 +204,9 @@ func LoadConfig(path string, reloadChan chan<- bool) (*Config, error) {
 	// Use a persistent viper instance for watching
 	viperInstance = viper.New()
 	viperInstance.SetConfigFile(path)
-	viperInstance.SetConfigType("yaml")
+	viperInstance.SetConfigType(configType(path))
 	setDefaults(viperInstance) // Set defaults on the persistent instance too
+	bindEnv(viperInstance)
 
 	// Perform initial load and validation using the core function
 	initialCfg, err := loadAndValidate(path)
@@ -94,13 +214,8 @@ func LoadConfig(path string, reloadChan chan<- bool) (*Config, error) {
 	// Handle initial load errors specifically for the running service
 	if err != nil {
 		// Allow service to start with defaults ONLY if the error is file not found
-		var isFileNotFoundError bool
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			isFileNotFoundError = true
-		}
-
-		if isFileNotFoundError {
-			log.Printf("INFO: Config file not found at %s. Attempting to run with defaults.", path)
+		if errors.Is(err, ErrNotFound) {
+			logging.Infof("Config file not found at %s. Attempting to run with defaults.", path)
 			// Create config purely from defaults set on viperInstance
 			var defaultCfg Config
 			if defaultUnmarshalErr := viperInstance.Unmarshal(&defaultCfg); defaultUnmarshalErr != nil {
@@ -110,10 +225,10 @@ func LoadConfig(path string, reloadChan chan<- bool) (*Config, error) {
 			applyDefaults(&defaultCfg) // Apply structural defaults
 			if !validateConfig(&defaultCfg) {
 				// If even defaults are invalid, treat as fatal
-				return nil, errors.New("default configuration is invalid, cannot start")
+				return nil, fmt.Errorf("default configuration is invalid, cannot start: %w", &ValidationError{})
 			}
 			initialCfg = &defaultCfg // Use the validated default config
-			log.Println("Successfully initialized with default configuration.")
+			logging.Infof("Successfully initialized with default configuration.")
 			// Clear the error since we are proceeding with defaults
 			err = nil
 		} else {
@@ -137,61 +252,163 @@ func LoadConfig(path string, reloadChan chan<- bool) (*Config, error) {
 	// Watch the specific file used, necessary if path wasn't found initially
 	// but might be created later. Viper needs to know *what* to watch.
 	viperInstance.WatchConfig()
+	limiter = &reloadLimiter{reload: func() {
+		if err := reloadFromFile(reloadChan); err != nil && reloadFailed != nil {
+			reloadFailed(err)
+		}
+	}}
 	viperInstance.OnConfigChange(func(e fsnotify.Event) {
-		log.Printf("Config file changed: %s. Reloading...", e.Name)
+		logging.Infof("Config file changed: %s.", e.Name)
+		limiter.request(GetConfig().MaxReloadsPerMinute)
+	})
 
-		// Re-read using the persistent viper instance
-		if err := viperInstance.ReadInConfig(); err != nil {
-			// Log error, but don't necessarily stop watching or kill app
-			// Maybe the file is temporarily unreadable?
-			log.Printf("ERROR: Error re-reading config file on change: %v", err)
-			return // Keep old config if re-read fails
-		}
+	logging.Infof("Configuration monitoring active for %s (or defaults).", viperInstance.ConfigFileUsed())
+	return currentConfig, nil // Return the initial config (loaded or default)
+}
 
-		var tempCfg Config
-		if err := viperInstance.Unmarshal(&tempCfg); err != nil {
-			log.Printf("ERROR: Failed to reload config into struct: %v", err)
-			return // Keep old config if unmarshal fails
-		}
+// Reload re-reads the config file now, as if the watcher had seen it change,
+// for when file events can't be relied on (e.g. SIGHUP after a configmap
+// symlink swap or on NFS). It isn't subject to max-reloads-per-minute but
+// never overlaps a watcher reload. Does nothing before LoadConfig.
+func Reload() {
+	if limiter == nil {
+		return
+	}
+	limiter.run()
+}
 
-		applyDefaults(&tempCfg) // Apply structural defaults
+// OnReloadFailure registers fn to be called with the reason whenever a reload
+// is rejected and the previous config is kept. Call it before LoadConfig.
+func OnReloadFailure(fn func(error)) {
+	reloadFailed = fn
+}
 
-		if !validateConfig(&tempCfg) {
-			log.Printf("ERROR: Reloaded configuration is invalid. Keeping previous configuration.")
-			return
-		}
+// reloadFromFile re-reads the watched config file and, if it's valid, makes it
+// the current config and signals main. Invalid files keep the previous config
+// and are reported in the returned error.
+func reloadFromFile(reloadChan chan<- bool) error {
+	logging.Infof("Reloading configuration...")
 
-		// Update global config atomically
-		configMutex.Lock()
-		currentConfig = &tempCfg
-		configMutex.Unlock()
-		log.Println("Configuration reloaded successfully.")
+	// Re-read using the persistent viper instance
+	if err := viperInstance.ReadInConfig(); err != nil {
+		// Log error, but don't necessarily stop watching or kill app
+		// Maybe the file is temporarily unreadable?
+		logging.Errorf("Error re-reading config file on change: %v", err)
+		return &ParseError{Path: viperInstance.ConfigFileUsed(), Err: err} // Keep old config if re-read fails
+	}
 
-		// Send signal to main goroutine
-		if reloadChan != nil {
-			select {
-			case reloadChan <- true:
-				log.Println("Sent reload signal to main.")
-			default:
-				log.Println("WARN: Failed to send reload signal to main (channel full or nil).")
-			}
-		}
-	})
+	var tempCfg Config
+	if err := viperInstance.Unmarshal(&tempCfg); err != nil {
+		logging.Errorf("Failed to reload config into struct: %v", err)
+		return &ParseError{Path: viperInstance.ConfigFileUsed(), Err: err} // Keep old config if unmarshal fails
+	}
 
-	log.Printf("Configuration monitoring active for %s (or defaults).", viperInstance.ConfigFileUsed())
-	return currentConfig, nil // Return the initial config (loaded or default)
+	applyDefaults(&tempCfg) // Apply structural defaults
+
+	if !validateConfig(&tempCfg) {
+		logging.Errorf("Reloaded configuration is invalid. Keeping previous configuration.")
+		return &ValidationError{Path: viperInstance.ConfigFileUsed()}
+	}
+
+	// Update global config atomically
+	configMutex.Lock()
+	currentConfig = &tempCfg
+	configMutex.Unlock()
+	logging.Infof("Configuration reloaded successfully.")
+
+	// Send signal to main goroutine
+	if reloadChan != nil {
+		select {
+		case reloadChan <- true:
+			logging.Infof("Sent reload signal to main.")
+		default:
+			logging.Warnf("Failed to send reload signal to main (channel full or nil).")
+		}
+	}
+	return nil
 }
 
 // setDefaults applies default values using Viper.
 func setDefaults(v *viper.Viper) {
+	v.SetDefault("strict", false)
+	v.SetDefault("max-reloads-per-minute", 10)
+	v.SetDefault("reload-webhook", "")
 	v.SetDefault("http.enabled", true)
 	v.SetDefault("http.addr", "0.0.0.0")
 	v.SetDefault("http.port", 8080)
+	v.SetDefault("http.listen-timeout", "5s")
+	v.SetDefault("http.shutdown-timeout", "15s")
+	v.SetDefault("http.timeouts.read-header", "10s")
+	v.SetDefault("http.timeouts.read", "30s")
+	v.SetDefault("http.timeouts.write", "60s")
+	v.SetDefault("http.timeouts.idle", "120s")
+	v.SetDefault("http.timeouts.streaming-content-types", []string{"text/event-stream"})
+	v.SetDefault("http.connect-reject-status", 405)
+	v.SetDefault("http.proxy-protocol", false)
+	v.SetDefault("http.log-tls", false)
 	v.SetDefault("http.static.enabled", false)
+	v.SetDefault("http.maintenance.enabled", false)
+	v.SetDefault("http.admin.enabled", false)
+	v.SetDefault("http.metrics.enabled", false)
+	v.SetDefault("http.health.enabled", false)
+	v.SetDefault("http.tls.enabled", false)
+	v.SetDefault("http.bind-then-swap", true)
+	v.SetDefault("http.access-log.enabled", false)
+	v.SetDefault("http.access-log.format", AccessLogText)
+	v.SetDefault("http.access-log.output", AccessLogStdout)
+	v.SetDefault("http.compression.enabled", false)
+	v.SetDefault("http.compression.min-size", "1KB")
+	v.SetDefault("http.compression.content-types", []string{"text/*", "application/json", "application/javascript", "application/xml", "application/wasm", "image/svg+xml", "*+json", "*+xml"})
+	v.SetDefault("log.level", "info")
+	v.SetDefault("http.metrics.path", "/metrics")
 	v.SetDefault("http.forward-proxy.enabled", false)
+	v.SetDefault("http.forward-proxy.host-mismatch", HostMismatchLog)
+	v.SetDefault("http.forward-proxy.url-credentials", URLCredentialsAuthorization)
+	v.SetDefault("http.forward-proxy.force-close", false)
+	v.SetDefault("http.forward-proxy.http10-keep-alive", true)
+	v.SetDefault("http.forward-proxy.http2", true)
+	v.SetDefault("http.forward-proxy.forwarded-header", false)
+	v.SetDefault("http.forward-proxy.normalize-paths", false)
+	v.SetDefault("http.forward-proxy.trace", false)
+	v.SetDefault("http.forward-proxy.auth.enabled", false)
+	v.SetDefault("http.forward-proxy.self-test.enabled", false)
+	v.SetDefault("http.forward-proxy.self-test.timeout", "10s")
+	v.SetDefault("http.forward-proxy.self-request.status", http.StatusNotFound)
+	v.SetDefault("http.forward-proxy.self-request.log-client", true)
+	v.SetDefault("http.forward-proxy.block-private-networks", true)
+	v.SetDefault("http.forward-proxy.max-conns-per-host", 0)
+	v.SetDefault("http.forward-proxy.conn-queue-timeout", "10s")
+	v.SetDefault("http.forward-proxy.tunnel-idle-timeout", "0")
+	v.SetDefault("http.forward-proxy.timeouts.connect", "30s")
+	v.SetDefault("http.forward-proxy.timeouts.tls-handshake", "10s")
+	v.SetDefault("http.forward-proxy.timeouts.response-header", "30s")
+	v.SetDefault("http.forward-proxy.timeouts.request", "30s")
+	v.SetDefault("http.forward-proxy.timeouts.idle-conn", "90s")
+	v.SetDefault("http.forward-proxy.max-response-headers", 200)
+	v.SetDefault("http.forward-proxy.max-response-header-size", "1MB")
+	v.SetDefault("http.forward-proxy.max-response-size", "0")
 	v.SetDefault("http.forward-proxy.cache.enabled", false)
 	v.SetDefault("http.forward-proxy.cache.cache-ttl", "7d")
+	v.SetDefault("http.forward-proxy.cache.skip-query-urls", false)
+	v.SetDefault("http.forward-proxy.cache.honor-cache-headers", true)
+	v.SetDefault("http.forward-proxy.cache.compress", false)
+	v.SetDefault("http.forward-proxy.cache.max-object-size", "256MB")
+	v.SetDefault("http.forward-proxy.cache.max-size", "0")
+	v.SetDefault("http.forward-proxy.cache.negative-ttl", "0")
+	v.SetDefault("http.forward-proxy.cache.negative-statuses", []int{http.StatusNotFound})
+	v.SetDefault("http.forward-proxy.cache.ttl-header", "")
+	v.SetDefault("http.forward-proxy.cache.honor-client-no-cache", true)
+	v.SetDefault("http.forward-proxy.cache.status-header.name", "X-Cache-Status")
+	v.SetDefault("http.forward-proxy.cache.status-header.hit", "HIT")
+	v.SetDefault("http.forward-proxy.cache.status-header.miss", "MISS")
+	v.SetDefault("http.forward-proxy.cache.status-header.bypass", "BYPASS")
+	v.SetDefault("http.forward-proxy.cache.refresh-ahead.enabled", false)
+	v.SetDefault("http.forward-proxy.cache.refresh-ahead.window", "10m")
+	v.SetDefault("http.forward-proxy.cache.refresh-ahead.interval", "1m")
+	v.SetDefault("http.forward-proxy.cache.refresh-ahead.min-hits", 2)
 	v.SetDefault("proxy-cache-cleanup.interval", "1h")
+	v.SetDefault("proxy-cache-cleanup.run-on-start", true)
+	v.SetDefault("proxy-cache-cleanup.max-size", "0")
 }
 
 // applyDefaults sets default values for nested config fields if they are empty.
@@ -209,7 +426,7 @@ func GetConfig() *Config {
 	configMutex.RLock()
 	defer configMutex.RUnlock()
 	if currentConfig == nil {
-		log.Println("WARNING: GetConfig called before LoadConfig completed or after failure.")
+		logging.Warnf("GetConfig called before LoadConfig completed or after failure.")
 		return &Config{}
 	}
 	return currentConfig
@@ -221,23 +438,450 @@ func validateConfig(cfg *Config) bool {
 	isValid := true
 	errorPrefix := "Config validation error:" // Prefix for fatal validation errors
 
+	if cfg.MaxReloadsPerMinute < 0 {
+		logging.Errorf("%s max-reloads-per-minute must not be negative, got %d.", errorPrefix, cfg.MaxReloadsPerMinute)
+		isValid = false
+	}
+	if hook := cfg.ReloadWebhook; hook != "" {
+		if u, err := url.Parse(hook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			logging.Errorf("%s reload-webhook ('%s') must be an absolute http(s) URL.", errorPrefix, hook)
+			isValid = false
+		}
+	}
+	if _, ok := logging.ParseLevel(cfg.Log.Level); !ok {
+		logging.Errorf("%s Invalid log.level ('%s'), expected debug, info, warn or error.", errorPrefix, cfg.Log.Level)
+		isValid = false
+	}
+
+	// Validate Server Settings
+	if cfg.HTTP.Enabled {
+		if _, err := cfg.HTTP.GetListenTimeout(); err != nil {
+			logging.Errorf("%s Invalid http.listen-timeout ('%s'): %v.", errorPrefix, cfg.HTTP.ListenTimeout, err)
+			isValid = false
+		}
+		if _, err := cfg.HTTP.GetShutdownTimeout(); err != nil {
+			logging.Errorf("%s %v.", errorPrefix, err)
+			isValid = false
+		}
+		for _, get := range []func() (time.Duration, error){
+			cfg.HTTP.Timeouts.GetReadHeader, cfg.HTTP.Timeouts.GetRead,
+			cfg.HTTP.Timeouts.GetWrite, cfg.HTTP.Timeouts.GetIdle,
+		} {
+			if _, err := get(); err != nil {
+				logging.Errorf("%s %v.", errorPrefix, err)
+				isValid = false
+			}
+		}
+		if al := cfg.HTTP.AccessLog; al.Enabled {
+			if f := strings.ToLower(al.Format); f != AccessLogText && f != AccessLogJSON {
+				logging.Errorf("%s Invalid http.access-log.format ('%s'), expected text or json.", errorPrefix, al.Format)
+				isValid = false
+			}
+			if out := al.GetOutput(); out != AccessLogStdout && out != AccessLogStderr {
+				if info, err := os.Stat(filepath.Dir(out)); err != nil || !info.IsDir() {
+					logging.Errorf("%s http.access-log.output ('%s'): directory does not exist.", errorPrefix, out)
+					isValid = false
+				}
+			}
+			for _, f := range al.Fields {
+				if !slices.Contains(AccessLogFields, strings.ToLower(f)) {
+					logging.Errorf("%s Unknown http.access-log.fields entry '%s', expected one of %s.", errorPrefix, f, strings.Join(AccessLogFields, ", "))
+					isValid = false
+				}
+			}
+		}
+		if cfg.HTTP.Compression.Enabled {
+			if _, err := cfg.HTTP.Compression.GetMinSize(); err != nil {
+				logging.Errorf("%s %v.", errorPrefix, err)
+				isValid = false
+			}
+			if len(cfg.HTTP.Compression.ContentTypes) == 0 {
+				logging.Warnf("http.compression is enabled but content-types is empty, nothing will be compressed.")
+			}
+		}
+		if s := cfg.HTTP.ConnectRejectStatus; s != http.StatusMethodNotAllowed && s != http.StatusNotImplemented {
+			logging.Errorf("%s Invalid http.connect-reject-status (%d), expected 405 or 501.", errorPrefix, s)
+			isValid = false
+		}
+		seenAddrs := make(map[string]bool)
+		for i, l := range cfg.HTTP.Listeners {
+			if l.Port <= 0 || l.Port > 65535 {
+				logging.Errorf("%s http.listeners[%d] has invalid port %d.", errorPrefix, i, l.Port)
+				isValid = false
+			}
+			if seenAddrs[l.Address()] {
+				logging.Errorf("%s http.listeners[%d] duplicates address '%s'.", errorPrefix, i, l.Address())
+				isValid = false
+			}
+			seenAddrs[l.Address()] = true
+			for _, f := range l.Serves {
+				switch strings.ToLower(strings.TrimSpace(f)) {
+				case FeatureProxy, FeatureStatic, FeatureAdmin, FeatureMetrics:
+				default:
+					logging.Errorf("%s http.listeners[%d] serves unknown feature '%s' (use %s, %s, %s or %s).", errorPrefix, i, f, FeatureProxy, FeatureStatic, FeatureAdmin, FeatureMetrics)
+					isValid = false
+				}
+			}
+		}
+		for i, rt := range cfg.HTTP.Routes {
+			if !strings.HasPrefix(rt.Prefix, "/") {
+				logging.Errorf("%s http.routes[%d] prefix '%s' must start with '/'.", errorPrefix, i, rt.Prefix)
+				isValid = false
+			}
+			switch rt.Handler {
+			case FeatureProxy:
+				if !cfg.HTTP.ForwardProxy.Enabled {
+					logging.Warnf("http.routes[%d] sends '%s' to the proxy, but forward-proxy is disabled; those requests get 404.", i, rt.Prefix)
+				}
+			case FeatureStatic:
+				if !strings.HasPrefix(rt.Prefix, "/static/") {
+					logging.Warnf("http.routes[%d] sends '%s' to static files, which are only served under /static/; those requests get 404.", i, rt.Prefix)
+				}
+			default:
+				logging.Errorf("%s http.routes[%d] has unknown handler '%s' (use %s or %s).", errorPrefix, i, rt.Handler, FeatureProxy, FeatureStatic)
+				isValid = false
+			}
+		}
+		// A server with neither static dirs nor the proxy can only answer 404
+		hasStatic := cfg.HTTP.Static.Enabled && len(cfg.HTTP.Static.Dirs) > 0
+		if !hasStatic && !cfg.HTTP.ForwardProxy.Enabled {
+			if cfg.Strict {
+				logging.Errorf("%s http.enabled is true, but neither static dirs nor forward-proxy are enabled (nothing to serve).", errorPrefix)
+				isValid = false
+			} else {
+				logging.Warnf("http.enabled is true, but neither static dirs nor forward-proxy are enabled. The server will answer 404 to everything.")
+			}
+		}
+	}
+
+	// Validate Admin Settings
+	if cfg.HTTP.Admin.Enabled && cfg.HTTP.Admin.Token == "" {
+		logging.Errorf("%s http.admin.enabled is true, but http.admin.token is not set.", errorPrefix)
+		isValid = false
+	}
+
+	// Validate TLS Settings: the pair must load, or every HTTPS handshake would fail
+	if cfg.HTTP.TLS.Enabled {
+		if cfg.HTTP.TLS.CertFile == "" || cfg.HTTP.TLS.KeyFile == "" {
+			logging.Errorf("%s http.tls.enabled is true, but cert-file and key-file are not both set.", errorPrefix)
+			isValid = false
+		} else if _, err := tls.LoadX509KeyPair(cfg.HTTP.TLS.CertFile, cfg.HTTP.TLS.KeyFile); err != nil {
+			logging.Errorf("%s http.tls cert-file '%s' / key-file '%s' can't be loaded: %v", errorPrefix, cfg.HTTP.TLS.CertFile, cfg.HTTP.TLS.KeyFile, err)
+			isValid = false
+		}
+	}
+	for i, l := range cfg.HTTP.Listeners {
+		if l.TLS && !cfg.HTTP.TLS.Enabled {
+			logging.Errorf("%s http.listeners[%d] sets tls, but http.tls is not enabled.", errorPrefix, i)
+			isValid = false
+		}
+	}
+
+	// Validate Metrics Settings
+	if cfg.HTTP.Metrics.Enabled {
+		if p := cfg.HTTP.Metrics.Path; !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "/admin/") || strings.HasPrefix(p, "/static/") {
+			logging.Errorf("%s http.metrics.path '%s' must start with '/' and not be under /admin/ or /static/.", errorPrefix, p)
+			isValid = false
+		}
+	}
+
+	// Validate Maintenance Settings
+	if cfg.HTTP.Maintenance.Enabled && cfg.HTTP.Maintenance.Page != "" {
+		if _, err := os.Stat(cfg.HTTP.Maintenance.Page); err != nil {
+			logging.Warnf("Maintenance page '%s' is not accessible, the built-in page will be used: %v", cfg.HTTP.Maintenance.Page, err)
+		}
+	}
+
+	// Validate Proxy Settings
+	if cfg.HTTP.ForwardProxy.Enabled {
+		switch cfg.HTTP.ForwardProxy.HostMismatch {
+		case "", HostMismatchIgnore, HostMismatchLog, HostMismatchReject:
+		default:
+			logging.Errorf("%s Invalid http.forward-proxy.host-mismatch ('%s'), expected one of: %s, %s, %s.", errorPrefix, cfg.HTTP.ForwardProxy.HostMismatch, HostMismatchIgnore, HostMismatchLog, HostMismatchReject)
+			isValid = false
+		}
+		switch cfg.HTTP.ForwardProxy.URLCredentials {
+		case "", URLCredentialsAuthorization, URLCredentialsStrip, URLCredentialsReject:
+		default:
+			logging.Errorf("%s Invalid http.forward-proxy.url-credentials ('%s'), expected one of: %s, %s, %s.", errorPrefix, cfg.HTTP.ForwardProxy.URLCredentials, URLCredentialsAuthorization, URLCredentialsStrip, URLCredentialsReject)
+			isValid = false
+		}
+		if _, err := cfg.HTTP.ForwardProxy.GetSourceIP(); err != nil {
+			logging.Errorf("%s %v.", errorPrefix, err)
+			isValid = false
+		}
+		upstreamTimeouts := cfg.HTTP.ForwardProxy.Timeouts
+		for _, get := range []func() (time.Duration, error){
+			upstreamTimeouts.GetConnect, upstreamTimeouts.GetTLSHandshake,
+			upstreamTimeouts.GetResponseHeader, upstreamTimeouts.GetRequest, upstreamTimeouts.GetIdleConn,
+		} {
+			if _, err := get(); err != nil {
+				logging.Errorf("%s %v.", errorPrefix, err)
+				isValid = false
+			}
+		}
+		if cfg.HTTP.ForwardProxy.MaxConnsPerHost < 0 {
+			logging.Errorf("%s http.forward-proxy.max-conns-per-host cannot be negative (%d).", errorPrefix, cfg.HTTP.ForwardProxy.MaxConnsPerHost)
+			isValid = false
+		}
+		if _, err := cfg.HTTP.ForwardProxy.GetConnQueueTimeout(); err != nil {
+			logging.Errorf("%s %v.", errorPrefix, err)
+			isValid = false
+		}
+		if _, err := cfg.HTTP.ForwardProxy.GetTunnelIdleTimeout(); err != nil {
+			logging.Errorf("%s %v.", errorPrefix, err)
+			isValid = false
+		}
+		if s := cfg.HTTP.ForwardProxy.SelfRequest.Status; s < 400 || s > 599 {
+			logging.Errorf("%s Invalid http.forward-proxy.self-request.status (%d), expected a 4xx or 5xx status.", errorPrefix, s)
+			isValid = false
+		}
+		if strings.ContainsAny(cfg.HTTP.ForwardProxy.ProxyAgent, "\r\n") {
+			logging.Errorf("%s http.forward-proxy.proxy-agent must not contain line breaks.", errorPrefix)
+			isValid = false
+		}
+		if page := cfg.HTTP.ForwardProxy.TimeoutPage; page != "" {
+			if _, err := os.Stat(page); err != nil {
+				logging.Warnf("Proxy timeout page '%s' is not accessible, the default 504 body will be used: %v", page, err)
+			}
+		}
+		for i, rule := range cfg.HTTP.ForwardProxy.LocationRewrites {
+			if u, err := url.Parse(rule.From); err != nil || !u.IsAbs() || u.Host == "" {
+				logging.Errorf("%s http.forward-proxy.location-rewrites[%d].from ('%s') must be an absolute URL prefix.", errorPrefix, i, rule.From)
+				isValid = false
+			}
+			if rule.To == "" {
+				logging.Errorf("%s http.forward-proxy.location-rewrites[%d].to must not be empty.", errorPrefix, i)
+				isValid = false
+			}
+		}
+		hostLists := map[string][]string{
+			"domains":       cfg.HTTP.ForwardProxy.Domains,
+			"allow":         cfg.HTTP.ForwardProxy.Allow,
+			"deny":          cfg.HTTP.ForwardProxy.Deny,
+			"http1-domains": cfg.HTTP.ForwardProxy.HTTP1Domains,
+		}
+		for key, patterns := range hostLists {
+			for i, pattern := range patterns {
+				if pattern == "" || strings.Contains(strings.TrimPrefix(pattern, "*."), "*") || strings.ContainsAny(pattern, "/: ") {
+					logging.Errorf("%s http.forward-proxy.%s[%d] ('%s') must be a host or a \"*.domain\" / \".domain\" wildcard.", errorPrefix, key, i, pattern)
+					isValid = false
+				}
+			}
+		}
+		if auth := cfg.HTTP.ForwardProxy.Auth; auth.Enabled {
+			if len(auth.Users) == 0 {
+				logging.Errorf("%s http.forward-proxy.auth is enabled but no users are configured.", errorPrefix)
+				isValid = false
+			}
+			for _, problem := range authProblems("http.forward-proxy.auth", auth.Realm, auth.Users) {
+				logging.Errorf("%s %s", errorPrefix, problem)
+				isValid = false
+			}
+		}
+		if st := cfg.HTTP.ForwardProxy.SelfTest; st.Enabled {
+			if _, err := st.GetTimeout(); err != nil {
+				logging.Errorf("%s %v.", errorPrefix, err)
+				isValid = false
+			}
+			if u, err := url.Parse(st.URL); st.URL != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+				logging.Errorf("%s http.forward-proxy.self-test.url ('%s') must be an absolute http(s) URL.", errorPrefix, st.URL)
+				isValid = false
+			} else if cfg.HTTP.ForwardProxy.SelfTestURL() == "" {
+				logging.Errorf("%s http.forward-proxy.self-test is enabled, but neither self-test.url nor an exact cache domain is set.", errorPrefix)
+				isValid = false
+			}
+			if cfg.HTTP.ForwardProxy.Auth.Enabled {
+				logging.Warnf("http.forward-proxy.self-test can't authenticate while auth is enabled, a 407 will count as reaching the proxy only.")
+			}
+		}
+		if cfg.HTTP.ForwardProxy.MaxResponseHeaders < 0 {
+			logging.Errorf("%s http.forward-proxy.max-response-headers cannot be negative (%d).", errorPrefix, cfg.HTTP.ForwardProxy.MaxResponseHeaders)
+			isValid = false
+		}
+		if _, err := cfg.HTTP.ForwardProxy.GetMaxResponseHeaderSize(); err != nil {
+			logging.Errorf("%s %v.", errorPrefix, err)
+			isValid = false
+		}
+		if maxBody, err := cfg.HTTP.ForwardProxy.GetMaxResponseSize(); err != nil {
+			logging.Errorf("%s %v.", errorPrefix, err)
+			isValid = false
+		} else if maxObject, err := cfg.HTTP.ForwardProxy.Cache.GetMaxObjectSize(); err == nil && maxBody > 0 && (maxObject == 0 || maxObject > maxBody) {
+			logging.Warnf("http.forward-proxy.cache.max-object-size is above max-response-size, responses between the two are refused rather than cached.")
+		}
+		if _, err := cfg.HTTP.ForwardProxy.TLS.LoadCAPool(); err != nil {
+			logging.Errorf("%s %v.", errorPrefix, err)
+			isValid = false
+		}
+		if _, err := ParseTLSVersion(cfg.HTTP.ForwardProxy.TLS.MinVersion); err != nil {
+			logging.Errorf("%s Invalid http.forward-proxy.tls.min-version: %v.", errorPrefix, err)
+			isValid = false
+		}
+		if tlsCfg := cfg.HTTP.ForwardProxy.TLS; tlsCfg.InsecureSkipVerify {
+			if len(tlsCfg.Domains) == 0 {
+				logging.Errorf("%s http.forward-proxy.tls.insecure-skip-verify needs tls.domains listing the origins it applies to, it won't turn off verification for every origin.", errorPrefix)
+				isValid = false
+			} else {
+				logging.Warnf("http.forward-proxy.tls.insecure-skip-verify is enabled, origin certificates are NOT verified for: %v", tlsCfg.Domains)
+			}
+		}
+	}
+
 	// Validate Proxy Cache Settings
 	if cfg.HTTP.ForwardProxy.Enabled && cfg.HTTP.ForwardProxy.Cache.Enabled {
-		if cfg.HTTP.ForwardProxy.Cache.CacheDir == "" {
-			log.Printf("%s http.forward-proxy.cache.enabled is true, but cache-dir is not set.", errorPrefix)
+		if len(cfg.HTTP.ForwardProxy.Cache.GetCacheDirs()) == 0 {
+			logging.Errorf("%s http.forward-proxy.cache.enabled is true, but cache-dir is not set.", errorPrefix)
 			isValid = false // Make this an error
 		}
+		for i, ext := range cfg.HTTP.ForwardProxy.Cache.ExcludeExts {
+			if trimmed := strings.TrimPrefix(ext, "."); trimmed == "" || strings.ContainsAny(trimmed, "./") {
+				logging.Errorf("%s http.forward-proxy.cache.exclude-extensions[%d] ('%s') must be a single extension like \".php\".", errorPrefix, i, ext)
+				isValid = false
+			}
+		}
+		if cache := cfg.HTTP.ForwardProxy.Cache; len(cache.CacheDirs) > 0 {
+			if cache.CacheDir != "" {
+				logging.Warnf("http.forward-proxy.cache.cache-dirs is set, cache-dir ('%s') is ignored.", cache.CacheDir)
+			}
+			seen := make(map[string]bool)
+			for i, dir := range cache.CacheDirs {
+				clean := filepath.Clean(dir)
+				if dir == "" || seen[clean] {
+					logging.Errorf("%s http.forward-proxy.cache.cache-dirs[%d] ('%s') is empty or listed twice.", errorPrefix, i, dir)
+					isValid = false
+				}
+				seen[clean] = true
+			}
+		}
 		if _, err := cfg.HTTP.ForwardProxy.Cache.GetCacheTTL(); err != nil {
-			log.Printf("%s Invalid format for http.forward-proxy.cache.cache-ttl ('%s'): %v.", errorPrefix, cfg.HTTP.ForwardProxy.Cache.CacheTTL, err)
+			logging.Errorf("%s Invalid format for http.forward-proxy.cache.cache-ttl ('%s'): %v.", errorPrefix, cfg.HTTP.ForwardProxy.Cache.CacheTTL, err)
 			isValid = false // Make this an error
 		}
+		if _, err := cfg.HTTP.ForwardProxy.Cache.GetMinObjectSize(); err != nil {
+			logging.Errorf("%s Invalid format for http.forward-proxy.cache.min-object-size ('%s'): %v.", errorPrefix, cfg.HTTP.ForwardProxy.Cache.MinObjectSize, err)
+			isValid = false
+		}
+		if _, err := cfg.HTTP.ForwardProxy.Cache.GetMaxObjectSize(); err != nil {
+			logging.Errorf("%s %v.", errorPrefix, err)
+			isValid = false
+		}
+		if _, err := cfg.HTTP.ForwardProxy.Cache.GetDomainTTLs(); err != nil {
+			logging.Errorf("%s %v.", errorPrefix, err)
+			isValid = false
+		}
+		if _, err := cfg.HTTP.ForwardProxy.Cache.GetDomainQuotas(); err != nil {
+			logging.Errorf("%s %v.", errorPrefix, err)
+			isValid = false
+		}
+		if _, err := cfg.HTTP.ForwardProxy.Cache.GetMaxSize(); err != nil {
+			logging.Errorf("%s %v.", errorPrefix, err)
+			isValid = false
+		}
+		if negTTL, err := cfg.HTTP.ForwardProxy.Cache.GetNegativeTTL(); err != nil {
+			logging.Errorf("%s %v.", errorPrefix, err)
+			isValid = false
+		} else if ttl, err := cfg.HTTP.ForwardProxy.Cache.GetCacheTTL(); err == nil && negTTL > ttl {
+			logging.Warnf("http.forward-proxy.cache.negative-ttl (%s) is longer than cache-ttl (%s).", negTTL, ttl)
+		}
+		sh := cfg.HTTP.ForwardProxy.Cache.StatusHeader
+		if strings.ContainsAny(sh.Name, " \t\r\n:") {
+			logging.Errorf("%s http.forward-proxy.cache.status-header.name ('%s') is not a valid header name.", errorPrefix, sh.Name)
+			isValid = false
+		}
+		if strings.ContainsAny(sh.Hit+sh.Miss+sh.Bypass, "\r\n") {
+			logging.Errorf("%s http.forward-proxy.cache.status-header values must not contain line breaks.", errorPrefix)
+			isValid = false
+		}
+		if h := cfg.HTTP.ForwardProxy.Cache.TTLHeader; strings.ContainsAny(h, " \t\r\n:") {
+			logging.Errorf("%s http.forward-proxy.cache.ttl-header ('%s') is not a valid header name.", errorPrefix, h)
+			isValid = false
+		}
+		for i, status := range cfg.HTTP.ForwardProxy.Cache.NegativeStatuses {
+			if status != http.StatusNotFound && status != http.StatusGone {
+				logging.Errorf("%s http.forward-proxy.cache.negative-statuses[%d] must be 404 or 410, got %d.", errorPrefix, i, status)
+				isValid = false
+			}
+		}
+		if ra := cfg.HTTP.ForwardProxy.Cache.RefreshAhead; ra.Enabled {
+			window, errW := ra.GetWindow()
+			_, errI := ra.GetInterval()
+			if err := errors.Join(errW, errI); err != nil {
+				logging.Errorf("%s %v.", errorPrefix, err)
+				isValid = false
+			} else if ttl, err := cfg.HTTP.ForwardProxy.Cache.GetCacheTTL(); err == nil && window >= ttl {
+				logging.Errorf("%s http.forward-proxy.cache.refresh-ahead.window (%s) must be shorter than cache-ttl (%s).", errorPrefix, window, ttl)
+				isValid = false
+			}
+			if ra.MinHits < 1 {
+				logging.Errorf("%s http.forward-proxy.cache.refresh-ahead.min-hits must be at least 1, got %d.", errorPrefix, ra.MinHits)
+				isValid = false
+			}
+		}
 	}
 	// Validate Cleanup Interval (only relevant if proxy caching is enabled)
-	if cfg.HTTP.ForwardProxy.Enabled && cfg.HTTP.ForwardProxy.Cache.Enabled && cfg.HTTP.ForwardProxy.Cache.CacheDir != "" {
+	if cfg.HTTP.ForwardProxy.Enabled && cfg.HTTP.ForwardProxy.Cache.Enabled && len(cfg.HTTP.ForwardProxy.Cache.GetCacheDirs()) > 0 {
 		if _, err := cfg.ProxyCacheCleanup.GetInterval(); err != nil {
-			log.Printf("%s Invalid format for proxy-cache-cleanup.interval ('%s'): %v.", errorPrefix, cfg.ProxyCacheCleanup.Interval, err)
+			logging.Errorf("%s Invalid format for proxy-cache-cleanup.interval ('%s'): %v.", errorPrefix, cfg.ProxyCacheCleanup.Interval, err)
 			isValid = false // Make this an error
 		}
+		if _, err := cfg.GetStaleRetention(); err != nil {
+			logging.Errorf("%s %v.", errorPrefix, err)
+			isValid = false
+		}
+		if _, err := cfg.ProxyCacheCleanup.GetMaxSize(); err != nil {
+			logging.Errorf("%s %v.", errorPrefix, err)
+			isValid = false
+		}
+	}
+
+	// Listing templates are parsed at startup, a missing file would silently fall back
+	if cfg.HTTP.Static.Enabled {
+		templates := map[string]string{"http.static.listing-template": cfg.HTTP.Static.ListingTemplate}
+		for key, dirCfg := range cfg.HTTP.Static.Dirs {
+			templates["http.static.dirs."+key+".listing-template"] = dirCfg.ListingTemplate
+			templates["http.static.dirs."+key+".missing-index-page"] = dirCfg.MissingIndexPage
+			if status := dirCfg.MissingIndexStatus; status != 0 && status != http.StatusForbidden && status != http.StatusNotFound {
+				logging.Errorf("%s http.static.dirs.%s.missing-index-status must be 403 or 404, got %d", errorPrefix, key, status)
+				isValid = false
+			}
+			switch dirCfg.Source {
+			case "", StaticSourceDisk:
+			case StaticSourceEmbedded:
+				if dirCfg.Bundle == "" {
+					logging.Errorf("%s http.static.dirs.%s uses the embedded source but sets no bundle", errorPrefix, key)
+					isValid = false
+				}
+			default:
+				logging.Errorf("%s Invalid http.static.dirs.%s.source ('%s'), expected %s or %s.", errorPrefix, key, dirCfg.Source, StaticSourceDisk, StaticSourceEmbedded)
+				isValid = false
+			}
+			if auth := dirCfg.BasicAuth; auth != nil {
+				if len(auth.Users) == 0 {
+					logging.Errorf("%s http.static.dirs.%s.basic-auth has no users, nobody could read the directory.", errorPrefix, key)
+					isValid = false
+				}
+				for _, problem := range authProblems("http.static.dirs."+key+".basic-auth", auth.Realm, auth.Users) {
+					logging.Errorf("%s %s", errorPrefix, problem)
+					isValid = false
+				}
+			}
+			if index := dirCfg.Index; index != "" && (index == "." || index == ".." || strings.ContainsAny(index, `/\`)) {
+				logging.Errorf("%s http.static.dirs.%s.index must be a file name, got '%s'", errorPrefix, key, index)
+				isValid = false
+			}
+			if !dirCfg.DisableListing && (dirCfg.MissingIndexStatus != 0 || dirCfg.MissingIndexPage != "") {
+				logging.Warnf("http.static.dirs.%s sets a missing-index response but disable-listing is false, it is not used.", key)
+			}
+		}
+		for key, file := range templates {
+			if file == "" {
+				continue
+			}
+			if _, err := os.Stat(file); err != nil {
+				logging.Errorf("%s %s '%s' is not accessible: %v", errorPrefix, key, file, err)
+				isValid = false
+			}
+		}
 	}
 
 	// Validate Static Dirs Exist? Optional, might be annoying if dirs are created later.
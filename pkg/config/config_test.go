@@ -0,0 +1,147 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// The same configuration in each supported format.
+var sameConfig = map[string]string{
+	"config.yaml": `
+log:
+  level: warn
+http:
+  addr: 127.0.0.1
+  port: 3128
+  timeouts:
+    read: 45s
+  routes:
+    - prefix: /static/legacy/
+      handler: proxy
+  forward-proxy:
+    enabled: true
+    domains: ["*.example.com", "static.example.org"]
+    max-conns-per-host: 8
+    cache:
+      enabled: true
+      cache-dir: /var/cache/admin-bot
+      cache-ttl: 2d
+proxy-cache-cleanup:
+  interval: 30m
+`,
+	"config.json": `{
+  "log": {"level": "warn"},
+  "http": {
+    "addr": "127.0.0.1",
+    "port": 3128,
+    "timeouts": {"read": "45s"},
+    "routes": [{"prefix": "/static/legacy/", "handler": "proxy"}],
+    "forward-proxy": {
+      "enabled": true,
+      "domains": ["*.example.com", "static.example.org"],
+      "max-conns-per-host": 8,
+      "cache": {"enabled": true, "cache-dir": "/var/cache/admin-bot", "cache-ttl": "2d"}
+    }
+  },
+  "proxy-cache-cleanup": {"interval": "30m"}
+}`,
+	"config.toml": `
+[log]
+level = "warn"
+
+[http]
+addr = "127.0.0.1"
+port = 3128
+
+[http.timeouts]
+read = "45s"
+
+[[http.routes]]
+prefix = "/static/legacy/"
+handler = "proxy"
+
+[http.forward-proxy]
+enabled = true
+domains = ["*.example.com", "static.example.org"]
+max-conns-per-host = 8
+
+[http.forward-proxy.cache]
+enabled = true
+cache-dir = "/var/cache/admin-bot"
+cache-ttl = "2d"
+
+[proxy-cache-cleanup]
+interval = "30m"
+`,
+}
+
+func TestConfigFormatsLoadAlike(t *testing.T) {
+	dir := t.TempDir()
+	loaded := make(map[string]*Config)
+	for name, content := range sameConfig {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := ReadConfigFile(path)
+		if err != nil {
+			t.Fatalf("loading %s: %v", name, err)
+		}
+		loaded[name] = cfg
+	}
+
+	want := loaded["config.yaml"]
+	if want.HTTP.Port != 3128 || want.HTTP.ForwardProxy.MaxConnsPerHost != 8 || want.HTTP.ForwardProxy.Cache.CacheTTL != "2d" {
+		t.Fatalf("config.yaml wasn't loaded as written: %+v", want.HTTP)
+	}
+	for _, name := range []string{"config.json", "config.toml"} {
+		if !reflect.DeepEqual(loaded[name], want) {
+			t.Errorf("%s loads differently from config.yaml:\n got %+v\nwant %+v", name, *loaded[name], *want)
+		}
+	}
+}
+
+func TestEnvOverridesKeysWithoutDefault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("http:\n  port: 3128\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ADMINBOT_HTTP_FORWARD_PROXY_CACHE_CACHE_DIR", "/srv/cache")
+	t.Setenv("ADMINBOT_HTTP_FORWARD_PROXY_DOMAINS", "*.example.com,static.example.org")
+	t.Setenv("ADMINBOT_HTTP_PORT", "9090")
+
+	cfg, err := ReadConfigFile(path)
+	if err != nil {
+		t.Fatalf("ReadConfigFile: %v", err)
+	}
+	if got := cfg.HTTP.ForwardProxy.Cache.CacheDir; got != "/srv/cache" {
+		t.Errorf("cache-dir = %q, want /srv/cache from the environment", got)
+	}
+	if got, want := cfg.HTTP.ForwardProxy.Domains, []string{"*.example.com", "static.example.org"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("domains = %q, want %q", got, want)
+	}
+	if cfg.HTTP.Port != 9090 {
+		t.Errorf("port = %d, want 9090 from the environment over the file", cfg.HTTP.Port)
+	}
+}
+
+func TestInsecureSkipVerifyNeedsDomains(t *testing.T) {
+	for _, tt := range []struct {
+		domains string
+		wantErr bool
+	}{
+		{"", true},
+		{"\n      domains: [\"*.corp.example\"]", false},
+	} {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		content := "http:\n  forward-proxy:\n    enabled: true\n    tls:\n      insecure-skip-verify: true" + tt.domains + "\n"
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ValidateConfigFile(path); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateConfigFile with insecure-skip-verify and domains %q: err %v, want error %v", tt.domains, err, tt.wantErr)
+		}
+	}
+}
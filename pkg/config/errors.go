@@ -0,0 +1,54 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors for matching error kinds with errors.Is.
+var (
+	ErrNotFound   = errors.New("config file not found")
+	ErrParse      = errors.New("config file could not be read or parsed")
+	ErrValidation = errors.New("configuration validation failed")
+)
+
+// NotFoundError reports that the config file does not exist.
+type NotFoundError struct {
+	Path string
+	Err  error
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("config file not found at %s: %v", e.Path, e.Err)
+}
+
+func (e *NotFoundError) Unwrap() error        { return e.Err }
+func (e *NotFoundError) Is(target error) bool { return target == ErrNotFound }
+
+// ParseError reports a config file that exists but could not be read or decoded.
+type ParseError struct {
+	Path string
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("failed to read/parse config file %s: %v", e.Path, e.Err)
+}
+
+func (e *ParseError) Unwrap() error        { return e.Err }
+func (e *ParseError) Is(target error) bool { return target == ErrParse }
+
+// ValidationError reports a config that was parsed but failed validation.
+// Details are logged by validateConfig as they are found.
+type ValidationError struct {
+	Path string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return "configuration validation failed (see warnings/errors above)"
+	}
+	return fmt.Sprintf("configuration validation failed for %s (see warnings/errors above)", e.Path)
+}
+
+func (e *ValidationError) Is(target error) bool { return target == ErrValidation }
@@ -1,12 +1,21 @@
 package config
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
-	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
 	"strconv"
 	"strings"
 	"time"
 	"unicode"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // --- Helper Methods ---
@@ -24,11 +33,201 @@ func (c *CacheCfg) GetCacheTTL() (time.Duration, error) {
 	return d, nil
 }
 
+// GetNegativeTTL parses how long 404/410 responses are cached, 0 meaning never.
+func (c *CacheCfg) GetNegativeTTL() (time.Duration, error) {
+	return parseTimeout("forward-proxy.cache.negative-ttl", c.NegativeTTL, "0")
+}
+
+// GetMinObjectSize parses the minimum cacheable response size in bytes.
+// An empty value means no minimum.
+func (c *CacheCfg) GetMinObjectSize() (int64, error) {
+	if c.MinObjectSize == "" {
+		return 0, nil
+	}
+	n, err := StrToBytes(c.MinObjectSize)
+	if err != nil {
+		return 0, fmt.Errorf("invalid forward-proxy.cache.min-object-size '%s': %w", c.MinObjectSize, err)
+	}
+	return n, nil
+}
+
+// GetMaxObjectSize parses the largest response size the cache will buffer and
+// store, in bytes. Zero means no limit.
+func (c *CacheCfg) GetMaxObjectSize() (int64, error) {
+	sizeStr := c.MaxObjectSize
+	if sizeStr == "" {
+		sizeStr = "256MB" // Default if not set
+	}
+	if sizeStr == "0" {
+		return 0, nil
+	}
+	n, err := StrToBytes(sizeStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid forward-proxy.cache.max-object-size '%s': %w", sizeStr, err)
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("forward-proxy.cache.max-object-size '%s' must be positive", sizeStr)
+	}
+	return n, nil
+}
+
+// GetMaxSize parses the total cache size cap in bytes. Zero (or unset) means
+// the cache is only bounded by TTL and domain quotas.
+func (c *CacheCfg) GetMaxSize() (int64, error) {
+	if c.MaxSize == "" || c.MaxSize == "0" {
+		return 0, nil
+	}
+	n, err := StrToBytes(c.MaxSize)
+	if err != nil {
+		return 0, fmt.Errorf("invalid forward-proxy.cache.max-size '%s': %w", c.MaxSize, err)
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("forward-proxy.cache.max-size '%s' must be positive", c.MaxSize)
+	}
+	return n, nil
+}
+
+// GetDomainQuotas parses the per-domain cache quotas, keyed by lowercase host.
+func (c *CacheCfg) GetDomainQuotas() (map[string]int64, error) {
+	quotas := make(map[string]int64, len(c.DomainQuotas))
+	for _, q := range c.DomainQuotas {
+		if q.Domain == "" {
+			return nil, fmt.Errorf("forward-proxy.cache.domain-quotas entry is missing a domain")
+		}
+		n, err := StrToBytes(q.Size)
+		if err != nil {
+			return nil, fmt.Errorf("invalid forward-proxy.cache.domain-quotas entry for '%s': %w", q.Domain, err)
+		}
+		if n <= 0 {
+			return nil, fmt.Errorf("forward-proxy.cache.domain-quotas entry for '%s' must be positive", q.Domain)
+		}
+		quotas[strings.ToLower(q.Domain)] = n
+	}
+	return quotas, nil
+}
+
+// GetDomainTTLs parses the per-domain TTL overrides, keyed by lowercase host
+// or wildcard pattern.
+func (c *CacheCfg) GetDomainTTLs() (map[string]time.Duration, error) {
+	flat := make(map[string]any)
+	flattenKeys("", c.DomainTTLs, flat)
+	ttls := make(map[string]time.Duration, len(flat))
+	for domain, value := range flat {
+		ttlStr, ok := value.(string)
+		if !ok {
+			ttlStr = fmt.Sprint(value) // e.g. a bare YAML number
+		}
+		d, err := StrToDuration(ttlStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid forward-proxy.cache.domain-ttls entry for '%s': %w", domain, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("forward-proxy.cache.domain-ttls entry for '%s' must be positive", domain)
+		}
+		ttls[strings.ToLower(domain)] = d
+	}
+	return ttls, nil
+}
+
+// flattenKeys joins the nested maps viper makes of dotted keys
+// ("example.com" -> example: {com: ...}) back into dotted keys in out.
+func flattenKeys(prefix string, m map[string]any, out map[string]any) {
+	for k, v := range m {
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+		if nested, ok := v.(map[string]any); ok {
+			flattenKeys(k, nested, out)
+			continue
+		}
+		out[k] = v
+	}
+}
+
+// GetWindow parses how long before expiry a hot entry is refreshed.
+func (c *RefreshAheadConfig) GetWindow() (time.Duration, error) {
+	return parsePositiveDuration("forward-proxy.cache.refresh-ahead.window", c.Window, "10m")
+}
+
+// GetInterval parses how often the refresher scans for entries to refresh.
+func (c *RefreshAheadConfig) GetInterval() (time.Duration, error) {
+	return parsePositiveDuration("forward-proxy.cache.refresh-ahead.interval", c.Interval, "1m")
+}
+
+// GetStaleRetention returns how long expired cache entries stay on disk
+// before the cleaner deletes them: proxy-cache-cleanup.ttl minus cache-ttl,
+// 0 when the cleanup TTL is unset.
+func (c *Config) GetStaleRetention() (time.Duration, error) {
+	if c.ProxyCacheCleanup.TTL == "" {
+		return 0, nil
+	}
+	cleanupTTL, err := parsePositiveDuration("proxy-cache-cleanup.ttl", c.ProxyCacheCleanup.TTL, "")
+	if err != nil {
+		return 0, err
+	}
+	cacheTTL, err := c.HTTP.ForwardProxy.Cache.GetCacheTTL()
+	if err != nil {
+		return 0, err
+	}
+	if cleanupTTL < cacheTTL {
+		return 0, fmt.Errorf("proxy-cache-cleanup.ttl '%s' is shorter than cache-ttl (%s)", c.ProxyCacheCleanup.TTL, cacheTTL)
+	}
+	return cleanupTTL - cacheTTL, nil
+}
+
+// GetTimeout parses how long the startup self-test may take.
+func (c *SelfTestConfig) GetTimeout() (time.Duration, error) {
+	return parsePositiveDuration("forward-proxy.self-test.timeout", c.Timeout, "10s")
+}
+
+// SelfTestURL returns the URL the startup self-test fetches: the configured
+// one, else the root of the first cache domain that isn't a wildcard.
+// Empty when there is nothing to test against.
+func (c *ProxyConfig) SelfTestURL() string {
+	if c.SelfTest.URL != "" {
+		return c.SelfTest.URL
+	}
+	for _, domain := range c.Domains {
+		if !strings.HasPrefix(domain, "*.") && !strings.HasPrefix(domain, ".") {
+			return "http://" + domain + "/"
+		}
+	}
+	return ""
+}
+
+// parsePositiveDuration parses a duration setting that must be greater than zero,
+// using fallback when it's unset.
+func parsePositiveDuration(name, value, fallback string) (time.Duration, error) {
+	if value == "" {
+		value = fallback
+	}
+	d, err := StrToDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s '%s': %w", name, value, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s '%s' must be positive", name, value)
+	}
+	return d, nil
+}
+
 // GetCacheDir returns the cache directory.
 func (c *CacheCfg) GetCacheDir() string {
 	return c.CacheDir
 }
 
+// GetCacheDirs returns the directories cache entries are spread over:
+// cache-dirs when set, otherwise just cache-dir. Empty when neither is set.
+func (c *CacheCfg) GetCacheDirs() []string {
+	if len(c.CacheDirs) > 0 {
+		return c.CacheDirs
+	}
+	if c.CacheDir != "" {
+		return []string{c.CacheDir}
+	}
+	return nil
+}
+
 // GetInterval parses the cleanup interval string.
 func (c *CacheCleanupConfig) GetInterval() (time.Duration, error) {
 	intervalStr := c.Interval
@@ -41,27 +240,354 @@ func (c *CacheCleanupConfig) GetInterval() (time.Duration, error) {
 	}
 	if d <= 0 { // Ensure interval is positive
 		// Return default and log warning instead of error?
-		log.Printf("WARN: proxy-cache-cleanup interval '%s' is not positive, using default 1h", intervalStr)
+		logging.Warnf("proxy-cache-cleanup interval '%s' is not positive, using default 1h", intervalStr)
 		return time.Hour, nil
 	}
 	return d, nil
 }
 
+// GetMaxSize returns proxy-cache-cleanup.max-size in bytes, 0 when unset (no cap).
+func (c *CacheCleanupConfig) GetMaxSize() (int64, error) {
+	if c.MaxSize == "" || c.MaxSize == "0" {
+		return 0, nil
+	}
+	n, err := StrToBytes(c.MaxSize)
+	if err != nil {
+		return 0, fmt.Errorf("invalid proxy-cache-cleanup.max-size '%s': %w", c.MaxSize, err)
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("proxy-cache-cleanup.max-size '%s' must be positive", c.MaxSize)
+	}
+	return n, nil
+}
+
+// GetReadHeader parses the request header read timeout.
+func (t *TimeoutsConfig) GetReadHeader() (time.Duration, error) {
+	return parseTimeout("http.timeouts.read-header", t.ReadHeader, "10s")
+}
+
+// GetRead parses the full request read timeout.
+func (t *TimeoutsConfig) GetRead() (time.Duration, error) {
+	return parseTimeout("http.timeouts.read", t.Read, "30s")
+}
+
+// GetWrite parses the response write timeout.
+func (t *TimeoutsConfig) GetWrite() (time.Duration, error) {
+	return parseTimeout("http.timeouts.write", t.Write, "60s")
+}
+
+// GetIdle parses the keep-alive idle timeout.
+func (t *TimeoutsConfig) GetIdle() (time.Duration, error) {
+	return parseTimeout("http.timeouts.idle", t.Idle, "120s")
+}
+
+// parseTimeout parses a server timeout, using fallback when unset. Zero is
+// allowed and disables the timeout.
+func parseTimeout(name, value, fallback string) (time.Duration, error) {
+	if value == "" {
+		value = fallback
+	}
+	d, err := StrToDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s '%s': %w", name, value, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%s '%s' must not be negative", name, value)
+	}
+	return d, nil
+}
+
+// GetConnect parses the outbound connect timeout.
+func (t *UpstreamTimeoutsConfig) GetConnect() (time.Duration, error) {
+	return parseTimeout("forward-proxy.timeouts.connect", t.Connect, "30s")
+}
+
+// GetTLSHandshake parses the outbound TLS handshake timeout.
+func (t *UpstreamTimeoutsConfig) GetTLSHandshake() (time.Duration, error) {
+	return parseTimeout("forward-proxy.timeouts.tls-handshake", t.TLSHandshake, "10s")
+}
+
+// GetResponseHeader parses how long to wait for an origin's response headers.
+func (t *UpstreamTimeoutsConfig) GetResponseHeader() (time.Duration, error) {
+	return parseTimeout("forward-proxy.timeouts.response-header", t.ResponseHeader, "30s")
+}
+
+// GetRequest parses how long reading an origin body into the cache may take.
+func (t *UpstreamTimeoutsConfig) GetRequest() (time.Duration, error) {
+	return parseTimeout("forward-proxy.timeouts.request", t.Request, "30s")
+}
+
+// GetIdleConn parses how long idle pooled origin connections are kept.
+func (t *UpstreamTimeoutsConfig) GetIdleConn() (time.Duration, error) {
+	return parseTimeout("forward-proxy.timeouts.idle-conn", t.IdleConn, "90s")
+}
+
+// GetListeners returns the configured listeners. Without an explicit
+// listeners list, a single listener on addr:port serves every feature.
+func (c *HTTPConfig) GetListeners() []ListenerConfig {
+	if len(c.Listeners) > 0 {
+		return c.Listeners
+	}
+	return []ListenerConfig{{Addr: c.Addr, Port: c.Port, TLS: c.TLS.Enabled}}
+}
+
+// Address returns the host:port string the listener binds to.
+func (l ListenerConfig) Address() string {
+	return net.JoinHostPort(l.Addr, strconv.Itoa(l.Port))
+}
+
+// ServesFeature reports whether the listener exposes the named feature.
+func (l ListenerConfig) ServesFeature(feature string) bool {
+	if len(l.Serves) == 0 {
+		return true // No explicit list means everything
+	}
+	for _, f := range l.Serves {
+		if strings.EqualFold(strings.TrimSpace(f), feature) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetIndex returns the index file name of the directory, index.html unless
+// configured otherwise.
+func (d *StaticDirConfig) GetIndex() string {
+	if d.Index == "" {
+		return "index.html"
+	}
+	return d.Index
+}
+
+// GetMissingIndexStatus returns the status for index-less directories when
+// listing is disabled, 404 unless configured otherwise.
+func (d *StaticDirConfig) GetMissingIndexStatus() int {
+	if d.MissingIndexStatus == 0 {
+		return http.StatusNotFound
+	}
+	return d.MissingIndexStatus
+}
+
+// GetMinSize parses the smallest response size worth compressing, in bytes.
+func (c *CompressionConfig) GetMinSize() (int64, error) {
+	if c.MinSize == "" || c.MinSize == "0" {
+		return 0, nil
+	}
+	n, err := StrToBytes(c.MinSize)
+	if err != nil {
+		return 0, fmt.Errorf("invalid http.compression.min-size '%s': %w", c.MinSize, err)
+	}
+	return n, nil
+}
+
+// GetOutput returns where the access log is written, stdout by default.
+func (a *AccessLogConfig) GetOutput() string {
+	if a.Output == "" {
+		return AccessLogStdout
+	}
+	return a.Output
+}
+
+// GetListenTimeout parses the server's listen confirmation timeout string.
+func (c *HTTPConfig) GetListenTimeout() (time.Duration, error) {
+	timeoutStr := c.ListenTimeout
+	if timeoutStr == "" {
+		timeoutStr = "5s" // Default if not set
+	}
+	d, err := StrToDuration(timeoutStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid http.listen-timeout '%s': %w", timeoutStr, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("http.listen-timeout '%s' must be positive", timeoutStr)
+	}
+	return d, nil
+}
+
+// GetShutdownTimeout parses how long a stopping server waits for in-flight
+// requests to finish.
+func (c *HTTPConfig) GetShutdownTimeout() (time.Duration, error) {
+	timeoutStr := c.ShutdownTimeout
+	if timeoutStr == "" {
+		timeoutStr = "15s" // Default if not set
+	}
+	d, err := StrToDuration(timeoutStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid http.shutdown-timeout '%s': %w", timeoutStr, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("http.shutdown-timeout '%s' must be positive", timeoutStr)
+	}
+	return d, nil
+}
+
+// GetSourceIP resolves the outbound source address, which may be an IP
+// or a network interface name. Returns nil if no source address is set.
+func (p *ProxyConfig) GetSourceIP() (net.IP, error) {
+	if p.SourceAddr == "" {
+		return nil, nil
+	}
+	if ip := net.ParseIP(p.SourceAddr); ip != nil {
+		return ip, nil
+	}
+	iface, err := net.InterfaceByName(p.SourceAddr)
+	if err != nil {
+		return nil, fmt.Errorf("forward-proxy.source-addr '%s' is neither an IP nor a known interface: %w", p.SourceAddr, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list addresses of interface '%s': %w", p.SourceAddr, err)
+	}
+	var fallback net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			return ipNet.IP, nil // Prefer IPv4
+		}
+		if fallback == nil {
+			fallback = ipNet.IP
+		}
+	}
+	if fallback == nil {
+		return nil, fmt.Errorf("interface '%s' has no IP addresses", p.SourceAddr)
+	}
+	return fallback, nil
+}
+
+// GetConnQueueTimeout parses how long a fetch may wait for a per-host slot.
+// Zero means saturated origins are refused immediately.
+func (p *ProxyConfig) GetConnQueueTimeout() (time.Duration, error) {
+	timeoutStr := p.ConnQueueTimeout
+	if timeoutStr == "" {
+		timeoutStr = "10s" // Default if not set
+	}
+	d, err := StrToDuration(timeoutStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid forward-proxy.conn-queue-timeout '%s': %w", timeoutStr, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("forward-proxy.conn-queue-timeout '%s' must not be negative", timeoutStr)
+	}
+	return d, nil
+}
+
+// GetTunnelIdleTimeout parses how long a CONNECT tunnel may go without bytes
+// flowing in either direction. Zero (or unset) means tunnels never time out.
+func (p *ProxyConfig) GetTunnelIdleTimeout() (time.Duration, error) {
+	timeoutStr := p.TunnelIdleTimeout
+	if timeoutStr == "" {
+		timeoutStr = "0" // Default if not set
+	}
+	d, err := StrToDuration(timeoutStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid forward-proxy.tunnel-idle-timeout '%s': %w", timeoutStr, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("forward-proxy.tunnel-idle-timeout '%s' must not be negative", timeoutStr)
+	}
+	return d, nil
+}
+
+// GetMaxResponseSize parses the largest origin response body the proxy relays,
+// in bytes. Zero (or unset) means no limit.
+func (p *ProxyConfig) GetMaxResponseSize() (int64, error) {
+	if p.MaxResponseSize == "" || p.MaxResponseSize == "0" {
+		return 0, nil
+	}
+	n, err := StrToBytes(p.MaxResponseSize)
+	if err != nil {
+		return 0, fmt.Errorf("invalid forward-proxy.max-response-size '%s': %w", p.MaxResponseSize, err)
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("forward-proxy.max-response-size '%s' must be positive", p.MaxResponseSize)
+	}
+	return n, nil
+}
+
+// GetMaxResponseHeaderSize parses the origin response header size limit in bytes.
+func (p *ProxyConfig) GetMaxResponseHeaderSize() (int64, error) {
+	sizeStr := p.MaxResponseHeaderSize
+	if sizeStr == "" {
+		sizeStr = "1MB" // Default if not set
+	}
+	n, err := StrToBytes(sizeStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid forward-proxy.max-response-header-size '%s': %w", sizeStr, err)
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("forward-proxy.max-response-header-size '%s' must be positive", sizeStr)
+	}
+	return n, nil
+}
+
+// AppliesTo reports whether the upstream TLS overrides apply to host
+// ("host", "host:port" or "[ipv6]:port"). Domains take the same patterns as
+// MatchHost; an empty list applies them to every origin.
+func (t *UpstreamTLSConfig) AppliesTo(host string) bool {
+	if len(t.Domains) == 0 {
+		return true
+	}
+	for _, pattern := range t.Domains {
+		if MatchHost(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadCAPool returns the system cert pool extended with the configured CA file.
+// Returns nil (use system defaults) when no CA file is configured.
+func (t *UpstreamTLSConfig) LoadCAPool() (*x509.CertPool, error) {
+	if t.CAFile == "" {
+		return nil, nil
+	}
+	pemData, err := os.ReadFile(t.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read forward-proxy.tls.ca-file '%s': %w", t.CAFile, err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool() // System pool unavailable, trust only the bundle
+	}
+	if !pool.AppendCertsFromPEM(pemData) {
+		return nil, fmt.Errorf("forward-proxy.tls.ca-file '%s' contains no valid PEM certificates", t.CAFile)
+	}
+	return pool, nil
+}
+
+// ParseTLSVersion converts a version string like "1.2" into a crypto/tls constant.
+// An empty string returns 0, meaning Go's default minimum.
+func ParseTLSVersion(version string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(strings.TrimSpace(version)), "tls") {
+	case "":
+		return 0, nil
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS version '%s' (expected 1.0, 1.1, 1.2 or 1.3)", version)
+	}
+}
+
 // ShouldCacheDomain checks if a given host should be cached based on config.
-// Performs case-insensitive comparison.
+// Performs case-insensitive comparison; "*.example.com" and ".example.com"
+// entries match any subdomain, a bare "example.com" only itself.
 func (p *ProxyConfig) ShouldCacheDomain(host string) bool {
-	if !p.Cache.Enabled || p.Cache.CacheDir == "" {
+	if !p.Cache.Enabled || len(p.Cache.GetCacheDirs()) == 0 {
 		// log.Printf("DBG: ShouldCacheDomain(%s): Cache disabled globally or no cache dir.", host) // Optional Debug
 		return false
 	}
-	// Remove port if present (e.g., "example.com:80")
-	hostOnly := strings.Split(host, ":")[0]
-	hostLower := strings.ToLower(hostOnly)
-
+	// MatchHost drops the port (e.g. "example.com:80", "[2001:db8::1]:443")
 	for _, domain := range p.Domains {
-		domainLower := strings.ToLower(domain)
-		// log.Printf("DBG: ShouldCacheDomain(%s): Checking against configured domain '%s'", hostLower, domainLower) // Optional Debug
-		if domainLower == hostLower {
+		// log.Printf("DBG: ShouldCacheDomain(%s): Checking against configured domain '%s'", host, domain) // Optional Debug
+		if MatchHost(domain, host) {
 			// log.Printf("DBG: ShouldCacheDomain(%s): MATCH FOUND.", host) // Optional Debug
 			return true
 		}
@@ -70,6 +596,120 @@ func (p *ProxyConfig) ShouldCacheDomain(host string) bool {
 	return false
 }
 
+// ShouldCacheURL checks if a given request URL should be cached based on config.
+// It applies the domain check plus any URL-level exclusions (e.g. query strings).
+func (p *ProxyConfig) ShouldCacheURL(u *url.URL) bool {
+	if p.Cache.SkipQueryURLs && (u.RawQuery != "" || u.ForceQuery) {
+		// Query-bearing URLs are likely dynamic, never cache them
+		return false
+	}
+	if ext := path.Ext(u.Path); ext != "" {
+		for _, excluded := range p.Cache.ExcludeExts {
+			// Accept entries with or without the leading dot ("php" or ".php")
+			if strings.EqualFold(ext, "."+strings.TrimPrefix(excluded, ".")) {
+				return false
+			}
+		}
+	}
+	return p.ShouldCacheDomain(u.Host)
+}
+
+// PathCaseInsensitive reports whether host is listed in case-insensitive-paths,
+// i.e. its paths are lowercased in cache keys.
+func (c *CacheCfg) PathCaseInsensitive(host string) bool {
+	for _, pattern := range c.CaseInsensitivePaths {
+		if MatchHost(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// UpstreamHTTP2 reports whether fetches from host may use HTTP/2: http2 is on
+// and host isn't listed in http1-domains.
+func (p *ProxyConfig) UpstreamHTTP2(host string) bool {
+	if !p.HTTP2 {
+		return false
+	}
+	for _, pattern := range p.HTTP1Domains {
+		if MatchHost(pattern, host) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchHost reports whether host matches pattern, either an exact host or a
+// "*.example.com" (or ".example.com") wildcard matching any subdomain, but
+// not example.com itself.
+// Comparison ignores case, the port and a trailing dot.
+func MatchHost(pattern, host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(strings.Trim(host, "[]")), ".")
+	pattern = strings.TrimSuffix(strings.ToLower(pattern), ".")
+	suffix, ok := strings.CutPrefix(pattern, "*.")
+	if !ok {
+		suffix, ok = strings.CutPrefix(pattern, ".")
+	}
+	if ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
+
+// DestinationAllowed applies the allow and deny lists to an outbound host.
+// Deny wins over allow; an empty allow list allows everything not denied.
+func (p *ProxyConfig) DestinationAllowed(host string) bool {
+	for _, pattern := range p.Deny {
+		if MatchHost(pattern, host) {
+			return false
+		}
+	}
+	if len(p.Allow) == 0 {
+		return true
+	}
+	for _, pattern := range p.Allow {
+		if MatchHost(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// RewriteLocation applies the first matching location-rewrites rule to loc,
+// an absolute redirect target. Returns loc unchanged and false if none match.
+func (p *ProxyConfig) RewriteLocation(loc string) (string, bool) {
+	for _, rule := range p.LocationRewrites {
+		if rest, ok := strings.CutPrefix(loc, rule.From); ok {
+			return rule.To + rest, true
+		}
+	}
+	return loc, false
+}
+
+// GetRealm returns the Proxy-Authenticate realm, "admin-bot" when unset.
+func (a *ProxyAuthConfig) GetRealm() string {
+	if a.Realm == "" {
+		return "admin-bot"
+	}
+	return a.Realm
+}
+
+// PasswordHashBytes returns the user's bcrypt password hash, checking that it
+// parses. Unsalted "sha256:<hex>" hashes from older configs are refused.
+func (u *ProxyUser) PasswordHashBytes() ([]byte, error) {
+	if strings.HasPrefix(u.PasswordHash, "sha256:") {
+		return nil, fmt.Errorf("sha256 password hashes are no longer accepted, regenerate it as bcrypt (htpasswd -nbB user pass)")
+	}
+	hash := []byte(u.PasswordHash)
+	if _, err := bcrypt.Cost(hash); err != nil {
+		return nil, fmt.Errorf("password-hash is not a bcrypt hash (\"$2y$...\" from htpasswd -nbB user pass): %w", err)
+	}
+	return hash, nil
+}
+
 // --- Duration Parsing Helper (handles 'd' and 'w') ---
 
 // StrToDuration converts a string defining time period and return a time.Duration
@@ -138,3 +778,55 @@ func StrToDuration(durationStr string) (time.Duration, error) {
 		return d, nil
 	}
 }
+
+// --- Size Parsing Helper (handles KB/MB/GB/TB) ---
+
+// byteUnits maps size suffixes to their multiplier. Decimal and binary forms
+// are treated the same (1KB == 1KiB == 1024 bytes), matching common usage.
+var byteUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1 << 30,
+	"gib": 1 << 30,
+	"t":   1 << 40,
+	"tb":  1 << 40,
+	"tib": 1 << 40,
+}
+
+// StrToBytes converts a human readable size (e.g. "512", "10KB", "1.5GB") to bytes.
+func StrToBytes(sizeStr string) (int64, error) {
+	sizeStr = strings.TrimSpace(sizeStr)
+	if sizeStr == "" {
+		return 0, fmt.Errorf("empty size string")
+	}
+
+	splitIndex := len(sizeStr)
+	for i, r := range sizeStr {
+		if !unicode.IsDigit(r) && r != '.' {
+			splitIndex = i
+			break
+		}
+	}
+	numStr := sizeStr[:splitIndex]
+	unitStr := strings.ToLower(strings.TrimSpace(sizeStr[splitIndex:]))
+
+	multiplier, ok := byteUnits[unitStr]
+	if !ok {
+		return 0, fmt.Errorf("unknown size unit '%s' in '%s'", unitStr, sizeStr)
+	}
+	num, err := strconv.ParseFloat(numStr, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number '%s' in size '%s': %w", numStr, sizeStr, err)
+	}
+	if num < 0 {
+		return 0, fmt.Errorf("size '%s' cannot be negative", sizeStr)
+	}
+	return int64(num * float64(multiplier)), nil
+}
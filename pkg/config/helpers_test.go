@@ -0,0 +1,116 @@
+package config
+
+import "testing"
+
+func TestDestinationAllowed(t *testing.T) {
+	tests := []struct {
+		name  string
+		allow []string
+		deny  []string
+		host  string
+		want  bool
+	}{
+		{"empty lists allow all", nil, nil, "example.com:443", true},
+		{"star wildcard allows subdomain", []string{"*.example.com"}, nil, "api.example.com", true},
+		{"star wildcard allows nested subdomain", []string{"*.example.com"}, nil, "a.b.example.com:8080", true},
+		{"star wildcard excludes apex", []string{"*.example.com"}, nil, "example.com", false},
+		{"dot wildcard allows subdomain", []string{".example.com"}, nil, "api.example.com", true},
+		{"dot wildcard excludes apex", []string{".example.com"}, nil, "example.com", false},
+		{"bare host allows itself", []string{"example.com"}, nil, "example.com:80", true},
+		{"bare host excludes subdomain", []string{"example.com"}, nil, "api.example.com", false},
+		{"host outside allow list", []string{"example.com"}, nil, "other.org", false},
+		{"deny only blocks listed", nil, []string{"*.internal"}, "db.internal", false},
+		{"deny only lets others through", nil, []string{"*.internal"}, "example.com", true},
+		{"deny wins over exact allow", []string{"db.internal"}, []string{"db.internal"}, "db.internal", false},
+		{"deny wildcard wins over allow wildcard", []string{"*.example.com"}, []string{"*.corp.example.com"}, "git.corp.example.com", false},
+		{"allow wildcard outside deny", []string{"*.example.com"}, []string{"*.corp.example.com"}, "www.example.com", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ProxyConfig{Allow: tt.allow, Deny: tt.deny}
+			if got := p.DestinationAllowed(tt.host); got != tt.want {
+				t.Errorf("DestinationAllowed(%q) with allow %v, deny %v = %v, want %v", tt.host, tt.allow, tt.deny, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchHost(t *testing.T) {
+	tests := []struct {
+		pattern string
+		host    string
+		want    bool
+	}{
+		{"*.example.com", "cdn.example.com", true},
+		{"*.example.com", "a.cdn.example.com", true},
+		{"*.example.com", "example.com", false},
+		{".example.com", "cdn.example.com", true},
+		{".example.com", "example.com", false},
+		{"example.com", "example.com", true},
+		{"example.com", "notexample.com", false},
+		{"*.example.com", "notexample.com", false},
+		{"example.com", "cdn.example.com", false},
+		{"Example.COM", "example.com", true},
+		{"*.example.com", "CDN.Example.Com", true},
+		{"example.com", "EXAMPLE.COM:8080", true},
+		{"example.com", "example.com.", true},
+		{"::1", "[::1]:443", true},
+	}
+	for _, tt := range tests {
+		if got := MatchHost(tt.pattern, tt.host); got != tt.want {
+			t.Errorf("MatchHost(%q, %q) = %v, want %v", tt.pattern, tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestShouldCacheDomain(t *testing.T) {
+	p := &ProxyConfig{
+		Cache:   CacheCfg{Enabled: true, CacheDir: "/tmp/cache"},
+		Domains: []string{"*.example.com", "static.example.org", "2001:db8::1"},
+	}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"cdn.example.com", true},
+		{"CDN.Example.com:443", true},
+		{"example.com", false},
+		{"notexample.com", false},
+		{"static.example.org:80", true},
+		{"STATIC.EXAMPLE.ORG", true},
+		{"www.static.example.org", false},
+		{"[2001:db8::1]:443", true},
+	}
+	for _, tt := range tests {
+		if got := p.ShouldCacheDomain(tt.host); got != tt.want {
+			t.Errorf("ShouldCacheDomain(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestUpstreamTLSAppliesTo(t *testing.T) {
+	tlsCfg := &UpstreamTLSConfig{Domains: []string{"*.corp.example", "intranet.local", "fd00::10"}}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"git.corp.example:443", true},
+		{"a.b.corp.example", true},
+		{"corp.example:443", false},
+		{"INTRANET.local:8443", true},
+		{"intranet.local.evil.com:443", false},
+		{"[fd00::10]:443", true},
+		{"[fd00::11]:443", false},
+		{"example.com:443", false},
+	}
+	for _, tt := range tests {
+		if got := tlsCfg.AppliesTo(tt.host); got != tt.want {
+			t.Errorf("AppliesTo(%q) with domains %v = %v, want %v", tt.host, tlsCfg.Domains, got, tt.want)
+		}
+	}
+
+	all := &UpstreamTLSConfig{CAFile: "/etc/ca.pem"}
+	if !all.AppliesTo("example.com:443") {
+		t.Error("AppliesTo with no domains = false, want true")
+	}
+}
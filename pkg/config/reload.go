@@ -0,0 +1,73 @@
+package config
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+)
+
+// reloadWindow is the period max-reloads-per-minute applies to.
+const reloadWindow = time.Minute
+
+// reloadLimiter caps how often the watched config file is reloaded. Changes
+// beyond the cap aren't dropped: they're coalesced into a single reload that
+// runs as soon as the window allows, so the latest file contents always win.
+type reloadLimiter struct {
+	reload func() // Performs one reload; never run concurrently
+
+	mu      sync.Mutex
+	recent  []time.Time // Start times of reloads within the last window
+	pending bool        // A coalesced reload is scheduled
+	running sync.Mutex  // Serializes reload calls
+}
+
+// request asks for a reload, honoring a cap of max reloads per minute
+// (0 or less means unlimited).
+func (l *reloadLimiter) request(max int) {
+	l.mu.Lock()
+	if l.pending {
+		l.mu.Unlock()
+		logging.Infof("Config reload throttled: change folded into the already scheduled reload.")
+		return
+	}
+	now := time.Now()
+	l.prune(now)
+	if max <= 0 || len(l.recent) < max {
+		l.recent = append(l.recent, now)
+		l.mu.Unlock()
+		l.run()
+		return
+	}
+
+	// Over the cap: reload once the oldest reload leaves the window
+	wait := l.recent[0].Add(reloadWindow).Sub(now)
+	count := len(l.recent)
+	l.pending = true
+	l.mu.Unlock()
+	logging.Infof("Config reload throttled: %d reloads in the last minute (max-reloads-per-minute %d), next reload in %s.", count, max, wait.Round(time.Second))
+	time.AfterFunc(wait, func() {
+		l.mu.Lock()
+		l.pending = false
+		l.recent = append(l.recent, time.Now())
+		l.mu.Unlock()
+		l.run()
+	})
+}
+
+// prune drops reload times that fell out of the window. Callers hold mu.
+func (l *reloadLimiter) prune(now time.Time) {
+	keep := l.recent[:0]
+	for _, t := range l.recent {
+		if now.Sub(t) < reloadWindow {
+			keep = append(keep, t)
+		}
+	}
+	l.recent = keep
+}
+
+func (l *reloadLimiter) run() {
+	l.running.Lock()
+	defer l.running.Unlock()
+	l.reload()
+}
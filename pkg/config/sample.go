@@ -0,0 +1,256 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/template"
+
+	"github.com/spf13/viper"
+)
+
+// sampleConfigTemplate is the starter config written by WriteSampleConfig.
+// Every value is filled in from setDefaults via the "def" function, so the
+// generated file always matches what the application assumes when a key is omitted.
+const sampleConfigTemplate = `---
+# admin-bot starter configuration.
+# Every value below is the built-in default; commented keys are optional.
+# Any key can be overridden by ADMINBOT_<KEY>, e.g. ADMINBOT_HTTP_PORT=9090.
+
+# Treat configuration warnings (e.g. a server with nothing to serve) as errors.
+strict: {{ def "strict" }}
+# Cap on reloads of this file per minute, extra changes are coalesced (0 = unlimited).
+max-reloads-per-minute: {{ def "max-reloads-per-minute" }}
+# reload-webhook: "https://ops.example.com/hooks/admin-bot" # POSTed a JSON outcome of every reload
+
+log:
+  level: {{ def "log.level" }} # "debug" adds per-request diagnostics; "warn"/"error" log less
+
+# Main HTTP Server Configuration
+http:
+  enabled: {{ def "http.enabled" }}
+  addr: {{ def "http.addr" }}
+  port: {{ def "http.port" }}
+  listen-timeout: {{ def "http.listen-timeout" }} # How long startup waits for the listener to be ready
+  shutdown-timeout: {{ def "http.shutdown-timeout" }} # How long stopping waits for in-flight requests before cutting them off
+  bind-then-swap: {{ def "http.bind-then-swap" }} # On a port change, bind the new port before closing the old
+  # Inbound connection timeouts ("0" disables one).
+  timeouts:
+    read-header: {{ def "http.timeouts.read-header" }} # Clients slower than this sending headers are disconnected
+    read: {{ def "http.timeouts.read" }}
+    write: {{ def "http.timeouts.write" }}
+    idle: {{ def "http.timeouts.idle" }}
+    # Proxied responses of these types are streamed: flushed as they arrive, never cut by read/write.
+    streaming-content-types: {{ def "http.timeouts.streaming-content-types" }}
+  # Optional method allowlist; other methods get 405.
+  # allowed-methods: ["GET", "HEAD"]
+  connect-reject-status: {{ def "http.connect-reject-status" }} # Answer to CONNECT when the forward proxy is off: 405 or 501
+  # Pin path prefixes to "proxy" or "static" instead of static-first, proxy-fallback (longest prefix wins).
+  # routes:
+  #   - {prefix: "/static/legacy/", handler: proxy}
+  # HTTPS for addr/port (or for listeners setting tls: true).
+  tls:
+    enabled: {{ def "http.tls.enabled" }}
+    # cert-file: "/etc/admin-bot/tls/cert.pem"
+    # key-file: "/etc/admin-bot/tls/key.pem"
+  # Set when behind an L4 load balancer that prepends PROXY protocol (v1/v2) headers.
+  proxy-protocol: {{ def "http.proxy-protocol" }}
+  log-tls: {{ def "http.log-tls" }} # Log TLS version, cipher and SNI of requests received over TLS
+
+  # When enabled, every request gets a 503 maintenance page.
+  maintenance:
+    enabled: {{ def "http.maintenance.enabled" }}
+    # page: "/var/www/maintenance.html"
+    # retry-after: "3600"
+
+  # Management API under /admin/, every request needs "Authorization: Bearer <token>".
+  admin:
+    enabled: {{ def "http.admin.enabled" }}
+    # token: "change-me"
+
+  # Prometheus metrics endpoint.
+  metrics:
+    enabled: {{ def "http.metrics.enabled" }}
+    path: {{ def "http.metrics.path" }}
+
+  # /healthz (liveness) and /readyz (readiness) probes.
+  health:
+    enabled: {{ def "http.health.enabled" }}
+
+  # One record per proxied request, as key=value "text" or "json" lines.
+  access-log:
+    enabled: {{ def "http.access-log.enabled" }}
+    format: {{ def "http.access-log.format" }}
+    output: {{ def "http.access-log.output" }} # stdout, stderr or a file path
+    # fields: ["time", "client-ip", "method", "path", "status", "duration"] # Subset to write (empty = all)
+
+  # Gzip for static and proxied responses (clients sending Accept-Encoding: gzip).
+  compression:
+    enabled: {{ def "http.compression.enabled" }}
+    min-size: {{ def "http.compression.min-size" }}
+    # content-types: ["text/*", "application/json", "*+json"] # Default covers text, JSON, JS, XML, SVG and wasm
+
+  # Serves local directories under /static/<key>/.
+  static:
+    enabled: {{ def "http.static.enabled" }}
+    # dirs:
+    #   files:
+    #     path: "/var/www/files"   # Or source: "embedded" with bundle: "<name>" for compiled-in assets
+    #     index: "index.html" # File served for directory requests
+    #     spa-fallback: false # Serve the root index for unknown paths (client-side routing)
+    #     disable-listing: false # Answer dirs without the index with missing-index-status (403/404) instead
+    #     cache-control: "public, max-age=3600"
+    #     etag: false # Strong ETag from size and mtime, for 304s on If-None-Match
+    #     basic-auth: # 401 without valid Authorization: Basic
+    #       users: [{username: "ops", password-hash: "$2y$10$..."}] # bcrypt, htpasswd -nbB
+
+  forward-proxy:
+    enabled: {{ def "http.forward-proxy.enabled" }}
+    # "ignore", "log" or "reject" absolute-form requests whose Host header disagrees with the URL.
+    host-mismatch: {{ def "http.forward-proxy.host-mismatch" }}
+    # user:pass@ in request URLs: "authorization" (as Basic auth), "strip" or "reject" (400).
+    url-credentials: {{ def "http.forward-proxy.url-credentials" }}
+    normalize-paths: {{ def "http.forward-proxy.normalize-paths" }} # Forward "//a/./b" as "/a/b"
+    trace: {{ def "http.forward-proxy.trace" }} # Log DNS/connect/TLS/TTFB timings of every upstream fetch
+    force-close: {{ def "http.forward-proxy.force-close" }} # Close the client connection after every proxied request
+    http10-keep-alive: {{ def "http.forward-proxy.http10-keep-alive" }} # Honour keep-alive requests of HTTP/1.0 clients
+    http2: {{ def "http.forward-proxy.http2" }} # Negotiate HTTP/2 with TLS origins that offer it
+    # http1-domains: ["legacy.example.com"] # Origins always fetched over HTTP/1.1
+    self-request: # Answer to requests targeting the proxy itself (a client loop)
+      status: {{ def "http.forward-proxy.self-request.status" }} # e.g. 421 (Misdirected Request)
+      # message: "..." # Response body, defaults to the status text
+      log-client: {{ def "http.forward-proxy.self-request.log-client" }} # Name the client in the warning
+    forwarded-header: {{ def "http.forward-proxy.forwarded-header" }} # Send "Forwarded: for=...;proto=...;host=..." (RFC 7239) to origins
+    max-conns-per-host: {{ def "http.forward-proxy.max-conns-per-host" }} # Concurrent fetches per origin (0 = unlimited)
+    conn-queue-timeout: {{ def "http.forward-proxy.conn-queue-timeout" }} # Wait for a free slot before answering 503
+    timeouts:
+      connect: {{ def "http.forward-proxy.timeouts.connect" }}
+      tls-handshake: {{ def "http.forward-proxy.timeouts.tls-handshake" }}
+      response-header: {{ def "http.forward-proxy.timeouts.response-header" }}
+      request: {{ def "http.forward-proxy.timeouts.request" }} # Reading a response body into the cache
+      idle-conn: {{ def "http.forward-proxy.timeouts.idle-conn" }}
+    max-response-headers: {{ def "http.forward-proxy.max-response-headers" }} # 0 = unlimited
+    max-response-header-size: {{ def "http.forward-proxy.max-response-header-size" }}
+    max-response-size: {{ def "http.forward-proxy.max-response-size" }} # Larger origin bodies fail with 502, never cached ("0" = no limit)
+    # allow: ["*.example.com"]        # Reachable destinations (empty = all), others get 403
+    # deny: ["*.internal"]            # Refused destinations, wins over allow
+    block-private-networks: {{ def "http.forward-proxy.block-private-networks" }} # 403 for loopback/private/link-local destinations
+    # source-addr: "192.0.2.10"       # Outbound source IP or interface name
+    # proxy-agent: "admin-bot"        # Proxy-Agent header on CONNECT replies
+    tunnel-idle-timeout: {{ def "http.forward-proxy.tunnel-idle-timeout" }} # Close CONNECT tunnels idle both ways this long ("0" = never)
+    # timeout-page: "/etc/admin-bot/504.html"
+    auth: # Proxy-Authorization: Basic, 407 otherwise
+      enabled: {{ def "http.forward-proxy.auth.enabled" }}
+      # users:
+      #   - username: "ci"
+      #     password-hash: "$2y$10$..." # bcrypt, from htpasswd -nbB ci 'pass'
+    self-test: # Test fetch through the proxy at startup (fatal with strict: true)
+      enabled: {{ def "http.forward-proxy.self-test.enabled" }}
+      # url: "http://example.com/" # Defaults to the first exact cache domain
+      timeout: {{ def "http.forward-proxy.self-test.timeout" }}
+    cache:
+      enabled: {{ def "http.forward-proxy.cache.enabled" }}
+      # cache-dir: "/var/cache/admin-bot/forward-proxy-cache" # Required when the cache is enabled
+      # cache-dirs: ["/mnt/disk1/cache", "/mnt/disk2/cache"]  # Or several dirs, entries spread by key hash
+      cache-ttl: {{ def "http.forward-proxy.cache.cache-ttl" }}
+      # domain-ttls: {"pypi.org": "1h", "*.ubuntu.com": "30d"} # Replace cache-ttl for these hosts
+      # case-insensitive-paths: ["intranet.example.com"] # Lowercase these hosts' paths in cache keys
+      skip-query-urls: {{ def "http.forward-proxy.cache.skip-query-urls" }}
+      # exclude-extensions: [".php", ".cgi"] # Never cached, even for cached domains
+      negative-ttl: {{ def "http.forward-proxy.cache.negative-ttl" }} # Cache negative-statuses this long ("0" = never)
+      negative-statuses: {{ def "http.forward-proxy.cache.negative-statuses" }} # 404 and/or 410
+      # ttl-header: "X-Cache-TTL" # Origin header setting an entry's TTL ("300" or "5m"), hidden from clients
+      status-header: # Tells clients whether the cache was used (name "" sends none)
+        name: {{ def "http.forward-proxy.cache.status-header.name" }}
+        hit: {{ def "http.forward-proxy.cache.status-header.hit" }}
+        miss: {{ def "http.forward-proxy.cache.status-header.miss" }}
+        bypass: {{ def "http.forward-proxy.cache.status-header.bypass" }}
+      honor-client-no-cache: {{ def "http.forward-proxy.cache.honor-client-no-cache" }} # Client no-cache (incl. Pragma) revalidates/refetches
+      honor-cache-headers: {{ def "http.forward-proxy.cache.honor-cache-headers" }} # false = ignore Cache-Control/Expires, always use cache-ttl
+      compress: {{ def "http.forward-proxy.cache.compress" }}
+      # min-object-size: "1KB"
+      max-object-size: {{ def "http.forward-proxy.cache.max-object-size" }} # Larger responses are streamed, not cached ("0" = no limit)
+      max-size: {{ def "http.forward-proxy.cache.max-size" }} # Total disk cap, least recently used entries are evicted ("0" = no cap)
+      refresh-ahead: # Refetch hot entries shortly before they expire
+        enabled: {{ def "http.forward-proxy.cache.refresh-ahead.enabled" }}
+        window: {{ def "http.forward-proxy.cache.refresh-ahead.window" }}
+        interval: {{ def "http.forward-proxy.cache.refresh-ahead.interval" }}
+        min-hits: {{ def "http.forward-proxy.cache.refresh-ahead.min-hits" }}
+    # Domains whose HTTP responses are cached ("*.example.com" matches subdomains).
+    domains: []
+
+# Background cleanup of expired proxy cache files.
+proxy-cache-cleanup:
+  interval: {{ def "proxy-cache-cleanup.interval" }}
+  run-on-start: {{ def "proxy-cache-cleanup.run-on-start" }} # Clean right away instead of after the first interval
+  max-size: {{ def "proxy-cache-cleanup.max-size" }} # Per-dir cap, oldest entries are deleted beyond it ("0" = no cap)
+  # ttl: "8d" # Delete entries from disk at this age instead of cache-ttl, serving them when the origin fails
+`
+
+// SampleConfig renders the commented starter config from the built-in defaults.
+func SampleConfig() ([]byte, error) {
+	v := viper.New()
+	setDefaults(v)
+
+	tmpl, err := template.New("config").Funcs(template.FuncMap{
+		"def": func(key string) (string, error) {
+			if !v.IsSet(key) {
+				return "", fmt.Errorf("no default for %s", key)
+			}
+			switch val := v.Get(key).(type) {
+			case string:
+				return strconv.Quote(val), nil
+			default:
+				return fmt.Sprint(val), nil
+			}
+		},
+	}).Parse(sampleConfigTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse sample config template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		return nil, fmt.Errorf("failed to render sample config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteSampleConfig writes the starter config to path. It refuses to replace
+// an existing file unless force is set. The written file is loaded back to
+// make sure it's valid.
+func WriteSampleConfig(path string, force bool) error {
+	if configType(path) != "yaml" {
+		return fmt.Errorf("the starter config is YAML, %s would be read as %s", path, configType(path))
+	}
+	data, err := SampleConfig()
+	if err != nil {
+		return err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0640)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("refusing to overwrite existing file %s (use -force)", path)
+		}
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	if _, err := loadAndValidate(path); err != nil {
+		return fmt.Errorf("generated config %s does not load: %w", path, err)
+	}
+	return nil
+}
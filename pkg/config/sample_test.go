@@ -0,0 +1,61 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteSampleConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := WriteSampleConfig(path, false); err != nil {
+		t.Fatalf("WriteSampleConfig: %v", err)
+	}
+	written, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sample, err := SampleConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(written, sample) {
+		t.Error("written file differs from SampleConfig()")
+	}
+	if _, err := ReadConfigFile(path); err != nil {
+		t.Errorf("written config doesn't load: %v", err)
+	}
+
+	// An existing file is left alone without force
+	edited := []byte("log:\n  level: debug\n")
+	if err := os.WriteFile(path, edited, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err = WriteSampleConfig(path, false)
+	if err == nil || !strings.Contains(err.Error(), "refusing to overwrite") {
+		t.Errorf("WriteSampleConfig over an existing file: err %v, want refusal", err)
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, edited) {
+		t.Errorf("existing file was modified without force: %q", got)
+	}
+
+	// ...and replaced with force
+	if err := WriteSampleConfig(path, true); err != nil {
+		t.Fatalf("WriteSampleConfig with force: %v", err)
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, sample) {
+		t.Error("force didn't replace the existing file with the sample")
+	}
+}
+
+func TestWriteSampleConfigRejectsOtherFormats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := WriteSampleConfig(path, false); err == nil {
+		t.Error("WriteSampleConfig to a .json path succeeded, want error")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("%s was created (err %v)", path, err)
+	}
+}
@@ -0,0 +1,42 @@
+package forwardproxy
+
+import (
+	"net/http"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/basicauth"
+	"github.com/mohammedhabas11/admin-bot/pkg/config"
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+)
+
+// proxyAuth checks Proxy-Authorization: Basic credentials. A nil *proxyAuth
+// lets every request through.
+type proxyAuth struct {
+	realm   string
+	checker *basicauth.Checker
+}
+
+// newProxyAuth builds the checker from config, or returns nil when auth is
+// disabled.
+func newProxyAuth(cfg config.ProxyAuthConfig) *proxyAuth {
+	if !cfg.Enabled {
+		return nil
+	}
+	pa := &proxyAuth{realm: cfg.GetRealm(), checker: basicauth.New(cfg.Users, "proxy")}
+	logging.Infof("Proxy authentication enabled for %d users (realm %q)", pa.checker.Users(), pa.realm)
+	return pa
+}
+
+// allowed reports whether r carries valid proxy credentials.
+func (pa *proxyAuth) allowed(r *http.Request) bool {
+	if pa == nil {
+		return true
+	}
+	return pa.checker.Check(r.Header.Get("Proxy-Authorization"))
+}
+
+// challenge answers an unauthenticated request with 407 and a Basic challenge.
+func (pa *proxyAuth) challenge(w http.ResponseWriter, r *http.Request) {
+	logging.Warnf("Proxy authentication required for %s %s from %s", r.Method, r.RequestURI, r.RemoteAddr)
+	w.Header().Set("Proxy-Authenticate", `Basic realm="`+pa.realm+`", charset="UTF-8"`)
+	http.Error(w, "Proxy Authentication Required", http.StatusProxyAuthRequired)
+}
@@ -6,31 +6,67 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
-	"mime"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/compression"
+	"github.com/mohammedhabas11/admin-bot/pkg/config"
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+	"github.com/mohammedhabas11/admin-bot/pkg/metrics"
 )
 
 // FetchFunc defines the function signature for fetching the resource when cache misses.
+// bodyBytes may be nil, in which case resp.Body streams from the origin.
 type FetchFunc func(r *http.Request) (resp *http.Response, bodyBytes []byte, err error)
 
 // CacheHandler implements caching logic for the forward proxy.
 type CacheHandler struct {
-	cacheDir    string
-	cacheTTL    time.Duration
-	fetchOrigin FetchFunc // Function to call on cache miss
+	cacheDirs     []string // Entries are spread over these by key hash
+	cacheTTL      time.Duration
+	fetchOrigin   FetchFunc        // Function to call on cache miss
+	minObjectSize int64            // Bodies smaller than this are served but not cached
+	domainQuotas  map[string]int64 // Per-domain byte quotas, keyed by lowercase host
+	quotaMutex    sync.Mutex       // Serializes quota enforcement walks
+	compress      bool             // Gzip compressible bodies before writing them to disk
+	maxObjectSize int64            // Bodies larger than this are streamed, not cached (0 = no limit)
+	refresher     *refresher       // Refresh-ahead worker for hot entries, nil when disabled
+	honorHeaders  bool             // Obey the origin's Cache-Control/Expires instead of always using cacheTTL
+	lru           *lruIndex        // Total size cap with LRU eviction, nil when unlimited
+
+	negativeTTL      time.Duration // Lifetime of cached negativeStatuses responses, 0 = never cached
+	negativeStatuses []int         // Error statuses (404, 410) cached for negativeTTL
+	ttlHeader        string        // Origin header overriding an entry's lifetime, "" when not honored
+
+	honorClientNoCache bool          // Client no-cache requests skip fresh entries (revalidate or refetch)
+	keepStale          time.Duration // Expired entries are left on disk for the cleaner, which keeps them this long
+
+	domainTTLs map[string]time.Duration // Per-domain replacements of cacheTTL, keyed by lowercase host or "*.example.com"
+
+	foldPathCase func(host string) bool // Reports hosts whose paths are lowercased in cache keys, nil for none
+
+	fillTimeout time.Duration // Limit on reading an origin body into the cache (timeouts.request), 0 = none
 }
 
+// corruptReads counts cache entries discarded because they couldn't be read
+// back intact. Package level so the count survives handler rebuilds on reload.
+var corruptReads atomic.Int64
+
 // NewCacheHandler creates a new caching layer.
-func NewCacheHandler(cacheDir string, cacheTTL time.Duration, fetcher FetchFunc) *CacheHandler {
-	if cacheDir == "" {
-		log.Println("WARN: Cache directory is empty, caching will be disabled.")
+func NewCacheHandler(cacheDirs []string, cacheTTL time.Duration, fetcher FetchFunc) *CacheHandler {
+	if len(cacheDirs) == 0 {
+		logging.Warnf("Cache directory is empty, caching will be disabled.")
 		// Return nil or a handler that always fetches? For now, allow but log.
 		// Or return error: return nil, errors.New("cache directory cannot be empty")
 	}
@@ -39,11 +75,11 @@ func NewCacheHandler(cacheDir string, cacheTTL time.Duration, fetcher FetchFunc)
 	}
 	// Ensure cache TTL is non-negative.
 	if cacheTTL < 0 {
-		log.Println("WARN: Negative cache TTL provided, setting to 0 (disabled).")
+		logging.Warnf("Negative cache TTL provided, setting to 0 (disabled).")
 		cacheTTL = 0 // Effectively disable caching if TTL is negative
 	}
 	return &CacheHandler{
-		cacheDir:    cacheDir,
+		cacheDirs:   cacheDirs,
 		cacheTTL:    cacheTTL,
 		fetchOrigin: fetcher,
 	}
@@ -53,139 +89,570 @@ func NewCacheHandler(cacheDir string, cacheTTL time.Duration, fetcher FetchFunc)
 // Returns the http.Response, body bytes, a bool indicating cache hit, and error.
 func (h *CacheHandler) ServeFromCacheOrFetch(r *http.Request) (*http.Response, []byte, bool, error) {
 	// Check if caching is effectively disabled
-	if h.cacheTTL <= 0 || h.cacheDir == "" {
-		// log.Printf("DBG: Cache Check: Caching disabled (TTL=%s, Dir='%s')", h.cacheTTL, h.cacheDir) // Optional Debug
+	if h.cacheTTL <= 0 || len(h.cacheDirs) == 0 {
+		// log.Printf("DBG: Cache Check: Caching disabled (TTL=%s, Dirs=%v)", h.cacheTTL, h.cacheDirs) // Optional Debug
 		resp, body, err := h.fetchOrigin(r)
 		return resp, body, false, err
 	}
 
-	cacheKey := generateCacheKey(r.Method, r.URL)
-	cachePath := filepath.Join(h.cacheDir, cacheKey)
+	// HEAD shares the GET entry: a cached GET answers HEAD without an origin trip
+	keyMethod := r.Method
+	if r.Method == http.MethodHead {
+		keyMethod = http.MethodGet
+	}
+	foldPath := h.foldPathCase != nil && h.foldPathCase(r.URL.Host)
+	cacheKey := generateCacheKey(keyMethod, r.URL, foldPath)
+	cachePath := filepath.Join(CacheDirFor(h.cacheDirs, cacheKey), domainDirName(r.URL.Host), cacheKey)
 	// log.Printf("DBG: Cache Check: URL=%s, Key=%s, Path=%s", r.URL.String(), cacheKey, cachePath) // Optional Debug
 
-	// Try to serve from cache first
-	resp, body, found, err := h.serveFromCacheFile(cachePath)
+	// Try to serve from cache first, unless the client asks for a reload
+	var resp *http.Response
+	var body []byte
+	var found bool
+	var err error
+	if h.honorClientNoCache && clientNoCache(r.Header) {
+		logging.Debugf("Client sent no-cache for %s, revalidating or refetching", r.URL.String())
+	} else {
+		resp, body, found, err = h.serveFromCacheFile(cachePath, compression.AcceptsGzip(r), false)
+	}
 	if err != nil {
 		// Log error reading cache but proceed to fetch
-		log.Printf("WARN: Error reading cache file %s: %v. Attempting fetch.", cachePath, err)
+		logging.Warnf("Error reading cache file %s: %v. Attempting fetch.", cachePath, err)
 	}
 	if found {
 		// log.Printf("DBG: Cache Check: Found in cache file %s", cachePath) // Optional Debug
+		h.refresher.recordHit(cachePath)
+		h.lru.touch(cachePath)
+		if r.Method == http.MethodHead {
+			resp.Body = http.NoBody // Headers (incl. Content-Length) describe the GET body
+			return resp, nil, true, nil
+		}
 		return resp, body, true, nil // Cache Hit!
 	}
 	// log.Printf("DBG: Cache Check: Not found or expired in cache file %s", cachePath) // Optional Debug
 
-	// Cache Miss: Fetch from origin
-	originResp, originBody, fetchErr := h.fetchOrigin(r)
+	// Cache Miss: revalidate an expired entry the origin gave validators for,
+	// otherwise fetch from origin
+	var originResp *http.Response
+	var originBody []byte
+	var fetchErr error
+	if stale, ok := h.staleEntry(cachePath); ok {
+		var fresh bool
+		originResp, originBody, fresh, fetchErr = h.revalidate(r, cachePath, stale)
+		if fetchErr == nil && fresh {
+			if r.Method == http.MethodHead {
+				originResp.Body = http.NoBody
+				return originResp, nil, true, nil
+			}
+			return originResp, originBody, true, nil // Unchanged at the origin, served from disk
+		}
+	} else {
+		originResp, originBody, fetchErr = h.fetchOrigin(r)
+	}
+	if fetchErr != nil || (originResp.StatusCode >= 500 && originResp.StatusCode != http.StatusNotImplemented) {
+		if resp, body, ok := h.staleFallback(r, cachePath, originResp, fetchErr); ok {
+			return resp, body, true, nil
+		}
+	}
 	if fetchErr != nil {
 		return nil, nil, false, fmt.Errorf("failed to fetch origin for %s: %w", r.URL.String(), fetchErr)
 	}
 	// We need to be careful with the originResp.Body.
 	// If we cache, we consume it. If we don't cache, the caller needs it.
 
-	// Cache successful responses (e.g., 2xx)
-	if originResp.StatusCode >= 200 && originResp.StatusCode < 300 {
-		// Save response headers and body to cache
-		// For simplicity now, just cache the body. A better cache would store headers too.
-		h.saveToCache(cachePath, originBody) // Save the fetched body
+	// A HEAD response has no body, storing it would poison the shared GET entry
+	if r.Method == http.MethodHead {
+		return originResp, originBody, false, nil
+	}
+
+	// Cache only 200 OK: entries are keyed by URL alone, so a 206 Partial Content
+	// (or 204 No Content) would be replayed for requests it doesn't answer.
+	// The exception are negative entries (404/410), kept for the shorter negative-ttl.
+	negative := h.negativeTTL > 0 && slices.Contains(h.negativeStatuses, originResp.StatusCode)
+	if originResp.StatusCode != http.StatusOK && !negative {
+		logging.Infof("Not caching response for %s due to status code: %d", r.URL.String(), originResp.StatusCode)
+		// IMPORTANT: Do not close originResp.Body here, the caller (HandleHTTP) needs it.
+		return originResp, originBody, false, nil
+	}
+
+	if ok, reason := sharedStorable(r.Header, originResp.Header); !ok {
+		logging.Infof("Not caching response for %s: %s", r.URL.String(), reason)
+		return originResp, originBody, false, nil
+	}
+
+	// An explicit per-response TTL from the origin wins over everything else;
+	// otherwise the origin may forbid storing the response at all
+	lifetime := time.Duration(0)
+	if ttl, ok := h.headerTTL(originResp.Header); ok {
+		if ttl <= 0 {
+			logging.Infof("Not caching response for %s: %s is 0", r.URL.String(), h.ttlHeader)
+			return originResp, originBody, false, nil
+		}
+		lifetime = ttl
+	} else if h.honorHeaders {
+		var storable bool
+		var reason string
+		if lifetime, storable, reason = originFreshness(originResp.Header, time.Now()); !storable {
+			logging.Infof("Not caching response for %s: %s", r.URL.String(), reason)
+			return originResp, originBody, false, nil
+		}
+	}
+	if negative && (lifetime <= 0 || lifetime > h.negativeTTL) {
+		lifetime = h.negativeTTL // The origin may shorten a negative entry's life, never extend it
+	}
+
+	// Buffer the body for storage unless it's known (or turns out) to exceed
+	// max-object-size, in which case it's streamed through uncached
+	if originBody == nil {
+		if h.maxObjectSize > 0 && originResp.ContentLength > h.maxObjectSize {
+			logging.Infof("Not caching response for %s: Content-Length %d exceeds max-object-size %d", r.URL.String(), originResp.ContentLength, h.maxObjectSize)
+			return originResp, nil, false, nil
+		}
+		body, complete, err := readUpTo(originResp.Body, h.maxObjectSize, r.URL.Host, h.fillTimeout)
+		if err != nil {
+			originResp.Body.Close()
+			return nil, nil, false, fmt.Errorf("failed to fetch origin for %s: %w", r.URL.String(), err)
+		}
+		if !complete {
+			logging.Infof("Not caching response for %s: body exceeds max-object-size %d", r.URL.String(), h.maxObjectSize)
+			originResp.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), originResp.Body), originResp.Body} // Replay what was read, then stream the rest
+			return originResp, nil, false, nil
+		}
+		originResp.Body.Close() // Fully read, frees the connection (and any limiter slot)
+		originResp.Body = io.NopCloser(bytes.NewReader(body))
+		originBody = body
+	}
+
+	// A client that went away mid-fetch cancels the upstream request through its
+	// context; whatever arrived by then must not end up in the cache
+	if err := r.Context().Err(); err != nil {
+		logging.Infof("Not caching response for %s: client request was cancelled", r.URL.String())
+		return nil, nil, false, fmt.Errorf("fetch of %s abandoned: %w", r.URL.String(), err)
+	}
+
+	if h.storeResponse(cachePath, r.URL, keyMethod, originResp, originBody, lifetime) {
 		// Since we cached, the original body is no longer needed by the caller in this path
 		originResp.Body.Close()
-	} else {
-		log.Printf("Not caching response for %s due to status code: %d", r.URL.String(), originResp.StatusCode)
-		// IMPORTANT: Do not close originResp.Body here, the caller (HandleHTTP) needs it.
 	}
 
 	// Return the response fetched from origin (body might be closed if cached, or open if not)
 	return originResp, originBody, false, nil
 }
 
-// serveFromCacheFile tries to read response body from a cache file.
-// Returns dummy response, body bytes, bool found, error.
-// A real implementation would store/retrieve headers as well.
-func (h *CacheHandler) serveFromCacheFile(path string) (*http.Response, []byte, bool, error) {
+// headerTTL parses the ttl-header of an origin response: whole seconds
+// ("300") or a duration ("5m", "1d"). ok is false when the header isn't
+// configured, absent or unparsable.
+func (h *CacheHandler) headerTTL(header http.Header) (time.Duration, bool) {
+	if h.ttlHeader == "" {
+		return 0, false
+	}
+	value := strings.TrimSpace(header.Get(h.ttlHeader))
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(secs) * time.Second, true
+	}
+	ttl, err := config.StrToDuration(value)
+	if err != nil {
+		logging.Warnf("Ignoring unparsable %s '%s': %v", h.ttlHeader, value, err)
+		return 0, false
+	}
+	return ttl, true
+}
+
+// storeResponse writes a fully buffered 200 (or negative 404/410) response to
+// the cache entry at cachePath, compressing it when configured. A non-zero
+// lifetime (from the origin's caching headers or negative-ttl) overrides
+// cacheTTL for this entry. Returns false if a 200 body was too small to be
+// worth caching; error pages are small by nature and always kept.
+func (h *CacheHandler) storeResponse(cachePath string, u *url.URL, keyMethod string, resp *http.Response, body []byte, lifetime time.Duration) bool {
+	if resp.StatusCode == http.StatusOK && int64(len(body)) < h.minObjectSize {
+		logging.Infof("Not caching response for %s: %d bytes is below min-object-size %d", u.String(), len(body), h.minObjectSize)
+		return false
+	}
+
+	// Save response status, headers and body to cache
+	meta := cacheMeta{
+		URL:      u.String(),
+		Method:   keyMethod,
+		StoredAt: time.Now(),
+		Status:   resp.StatusCode,
+		Header:   make(http.Header),
+	}
+	copyHeaders(meta.Header, resp.Header) // Hop-by-hop headers don't belong in the entry
+	dropPerClientHeaders(meta.Header)     // The entry is shared by every client
+	if h.ttlHeader != "" {
+		meta.Header.Del(h.ttlHeader) // Meant for the proxy only
+	}
+	if lifetime <= 0 {
+		lifetime = h.domainTTL(u.Host) // 0 (cacheTTL) unless the domain has its own
+	}
+	if lifetime > 0 {
+		expiresAt := meta.StoredAt.Add(lifetime)
+		meta.ExpiresAt = &expiresAt
+	}
+	stored := body
+	if h.compress && resp.Header.Get("Content-Encoding") == "" && isCompressible(resp.Header.Get("Content-Type")) {
+		if gz, err := gzipBytes(body); err != nil {
+			logging.Warnf("Failed to compress %s for caching, storing it uncompressed: %v", u.String(), err)
+		} else if len(gz) < len(body) {
+			stored = gz
+			meta.Encoding = "gzip"
+		}
+	}
+	h.saveToCache(cachePath, stored, meta) // Save the fetched body
+	h.enforceDomainQuota(u.Host)
+	return true
+}
+
+// perClientHeaders are response headers meant for the one client whose request
+// was answered, never replayed from the shared cache: a session cookie would
+// otherwise be handed to everyone requesting the URL.
+var perClientHeaders = []string{"Set-Cookie", "Set-Cookie2"}
+
+func dropPerClientHeaders(header http.Header) {
+	for _, name := range perClientHeaders {
+		header.Del(name)
+	}
+}
+
+// domainTTL returns the domain-ttls override for host, an exact entry
+// winning over wildcards, or 0 when it has none.
+func (h *CacheHandler) domainTTL(host string) time.Duration {
+	if len(h.domainTTLs) == 0 {
+		return 0
+	}
+	if ttl, ok := h.domainTTLs[strings.ToLower(stripPort(host))]; ok {
+		return ttl
+	}
+	for pattern, ttl := range h.domainTTLs {
+		if config.MatchHost(pattern, host) {
+			return ttl
+		}
+	}
+	return 0
+}
+
+// serveFromCacheFile tries to read a cached response (status, headers and body).
+// Returns the response, body bytes, bool found, error.
+// Bodies stored gzipped are passed through as-is to clients accepting gzip
+// and decompressed for everyone else. allowExpired returns expired entries
+// too, for the stale fallback.
+func (h *CacheHandler) serveFromCacheFile(path string, clientAcceptsGzip, allowExpired bool) (*http.Response, []byte, bool, error) {
 	fi, err := os.Stat(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			// log.Printf("DBG: serveFromCacheFile: File not found: %s", path) // Optional Debug
 			return nil, nil, false, nil // Not found, not an error
 		}
-		log.Printf("WARN: serveFromCacheFile: Stat error for %s: %v", path, err) // Log as warning
-		return nil, nil, false, err                                              // Other stat error
+		logging.Warnf("serveFromCacheFile: Stat error for %s: %v", path, err) // Log as warning
+		return nil, nil, false, err                                           // Other stat error
 	}
 
-	// Check TTL
-	if time.Since(fi.ModTime()) > h.cacheTTL {
-		log.Printf("Cache EXPIRED for %s (ModTime: %s, TTL: %s)", path, fi.ModTime(), h.cacheTTL)
+	// The status and headers live in the metadata. Entries written before they
+	// were stored have no status and can't be replayed faithfully, so refetch them.
+	meta, err := readMeta(metaPathFor(path))
+
+	// Check freshness: the origin's expiry if it gave one, cacheTTL otherwise
+	expiresAt := fi.ModTime().Add(h.cacheTTL)
+	if err == nil && meta.ExpiresAt != nil {
+		expiresAt = *meta.ExpiresAt
+	}
+	if time.Now().After(expiresAt) && !allowExpired {
+		if err == nil && hasValidators(meta) {
+			// Kept on disk so the next request can revalidate it instead of redownloading
+			logging.Infof("Cache STALE for %s (expired at %s), will revalidate", path, expiresAt)
+			return nil, nil, false, nil
+		}
+		if h.keepStale > 0 {
+			// Kept until the cleanup TTL as a stale fallback, a refetch overwrites it
+			logging.Infof("Cache EXPIRED for %s (expired at %s), kept on disk for cleanup", path, expiresAt)
+			return nil, nil, false, nil
+		}
+		logging.Infof("Cache EXPIRED for %s (ModTime: %s, expired at %s)", path, fi.ModTime(), expiresAt)
 		// Attempt removal (best effort)
 		if rmErr := os.Remove(path); rmErr != nil && !os.IsNotExist(rmErr) {
-			log.Printf("WARN: Failed to remove expired cache file %s: %v", path, rmErr)
+			logging.Warnf("Failed to remove expired cache file %s: %v", path, rmErr)
 		}
+		_ = os.Remove(metaPathFor(path))
+		h.lru.remove(path)
+		metrics.CacheEvictions.Inc("expired")
 		return nil, nil, false, nil // Expired, treat as not found
 	}
 	// log.Printf("DBG: serveFromCacheFile: Cache valid for %s", path) // Optional Debug
 
+	if err != nil {
+		if !os.IsNotExist(err) {
+			h.discardCorrupt(path, fmt.Errorf("unreadable metadata: %w", err))
+		}
+		return nil, nil, false, nil // Treat as miss
+	}
+	if meta.Status == 0 {
+		logging.Infof("Cache entry %s predates stored headers, treating as miss", path)
+		return nil, nil, false, nil
+	}
+
 	// Read the file content (body)
 	bodyBytes, err := os.ReadFile(path)
 	if err != nil {
-		// Log error but treat as cache miss
-		log.Printf("WARN: Failed to read cache file %s: %v", path, err)
-		// Attempt to remove potentially corrupt file
-		_ = os.Remove(path)
+		h.discardCorrupt(path, fmt.Errorf("unreadable body: %w", err))
 		return nil, nil, false, nil // Treat as miss if read fails
 	}
+	// A body that doesn't match the stored length was truncated or damaged on disk
+	if meta.Encoding == "" {
+		if want, err := strconv.Atoi(meta.Header.Get("Content-Length")); err == nil && want != len(bodyBytes) {
+			h.discardCorrupt(path, fmt.Errorf("body is %d bytes, expected %d", len(bodyBytes), want))
+			return nil, nil, false, nil
+		}
+	}
+
+	// The body is gzipped either by us (cache.compress) or by the origin itself;
+	// clients that don't accept gzip get it decompressed
+	header := meta.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	dropPerClientHeaders(header) // Entries written before they were dropped on store
+	isGzip := meta.Encoding == "gzip" || strings.EqualFold(header.Get("Content-Encoding"), "gzip")
+	if isGzip && !clientAcceptsGzip {
+		if bodyBytes, err = gunzipBytes(bodyBytes); err != nil {
+			h.discardCorrupt(path, fmt.Errorf("gzip body does not decompress: %w", err))
+			return nil, nil, false, nil // Treat as miss
+		}
+		header.Del("Content-Encoding")
+	} else if meta.Encoding == "gzip" {
+		header.Set("Content-Encoding", "gzip")
+	}
+	if isGzip && !strings.Contains(strings.ToLower(strings.Join(header.Values("Vary"), ",")), "accept-encoding") {
+		header.Add("Vary", "Accept-Encoding") // Representation depends on the client
+	}
 
-	// --- Construct a dummy response ---
-	// Ideally, we'd load saved headers here. For now, create minimal headers.
+	// --- Rebuild the origin response from the stored status and headers ---
 	resp := &http.Response{
-		StatusCode: http.StatusOK, // Assume OK for cached item
-		Header:     make(http.Header),
+		StatusCode: meta.Status,
+		Header:     header,
 		Body:       io.NopCloser(bytes.NewReader(bodyBytes)), // Create a readable body
 	}
-	resp.Header.Set("Content-Length", strconv.Itoa(len(bodyBytes)))
-	resp.Header.Set("Last-Modified", fi.ModTime().UTC().Format(http.TimeFormat))
-	// Set Content-Type based on extension (of the original URL if stored, or cache key?)
-	// This is limited without stored headers.
-	ctype := mime.TypeByExtension(filepath.Ext(path)) // Guess from cache key extension (limited)
-	if ctype == "" {
-		ctype = "application/octet-stream"
+	resp.Header.Set("Content-Length", strconv.Itoa(len(bodyBytes))) // Body may have been (de)compressed
+	if resp.Header.Get("Last-Modified") == "" {
+		resp.Header.Set("Last-Modified", fi.ModTime().UTC().Format(http.TimeFormat))
+	}
+	if resp.StatusCode == http.StatusOK {
+		resp.Header.Set("Accept-Ranges", "bytes") // Cached bodies are served with http.ServeContent
 	}
-	resp.Header.Set("Content-Type", ctype)
 
 	return resp, bodyBytes, true, nil
 }
 
-// saveToCache saves the response body to the cache file.
-func (h *CacheHandler) saveToCache(path string, data []byte) {
+// readUpTo buffers body until EOF or until more than limit bytes were read
+// (limit 0 means no limit). complete reports whether the whole body fit. An
+// origin still sending after timeout (0 = none) has its body closed and the
+// read fails with ErrUpstreamTimeout.
+func readUpTo(body io.ReadCloser, limit int64, host string, timeout time.Duration) (data []byte, complete bool, err error) {
+	if timeout > 0 {
+		var timedOut atomic.Bool
+		timer := time.AfterFunc(timeout, func() {
+			timedOut.Store(true)
+			body.Close() // Unblocks the pending Read
+		})
+		defer func() {
+			if !timer.Stop() && timedOut.Load() && err != nil {
+				err = fmt.Errorf("%w: cache fill exceeded %v: %w", ErrUpstreamTimeout, timeout, err)
+			}
+		}()
+	}
+	var reader io.Reader = body
+	if limit > 0 {
+		reader = io.LimitReader(body, limit+1)
+	}
+	data, err = readBody(reader, host)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, limit <= 0 || int64(len(data)) <= limit, nil
+}
+
+// discardCorrupt removes a cache entry that couldn't be read back intact and
+// counts it. Repeated corruption usually points at a failing disk, so it's
+// logged as an error with the running total rather than as a quiet miss.
+func (h *CacheHandler) discardCorrupt(path string, reason error) {
+	total := corruptReads.Add(1)
+	logging.Errorf("Cache CORRUPT entry %s discarded (%d corrupt reads so far): %v", path, total, reason)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		logging.Warnf("Failed to remove corrupt cache file %s: %v", path, err)
+	}
+	_ = os.Remove(metaPathFor(path))
+	h.lru.remove(path)
+	metrics.CacheEvictions.Inc("corrupt")
+}
+
+// CacheCorruptReads returns how many cache entries were discarded as corrupt
+// since the process started.
+func CacheCorruptReads() int64 {
+	return corruptReads.Load()
+}
+
+// saveToCache saves the response body to the cache file, plus its metadata.
+func (h *CacheHandler) saveToCache(path string, data []byte, meta cacheMeta) {
 	dir := filepath.Dir(path)
 	// Ensure cache directory exists
 	if err := os.MkdirAll(dir, 0750); err != nil {
-		log.Printf("ERROR: Failed to create cache directory %s: %v", dir, err)
+		logging.Errorf("Failed to create cache directory %s: %v", dir, err)
 		return
 	}
 
-	// Write the file
-	// Use a temporary file and rename for atomicity? More robust but complex.
-	// For now, direct write.
-	if err := os.WriteFile(path, data, 0640); err != nil {
-		log.Printf("ERROR: Failed to write cache file %s: %v", path, err)
-		// Attempt to remove potentially corrupt file
+	// Write the file. Readers only ever see the previous entry or the complete new one.
+	if err := writeFileAtomic(path, data, 0640); err != nil {
+		logging.Errorf("Failed to write cache file %s: %v", path, err)
+		return
+	}
+	if err := writeMeta(path, meta); err != nil {
+		// Without its metadata the entry can't be replayed, drop the body too
+		logging.Warnf("Failed to write cache metadata for %s: %v", path, err)
 		_ = os.Remove(path)
 		return
 	}
-	log.Printf("Cache SAVED %d bytes to %s", len(data), path)
+	logging.Debugf("Cache SAVED %d bytes to %s", len(data), path)
+	h.lru.add(path, int64(len(data))+fileSize(metaPathFor(path)))
+	h.lru.evict(path)
 }
 
-// generateCacheKey creates a filesystem-safe cache key from method and URL.
-func generateCacheKey(method string, u *url.URL) string {
+// writeFileAtomic writes data to a temp file next to path and renames it into
+// place, so concurrent readers never observe a partially written file and
+// racing writers for the same path simply replace each other. The temp file is
+// removed if anything fails.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*") // Same dir keeps rename on one filesystem
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // No-op once the rename succeeded
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temp file %s: %w", tmpPath, err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set permissions on %s: %w", tmpPath, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file %s: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to move %s into place: %w", tmpPath, err)
+	}
+	return nil
+}
+
+// enforceDomainQuota evicts the oldest entries of a domain's cache subdirectory
+// until it fits within the configured quota. Other domains are never touched.
+func (h *CacheHandler) enforceDomainQuota(host string) {
+	hostOnly := strings.ToLower(stripPort(host))
+	quota, ok := h.domainQuotas[hostOnly]
+	if !ok {
+		return // No quota configured for this domain
+	}
+
+	h.quotaMutex.Lock()
+	defer h.quotaMutex.Unlock()
+
+	type cacheEntry struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	// A domain's entries are spread over every cache dir, the quota covers them all
+	var domainDirs []string
+	for _, dir := range h.cacheDirs {
+		domainDirs = append(domainDirs, filepath.Join(dir, domainDirName(host)))
+	}
+	var entries []cacheEntry
+	var totalSize int64
+	err := walkCacheDirs(domainDirs, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".cache" {
+			return nil // Skip unreadable paths, directories and metadata files
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		entries = append(entries, cacheEntry{path: path, size: info.Size(), modTime: info.ModTime()})
+		totalSize += info.Size()
+		return nil
+	})
+	if err != nil {
+		logging.Warnf("Failed to scan cache for domain %s: %v", hostOnly, err)
+		return
+	}
+	if totalSize <= quota {
+		return
+	}
+
+	// Evict oldest first until the domain is back under its quota
+	sort.Slice(entries, func(i, j int) bool { return entries[i].modTime.Before(entries[j].modTime) })
+	evicted := 0
+	for _, entry := range entries {
+		if totalSize <= quota {
+			break
+		}
+		if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+			logging.Warnf("Failed to evict cache file %s: %v", entry.path, err)
+			continue
+		}
+		_ = os.Remove(metaPathFor(entry.path))
+		h.lru.remove(entry.path)
+		metrics.CacheEvictions.Inc("quota")
+		totalSize -= entry.size
+		evicted++
+	}
+	logging.Infof("Cache quota for %s exceeded: evicted %d entries, now using %d of %d bytes", hostOnly, evicted, totalSize, quota)
+}
+
+// domainDirName returns the filesystem-safe cache subdirectory name for a host.
+func domainDirName(host string) string {
+	hostOnly := strings.ToLower(stripPort(host))
+	safe := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, hostOnly)
+	if safe == "" || safe == "." || safe == ".." {
+		return "_"
+	}
+	return safe
+}
+
+// stripPort removes an optional port from a host[:port] string.
+func stripPort(hostPort string) string {
+	if host, _, err := net.SplitHostPort(hostPort); err == nil {
+		return host
+	}
+	return strings.Trim(hostPort, "[]")
+}
+
+// generateCacheKey creates a filesystem-safe cache key from method and URL,
+// as a path relative to the domain directory.
+func generateCacheKey(method string, u *url.URL, foldPath bool) string {
 	// Normalize: Use scheme, host, path, sorted query params
 	query := u.Query()
 	sortedQuery := query.Encode() // Sorts keys automatically
 
+	keyPath := u.Path
+	if foldPath {
+		keyPath = strings.ToLower(keyPath) // Case-insensitive origin (e.g. IIS), /Index.html is /index.html
+	}
 	keyData := fmt.Sprintf("%s:%s://%s%s?%s",
 		strings.ToUpper(method), // Ensure method is uppercase
 		strings.ToLower(u.Scheme),
 		strings.ToLower(u.Host),
-		u.Path,
+		keyPath,
 		sortedQuery,
 	)
 
@@ -198,8 +665,8 @@ func generateCacheKey(method string, u *url.URL) string {
 	// Add a prefix/extension for easier identification if needed
 	encoded := base64.URLEncoding.EncodeToString(hashBytes)
 
-	// Optional: Create subdirectories based on first few chars of hash?
-	// Improves performance with very large numbers of cache files.
-	// Example: return filepath.Join(encoded[:2], encoded[2:]) + ".cache"
-	return encoded + ".cache" // Simple flat structure for now
+	// Shard into two levels of subdirectories (e.g. "ab/cd/abcd....cache") so no
+	// single directory grows to hundreds of thousands of files. Entries from the
+	// old flat layout are never looked up again and simply age out.
+	return filepath.Join(encoded[:2], encoded[2:4], encoded+".cache")
 }
@@ -0,0 +1,197 @@
+package forwardproxy
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/config"
+)
+
+// newCachingHandler returns a proxy handler caching into a temp dir with the
+// given cache settings, and the origin it fetches from, which answers every
+// path with a 1000-byte body.
+func newCachingHandler(t *testing.T, cache config.CacheCfg) (*ProxyHandler, *httptest.Server) {
+	t.Helper()
+	return newCachingHandlerFor(t, cache, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		io.WriteString(w, strings.Repeat("x", 1000))
+	})
+}
+
+// newCachingHandlerFor is newCachingHandler with the origin answering through
+// originFunc.
+func newCachingHandlerFor(t *testing.T, cache config.CacheCfg, originFunc http.HandlerFunc) (*ProxyHandler, *httptest.Server) {
+	t.Helper()
+	origin := httptest.NewServer(originFunc)
+	t.Cleanup(origin.Close)
+
+	cache.Enabled = true
+	cache.CacheDir = t.TempDir()
+	if cache.CacheTTL == "" {
+		cache.CacheTTL = "1h"
+	}
+	h := NewHandler(config.ProxyConfig{Enabled: true, Cache: cache})
+	if h.cache == nil {
+		t.Fatal("cache was not enabled")
+	}
+	t.Cleanup(h.Close)
+	return h, origin
+}
+
+// cacheGet requests path through the cache and reports whether it was a hit.
+func cacheGet(t *testing.T, h *ProxyHandler, url string) bool {
+	t.Helper()
+	resp, _, hit, err := h.cache.ServeFromCacheOrFetch(httptest.NewRequest(http.MethodGet, url, nil))
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return hit
+}
+
+// cachedFile returns the body file of url's cache entry.
+func cachedFile(h *ProxyHandler, url string) string {
+	r := httptest.NewRequest(http.MethodGet, url, nil)
+	key := generateCacheKey(http.MethodGet, r.URL, false)
+	return filepath.Join(CacheDirFor(h.cache.cacheDirs, key), domainDirName(r.URL.Host), key)
+}
+
+func TestCacheMaxSizeEvictsLeastRecentlyUsed(t *testing.T) {
+	// Each entry is 1000 bytes of body plus its metadata, two fit under 3KB
+	h, origin := newCachingHandler(t, config.CacheCfg{MaxSize: "3KB"})
+	url := func(n string) string { return origin.URL + "/" + n }
+
+	cacheGet(t, h, url("a"))
+	cacheGet(t, h, url("b"))
+	if !cacheGet(t, h, url("a")) { // a is now more recently used than b
+		t.Fatal("a was not served from the cache")
+	}
+	cacheGet(t, h, url("c")) // Over the cap: b goes
+	cacheGet(t, h, url("d")) // Over the cap: a goes
+
+	for name, wantKept := range map[string]bool{"a": false, "b": false, "c": true, "d": true} {
+		path := cachedFile(h, url(name))
+		_, err := os.Stat(path)
+		if kept := err == nil; kept != wantKept {
+			t.Errorf("entry %s on disk = %v, want %v", name, kept, wantKept)
+		}
+		if _, err := os.Stat(metaPathFor(path)); (err == nil) != wantKept {
+			t.Errorf("metadata of %s on disk = %v, want %v", name, err == nil, wantKept)
+		}
+	}
+	if h.cache.lru.total > 3*1024 {
+		t.Errorf("cache uses %d bytes after eviction, cap is 3KB", h.cache.lru.total)
+	}
+}
+
+func TestCacheHitKeepsContentDisposition(t *testing.T) {
+	const disposition = `attachment; filename="x.tar.gz"`
+	h, origin := newCachingHandlerFor(t, config.CacheCfg{}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", disposition)
+		io.WriteString(w, "archive bytes")
+	})
+	url := origin.URL + "/download?id=7"
+
+	if cacheGet(t, h, url) {
+		t.Fatal("first download was a cache hit")
+	}
+	resp, body, hit, err := h.cache.ServeFromCacheOrFetch(httptest.NewRequest(http.MethodGet, url, nil))
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	resp.Body.Close()
+	if !hit {
+		t.Fatal("second download was not a cache hit")
+	}
+	if got := resp.Header.Get("Content-Disposition"); got != disposition {
+		t.Errorf("HIT Content-Disposition = %q, want %q", got, disposition)
+	}
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err != nil || params["filename"] != "x.tar.gz" {
+		t.Errorf("HIT filename = %q (err %v), want x.tar.gz", params["filename"], err)
+	}
+	if string(body) != "archive bytes" {
+		t.Errorf("HIT body = %q, want the stored download", body)
+	}
+}
+
+func TestCacheHitDropsSetCookie(t *testing.T) {
+	requests := 0
+	h, origin := newCachingHandlerFor(t, config.CacheCfg{}, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Add("Set-Cookie", fmt.Sprintf("session=client%d; HttpOnly", requests))
+		w.Header().Set("Cache-Control", "max-age=3600")
+		io.WriteString(w, "shared page")
+	})
+
+	get := func() (*http.Response, bool) {
+		resp, _, hit, err := h.cache.ServeFromCacheOrFetch(httptest.NewRequest(http.MethodGet, origin.URL+"/page", nil))
+		if err != nil {
+			t.Fatalf("GET /page: %v", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp, hit
+	}
+	first, hit := get()
+	if hit {
+		t.Fatal("first request was a cache hit")
+	}
+	if got := first.Header.Get("Set-Cookie"); got != "session=client1; HttpOnly" {
+		t.Errorf("MISS Set-Cookie = %q, want the origin's cookie", got)
+	}
+	second, hit := get()
+	if !hit {
+		t.Fatal("second request was not a cache hit")
+	}
+	if got := second.Header.Values("Set-Cookie"); len(got) != 0 {
+		t.Errorf("HIT replayed the first client's cookie: %q", got)
+	}
+}
+
+func TestCacheSkipsAuthorizedResponses(t *testing.T) {
+	requests := 0
+	h, origin := newCachingHandlerFor(t, config.CacheCfg{HonorHeaders: true}, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/public" {
+			w.Header().Set("Cache-Control", "public, max-age=3600")
+		} else {
+			w.Header().Set("Cache-Control", "max-age=3600")
+		}
+		io.WriteString(w, "report for "+r.Header.Get("Authorization"))
+	})
+
+	get := func(path, auth string) bool {
+		r := httptest.NewRequest(http.MethodGet, origin.URL+path, nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		resp, _, hit, err := h.cache.ServeFromCacheOrFetch(r)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return hit
+	}
+	get("/private", "Bearer alice")
+	if get("/private", "") {
+		t.Error("an anonymous request got the response stored for an Authorization request")
+	}
+	if requests != 2 {
+		t.Errorf("origin saw %d requests, want 2", requests)
+	}
+
+	get("/public", "Bearer alice")
+	if !get("/public", "") {
+		t.Error("a public response to an Authorization request was not cached")
+	}
+}
@@ -0,0 +1,35 @@
+package forwardproxy
+
+import (
+	"hash/fnv"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// CacheDirFor picks the directory of dirs an entry lives in. The choice hashes
+// the entry's key (its file name up to the first dot), so an entry's body,
+// metadata and temp files always land together, and any relative entry path
+// (e.g. from a cache archive) maps to the same directory the proxy reads from.
+// Changing the list moves keys around; entries left in the wrong directory are
+// never looked up again and age out through the cleaner.
+func CacheDirFor(dirs []string, entryPath string) string {
+	if len(dirs) == 1 {
+		return dirs[0]
+	}
+	key, _, _ := strings.Cut(filepath.Base(entryPath), ".")
+	hasher := fnv.New32a()
+	hasher.Write([]byte(key))
+	return dirs[hasher.Sum32()%uint32(len(dirs))]
+}
+
+// walkCacheDirs walks every cache directory in turn, stopping at the first
+// error fn returns.
+func walkCacheDirs(dirs []string, fn fs.WalkDirFunc) error {
+	for _, dir := range dirs {
+		if err := filepath.WalkDir(dir, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,26 +1,87 @@
 package forwardproxy
 
 import (
-	"bytes"
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"net/url" // Import url
+	"os"
 	"time"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/config"
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+	"github.com/mohammedhabas11/admin-bot/pkg/metrics"
 )
 
-// PerformFetch executes the outgoing HTTP request.
-func PerformFetch(origReq *http.Request) (resp *http.Response, bodyBytes []byte, err error) {
+// ErrUpstreamTimeout marks fetch errors caused by the origin not answering in time.
+var ErrUpstreamTimeout = errors.New("upstream timeout exceeded")
+
+// ErrDestinationBlocked marks fetches refused by the allow/deny lists or the
+// private network guard.
+var ErrDestinationBlocked = errors.New("destination blocked by proxy policy")
+
+// ErrResponseTooLarge marks origin responses whose body exceeds max-response-size.
+var ErrResponseTooLarge = errors.New("response exceeds max-response-size")
+
+// newDialer builds the dialer for outbound connections, bound to the
+// configured source address if one is set. With block-private-networks it
+// refuses to connect to private addresses.
+func newDialer(cfg config.ProxyConfig, timeout time.Duration) *net.Dialer {
+	dialer := &net.Dialer{
+		Timeout:   timeout, // Connection timeout
+		KeepAlive: 30 * time.Second,
+	}
+	sourceIP, err := cfg.GetSourceIP()
+	if err != nil {
+		logging.Warnf("Ignoring invalid outbound source address: %v", err)
+	} else if sourceIP != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: sourceIP}
+	}
+	if cfg.BlockPrivateNetworks {
+		dialer.Control = denyPrivateControl
+	}
+	return dialer
+}
+
+// newUpstreamTLSConfig builds the TLS client config for origins with or
+// without the tls overrides (insecure-skip-verify, ca-file) applied.
+// Returns nil to use Go's default verification.
+func newUpstreamTLSConfig(cfg config.ProxyConfig, withOverrides bool) *tls.Config {
+	tlsCfg := cfg.TLS
+	minVersion, err := config.ParseTLSVersion(tlsCfg.MinVersion)
+	if err != nil {
+		logging.Warnf("Ignoring invalid upstream TLS min-version: %v", err)
+	}
+	if !withOverrides && minVersion == 0 {
+		return nil
+	}
+
+	clientTLS := &tls.Config{MinVersion: minVersion} // Min version applies to every origin
+	if withOverrides {
+		rootCAs, err := tlsCfg.LoadCAPool()
+		if err != nil {
+			logging.Warnf("Ignoring upstream CA file: %v", err)
+		}
+		clientTLS.InsecureSkipVerify = tlsCfg.InsecureSkipVerify // Explicit operator opt-in
+		clientTLS.RootCAs = rootCAs
+	}
+	return clientTLS
+}
+
+// PerformFetch executes the outgoing HTTP request. resp.Body streams straight
+// from the origin and the caller must close it. transport is shared between
+// fetches so origin connections are reused.
+func PerformFetch(origReq *http.Request, cfg config.ProxyConfig, transport http.RoundTripper) (resp *http.Response, err error) {
 	// Create a new request based on the original request to avoid modifying it.
 	// The URL should already be absolute from HandleHTTP.
 	// Pass the original request's context to the new request.
 	outReq, err := http.NewRequestWithContext(origReq.Context(), origReq.Method, origReq.URL.String(), origReq.Body)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create outgoing request: %w", err)
+		return nil, fmt.Errorf("failed to create outgoing request: %w", err)
 	}
 
 	// Copy headers, filtering hop-by-hop headers
@@ -30,59 +91,120 @@ func PerformFetch(origReq *http.Request) (resp *http.Response, bodyBytes []byte,
 	outReq.Header.Del("Proxy-Authorization")
 	// Add/Modify headers if needed (e.g., Via header)
 	// outReq.Header.Add("Via", "admin-bot-proxy")
+	if cfg.ForwardedHeader {
+		addForwarded(outReq.Header, origReq)
+	}
 
 	// --- Configure Client to bypass proxy ---
-	// Use a shared client? For now, create per request. Consider pooling later.
-	client := &http.Client{
-		Timeout: 30 * time.Second, // Overall request timeout
-		Transport: &http.Transport{
-			Proxy: nil, // Explicitly disable proxy use for this client
-			// Copy settings from http.DefaultTransport for robustness
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second, // Connection timeout
-				KeepAlive: 30 * time.Second,
-			}).DialContext,
-			ForceAttemptHTTP2:     true,
-			MaxIdleConns:          100,
-			IdleConnTimeout:       90 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-		},
-		// Prevent auto-following redirects if you want the proxy to handle them
-		// CheckRedirect: func(req *http.Request, via []*http.Request) error {
-		//  return http.ErrUseLastResponse
-		// },
+	// The client is a cheap per-request wrapper, pooling happens in the shared transport
+	client := &http.Client{Transport: transport}
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(cfg.LocationRewrites) > 0 {
+			// Hand redirects back to the client so their (rewritten) Location is followed through the proxy
+			return http.ErrUseLastResponse
+		}
+		// Redirects are followed here, so they must not lead past the allow/deny lists
+		if !cfg.DestinationAllowed(req.URL.Host) {
+			return fmt.Errorf("redirect to %s: %w", req.URL.Host, ErrDestinationBlocked)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects") // Same limit as the default policy
+		}
+		return nil
 	}
 	// --- End Client Configuration ---
 
+	// Optional per-phase timings (DNS, connect, TLS, time to first byte)
+	var ft *fetchTrace
+	if cfg.Trace {
+		outReq, ft = withTrace(outReq)
+	}
+
 	// Execute the request
-	log.Printf("Fetching: %s %s", outReq.Method, outReq.URL)
+	logging.Debugf("Fetching: %s %s", outReq.Method, outReq.URL)
+	fetchStart := time.Now()
 	resp, err = client.Do(outReq)
+	if err == nil {
+		metrics.UpstreamFetchDuration.ObserveDuration(time.Since(fetchStart))
+	}
+	if ft != nil {
+		ft.log(outReq, err)
+	}
 	if err != nil {
 		// Check specifically for context deadline exceeded which indicates timeout
 		// Use errors.Is for robust error checking
 		// Need to check url.Error as client.Do wraps errors
 		var urlErr *url.Error
-		if errors.As(err, &urlErr) && errors.Is(urlErr.Err, context.DeadlineExceeded) {
-			return nil, nil, fmt.Errorf("failed to execute outgoing request to %s: timeout exceeded: %w", outReq.URL.Host, err)
+		if errors.As(err, &urlErr) && (urlErr.Timeout() || errors.Is(urlErr.Err, context.DeadlineExceeded)) {
+			return nil, fmt.Errorf("failed to execute outgoing request to %s: %w: %w", outReq.URL.Host, ErrUpstreamTimeout, err)
 		}
-		return nil, nil, fmt.Errorf("failed to execute outgoing request to %s: %w", outReq.URL.Host, err)
+		return nil, fmt.Errorf("failed to execute outgoing request to %s: %w", outReq.URL.Host, err)
 	}
 	// Note: resp.Body will be closed by the caller (HandleHTTP or ServeFromCacheOrFetch)
 
-	// Read the body bytes for caching purposes
-	bodyBytes, err = io.ReadAll(resp.Body)
+	// Reject origins sending excessive headers before buffering the body
+	if cfg.MaxResponseHeaders > 0 {
+		headerCount := 0
+		for _, vv := range resp.Header {
+			headerCount += len(vv)
+		}
+		if headerCount > cfg.MaxResponseHeaders {
+			resp.Body.Close()
+			return nil, fmt.Errorf("response from %s has %d headers, exceeding the limit of %d", outReq.URL.Host, headerCount, cfg.MaxResponseHeaders)
+		}
+	}
+
+	// Bound the body on both paths: refused up front when the origin announces
+	// too much, cut off with ErrResponseTooLarge when it sends more than announced
+	if maxBody, _ := cfg.GetMaxResponseSize(); maxBody > 0 {
+		if resp.ContentLength > maxBody {
+			resp.Body.Close()
+			return nil, fmt.Errorf("response from %s is %d bytes: %w (%d)", outReq.URL.Host, resp.ContentLength, ErrResponseTooLarge, maxBody)
+		}
+		resp.Body = &limitedBody{ReadCloser: resp.Body, remaining: maxBody}
+	}
+
+	return resp, nil // Caller streams resp.Body
+}
+
+// readBody reads an origin response body completely, marking timeouts with
+// ErrUpstreamTimeout.
+func readBody(body io.Reader, host string) ([]byte, error) {
+	data, err := io.ReadAll(body)
 	if err != nil {
-		log.Printf("WARN: Failed to read response body from %s: %v", outReq.URL.Host, err)
-		resp.Body.Close() // Close immediately if read failed
-		// Return error because we can't cache or serve incomplete body
-		return resp, nil, fmt.Errorf("failed to read response body: %w", err)
+		if errors.Is(err, context.Canceled) {
+			return nil, fmt.Errorf("failed to read response body: %w", err) // Client went away, logged by the caller
+		}
+		logging.Warnf("Failed to read response body from %s: %v", host, err)
+		if os.IsTimeout(err) {
+			return nil, fmt.Errorf("failed to read response body: %w: %w", ErrUpstreamTimeout, err)
+		}
+		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
-	// VERY IMPORTANT: Replace the original resp.Body with a new reader based on
-	// the bytes we just read, because the original reader is now drained.
-	resp.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	return data, nil
+}
 
-	return resp, bodyBytes, nil
+// limitedBody is an origin response body that fails with ErrResponseTooLarge
+// once more than its limit was read, so a partial body is never mistaken for
+// a complete one (and cached).
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, ErrResponseTooLarge
+	}
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1] // One byte past the limit is enough to tell
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n + int(b.remaining), ErrResponseTooLarge // Only the bytes within the limit
+	}
+	return n, err
 }
 
 // copyHeaders function needs to be accessible here if not moved to a utils package
@@ -0,0 +1,76 @@
+package forwardproxy
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/config"
+)
+
+func TestFetchReusesUpstreamConnection(t *testing.T) {
+	var newConns atomic.Int32
+	origin := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	origin.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	origin.Start()
+	defer origin.Close()
+
+	h := NewHandler(config.ProxyConfig{Enabled: true})
+	defer h.Close()
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, origin.URL+"/page", nil)
+		resp, _, err := h.fetch(req)
+		if err != nil {
+			t.Fatalf("fetch %d: %v", i+1, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close() // Returns the connection to the pool
+		if err != nil || string(body) != "hello" {
+			t.Fatalf("fetch %d: body %q, err %v", i+1, body, err)
+		}
+	}
+	if n := newConns.Load(); n != 1 {
+		t.Errorf("origin saw %d new connections for two fetches, want 1", n)
+	}
+}
+
+func TestReadUpToTimeout(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go pw.Write([]byte("partial")) // Then the origin stalls
+
+	start := time.Now()
+	_, _, err := readUpTo(pr, 0, "origin.test", 50*time.Millisecond)
+	if !errors.Is(err, ErrUpstreamTimeout) {
+		t.Fatalf("readUpTo error = %v, want ErrUpstreamTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("readUpTo returned after %v, the timeout was 50ms", elapsed)
+	}
+
+	data, complete, err := readUpTo(io.NopCloser(io.LimitReader(neverEnding('x'), 10)), 5, "origin.test", time.Second)
+	if err != nil || complete || len(data) != 6 {
+		t.Errorf("readUpTo over limit = %d bytes, complete %v, err %v; want 6 bytes, incomplete", len(data), complete, err)
+	}
+}
+
+// neverEnding is an endless stream of one byte.
+type neverEnding byte
+
+func (b neverEnding) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(b)
+	}
+	return len(p), nil
+}
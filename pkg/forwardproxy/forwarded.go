@@ -0,0 +1,60 @@
+package forwardproxy
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// forwardedElement builds this hop's RFC 7239 Forwarded element for r, e.g.
+// `for=192.0.2.60;proto=http;host=example.com`. Parameters that are unknown
+// (a synthetic refresh request has no client) are left out.
+func forwardedElement(r *http.Request) string {
+	var pairs []string
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]" // IPv6 nodes are bracketed, and so need quoting
+		}
+		pairs = append(pairs, "for="+forwardedValue(host))
+	}
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+	pairs = append(pairs, "proto="+proto)
+	if r.Host != "" {
+		pairs = append(pairs, "host="+forwardedValue(r.Host))
+	}
+	return strings.Join(pairs, ";")
+}
+
+// forwardedValue returns v as a token if it is one, else as a quoted-string.
+func forwardedValue(v string) string {
+	isToken := v != ""
+	for _, c := range v {
+		if !isTokenChar(c) {
+			isToken = false
+			break
+		}
+	}
+	if isToken {
+		return v
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+}
+
+// isTokenChar reports whether c may appear in an RFC 7230 token.
+func isTokenChar(c rune) bool {
+	return c < 0x7f && (c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		strings.ContainsRune("!#$%&'*+-.^_`|~", c))
+}
+
+// addForwarded appends this hop's element to any Forwarded header the client
+// already sent, as RFC 7239 asks of every proxy in a chain.
+func addForwarded(out http.Header, r *http.Request) {
+	element := forwardedElement(r)
+	if prior := strings.Join(out.Values("Forwarded"), ", "); prior != "" {
+		element = prior + ", " + element
+	}
+	out.Set("Forwarded", element)
+}
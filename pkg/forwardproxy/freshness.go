@@ -0,0 +1,107 @@
+package forwardproxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// originFreshness interprets an origin response's Cache-Control and Expires
+// headers. It reports whether the response may be stored at all (and if not,
+// why) and how long it stays fresh. A zero lifetime means the origin gave no
+// guidance and the configured cache-ttl applies.
+func originFreshness(header http.Header, now time.Time) (lifetime time.Duration, storable bool, reason string) {
+	directives := parseCacheControl(header.Values("Cache-Control"))
+
+	// no-cache would require revalidating on every use, which the cache
+	// can't do, so it's treated like no-store
+	for _, d := range []string{"no-store", "private", "no-cache"} {
+		if _, ok := directives[d]; ok {
+			return 0, false, "Cache-Control: " + d
+		}
+	}
+
+	// s-maxage is meant for shared caches like this one and wins over max-age
+	for _, d := range []string{"s-maxage", "max-age"} {
+		value, ok := directives[d]
+		if !ok {
+			continue
+		}
+		secs, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || secs < 0 {
+			return 0, false, "invalid Cache-Control: " + d + "=" + value
+		}
+		if secs == 0 {
+			return 0, false, "Cache-Control: " + d + "=0"
+		}
+		return time.Duration(secs) * time.Second, true, ""
+	}
+
+	if expiresStr := header.Get("Expires"); expiresStr != "" {
+		expires, err := http.ParseTime(expiresStr)
+		if err != nil {
+			return 0, false, "invalid Expires (means already expired)"
+		}
+		// Measure against the origin's own clock when it sent one
+		base := now
+		if date, err := http.ParseTime(header.Get("Date")); err == nil {
+			base = date
+		}
+		lifetime := expires.Sub(base)
+		if lifetime <= 0 {
+			return 0, false, "Expires is in the past"
+		}
+		return lifetime, true, ""
+	}
+
+	return 0, true, ""
+}
+
+// sharedStorable reports whether the response to a request with reqHeader may
+// be stored by this cache, which serves every client from the same entry. A
+// response to a request carrying Authorization is for that user alone unless
+// the origin marks it public, s-maxage or must-revalidate (RFC 9111 section
+// 3.5), whatever lifetime originFreshness finds in it.
+func sharedStorable(reqHeader, respHeader http.Header) (storable bool, reason string) {
+	if reqHeader.Get("Authorization") == "" {
+		return true, ""
+	}
+	directives := parseCacheControl(respHeader.Values("Cache-Control"))
+	for _, d := range []string{"public", "s-maxage", "must-revalidate"} {
+		if _, ok := directives[d]; ok {
+			return true, ""
+		}
+	}
+	return false, "request carried Authorization and the response isn't public"
+}
+
+// clientNoCache reports whether a client request asks for an end-to-end
+// reload: Cache-Control no-cache or max-age=0, or, from HTTP/1.0 clients that
+// send no Cache-Control at all, Pragma: no-cache (RFC 9111 section 5.4).
+func clientNoCache(header http.Header) bool {
+	if values := header.Values("Cache-Control"); len(values) > 0 {
+		directives := parseCacheControl(values)
+		_, noCache := directives["no-cache"]
+		return noCache || directives["max-age"] == "0"
+	}
+	_, noCache := parseCacheControl(header.Values("Pragma"))["no-cache"]
+	return noCache
+}
+
+// parseCacheControl splits Cache-Control header values into lowercase
+// directive names and their (unquoted) values.
+func parseCacheControl(values []string) map[string]string {
+	directives := make(map[string]string)
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			directives[name] = strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return directives
+}
@@ -0,0 +1,35 @@
+package forwardproxy
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSharedStorable(t *testing.T) {
+	tests := []struct {
+		auth         string
+		cacheControl string
+		want         bool
+	}{
+		{"", "max-age=3600", true},
+		{"", "", true},
+		{"Basic dXNlcjpwYXNz", "max-age=3600", false},
+		{"Bearer token", "", false},
+		{"Bearer token", "public, max-age=3600", true},
+		{"Bearer token", "s-maxage=600", true},
+		{"Bearer token", "max-age=60, must-revalidate", true},
+		{"Bearer token", "Public", true},
+	}
+	for _, tt := range tests {
+		req, resp := make(http.Header), make(http.Header)
+		if tt.auth != "" {
+			req.Set("Authorization", tt.auth)
+		}
+		if tt.cacheControl != "" {
+			resp.Set("Cache-Control", tt.cacheControl)
+		}
+		if got, _ := sharedStorable(req, resp); got != tt.want {
+			t.Errorf("sharedStorable(Authorization %q, Cache-Control %q) = %v, want %v", tt.auth, tt.cacheControl, got, tt.want)
+		}
+	}
+}
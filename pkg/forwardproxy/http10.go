@@ -0,0 +1,21 @@
+package forwardproxy
+
+import (
+	"net/http"
+)
+
+// isHTTP10 reports whether r came from an HTTP/1.0 (or older) client.
+func isHTTP10(r *http.Request) bool {
+	return !r.ProtoAtLeast(1, 1)
+}
+
+// prepareHTTP10 settles the connection handling for an HTTP/1.0 client before
+// any response is written. net/http keeps such a connection only if the client
+// sent "Connection: keep-alive" and the response length is known (it answers
+// with "Connection: keep-alive" then), and closes it after the response
+// otherwise. With keepAlive off every HTTP/1.0 connection is closed.
+func prepareHTTP10(w http.ResponseWriter, keepAlive bool) {
+	if !keepAlive {
+		w.Header().Set("Connection", "close")
+	}
+}
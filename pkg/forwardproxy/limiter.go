@@ -0,0 +1,109 @@
+package forwardproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrOriginBusy marks fetches refused because the origin's connection cap was
+// reached and no slot freed up within the queue timeout.
+var ErrOriginBusy = errors.New("origin connection limit reached")
+
+// hostLimiter caps concurrent outbound fetches per origin host. Unlike the
+// transport's MaxConnsPerHost, waiting requests give up after a timeout or
+// when the client goes away.
+type hostLimiter struct {
+	max   int
+	wait  time.Duration         // How long a request queues for a slot (0 = fail immediately)
+	mu    sync.Mutex            // Protects slots and each slot's users
+	slots map[string]*hostSlots // Keyed by lowercase host:port, dropped once unused
+}
+
+// hostSlots is the semaphore for one host.
+type hostSlots struct {
+	sem   chan struct{}
+	users int // Requests holding or waiting for a slot
+}
+
+// newHostLimiter returns a limiter allowing max concurrent fetches per host,
+// or nil (no limit) if max is not positive.
+func newHostLimiter(max int, wait time.Duration) *hostLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &hostLimiter{max: max, wait: wait, slots: make(map[string]*hostSlots)}
+}
+
+// acquire takes a slot for host, queueing up to the configured wait. The
+// returned release func must be called once the fetch is done. A nil limiter
+// never blocks.
+func (l *hostLimiter) acquire(ctx context.Context, host string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	key := strings.ToLower(host)
+	l.mu.Lock()
+	hs, ok := l.slots[key]
+	if !ok {
+		hs = &hostSlots{sem: make(chan struct{}, l.max)}
+		l.slots[key] = hs
+	}
+	hs.users++
+	l.mu.Unlock()
+
+	release := func() {
+		<-hs.sem
+		l.leave(key, hs)
+	}
+	select {
+	case hs.sem <- struct{}{}:
+		return release, nil
+	default:
+	}
+	if l.wait <= 0 {
+		l.leave(key, hs)
+		return nil, fmt.Errorf("%w: %d concurrent fetches to %s", ErrOriginBusy, l.max, host)
+	}
+
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+	select {
+	case hs.sem <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		l.leave(key, hs)
+		return nil, fmt.Errorf("%w: no free slot for %s after %v", ErrOriginBusy, host, l.wait)
+	case <-ctx.Done():
+		l.leave(key, hs)
+		return nil, ctx.Err()
+	}
+}
+
+// leave drops one user of hs, forgetting the host once nobody holds or waits
+// for a slot, so hosts seen once don't stay in the map forever.
+func (l *hostLimiter) leave(key string, hs *hostSlots) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	hs.users--
+	if hs.users == 0 && l.slots[key] == hs {
+		delete(l.slots, key)
+	}
+}
+
+// releaseOnClose frees a limiter slot once a streamed response body is closed.
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releaseOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
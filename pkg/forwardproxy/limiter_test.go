@@ -0,0 +1,86 @@
+package forwardproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestHostLimiterForgetsIdleHosts(t *testing.T) {
+	l := newHostLimiter(1, 0)
+	for i := 0; i < 100; i++ {
+		release, err := l.acquire(context.Background(), fmt.Sprintf("host%d.example.com:443", i))
+		if err != nil {
+			t.Fatalf("acquire: %v", err)
+		}
+		release()
+	}
+	if n := len(l.slots); n != 0 {
+		t.Errorf("%d hosts tracked after every slot was released, want 0", n)
+	}
+}
+
+func TestHostLimiterCapAndWaiters(t *testing.T) {
+	l := newHostLimiter(1, time.Second)
+	ctx := context.Background()
+	release, err := l.acquire(ctx, "Example.com:443")
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	// A request that gives up while waiting doesn't drop the held slot
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := l.acquire(cancelled, "example.com:443"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("acquire with a cancelled context: err %v, want context.Canceled", err)
+	}
+	if n := len(l.slots); n != 1 {
+		t.Fatalf("%d hosts tracked while a slot is held, want 1", n)
+	}
+
+	// A waiter gets the slot once it's released, still capped at one
+	acquired := make(chan func())
+	go func() {
+		next, err := l.acquire(ctx, "example.com:443")
+		if err != nil {
+			t.Errorf("queued acquire: %v", err)
+			close(acquired)
+			return
+		}
+		acquired <- next
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("second fetch got a slot while the first still held it")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	next, ok := <-acquired
+	if !ok {
+		return
+	}
+	if n := len(l.slots); n != 1 {
+		t.Errorf("%d hosts tracked while the waiter holds the slot, want 1", n)
+	}
+	next()
+	if n := len(l.slots); n != 0 {
+		t.Errorf("%d hosts tracked after the last release, want 0", n)
+	}
+}
+
+func TestHostLimiterNoWait(t *testing.T) {
+	l := newHostLimiter(1, 0)
+	release, err := l.acquire(context.Background(), "example.com:80")
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if _, err := l.acquire(context.Background(), "example.com:80"); !errors.Is(err, ErrOriginBusy) {
+		t.Errorf("acquire over the cap: err %v, want ErrOriginBusy", err)
+	}
+	release()
+	if n := len(l.slots); n != 0 {
+		t.Errorf("%d hosts tracked after release, want 0", n)
+	}
+}
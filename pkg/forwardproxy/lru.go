@@ -0,0 +1,156 @@
+package forwardproxy
+
+import (
+	"container/list"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+	"github.com/mohammedhabas11/admin-bot/pkg/metrics"
+)
+
+// lruIndex tracks the on-disk size and last use of every cache entry so the
+// cache as a whole can be kept under max-size by evicting the least recently
+// used entries. File mtimes can't double as access times since they drive the
+// TTL, so recency is tracked in memory and seeded from mtimes at startup.
+type lruIndex struct {
+	maxSize int64
+
+	mu      sync.Mutex
+	total   int64                    // Bytes used by indexed entries (body + metadata)
+	order   *list.List               // Most recently used at the front, values are *lruEntry
+	entries map[string]*list.Element // Cache body path -> element in order
+}
+
+type lruEntry struct {
+	path string
+	size int64
+}
+
+// newLRUIndex builds the index from the entries already in cacheDirs, oldest
+// (by mtime) considered least recently used.
+func newLRUIndex(cacheDirs []string, maxSize int64) *lruIndex {
+	idx := &lruIndex{
+		maxSize: maxSize,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+
+	type existing struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var found []existing
+	_ = walkCacheDirs(cacheDirs, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".cache" {
+			return nil // Skip unreadable paths, directories and metadata files
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		found = append(found, existing{path: path, size: info.Size() + fileSize(metaPathFor(path)), modTime: info.ModTime()})
+		return nil
+	})
+	sort.Slice(found, func(i, j int) bool { return found[i].modTime.Before(found[j].modTime) })
+	for _, e := range found {
+		idx.add(e.path, e.size) // Oldest first, so the newest ends up in front
+	}
+	logging.Infof("Cache size cap %d bytes: %d existing entries use %d bytes", maxSize, len(found), idx.total)
+	return idx
+}
+
+// add records a newly written (or rewritten) entry as the most recently used.
+func (idx *lruIndex) add(path string, size int64) {
+	if idx == nil {
+		return
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if el, ok := idx.entries[path]; ok {
+		entry := el.Value.(*lruEntry)
+		idx.total += size - entry.size
+		entry.size = size
+		idx.order.MoveToFront(el)
+		return
+	}
+	idx.entries[path] = idx.order.PushFront(&lruEntry{path: path, size: size})
+	idx.total += size
+}
+
+// touch marks an entry as just used.
+func (idx *lruIndex) touch(path string) {
+	if idx == nil {
+		return
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if el, ok := idx.entries[path]; ok {
+		idx.order.MoveToFront(el)
+	}
+}
+
+// remove forgets an entry that was deleted from disk.
+func (idx *lruIndex) remove(path string) {
+	if idx == nil {
+		return
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeLocked(path)
+}
+
+func (idx *lruIndex) removeLocked(path string) {
+	if el, ok := idx.entries[path]; ok {
+		idx.total -= el.Value.(*lruEntry).size
+		idx.order.Remove(el)
+		delete(idx.entries, path)
+	}
+}
+
+// evict deletes least recently used entries until the cache fits max-size.
+// keep (the entry just written) is never evicted. Entries another process
+// (e.g. the cleaner) already deleted are simply dropped from the index.
+func (idx *lruIndex) evict(keep string) {
+	if idx == nil {
+		return
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	evicted, freed := 0, int64(0)
+	for el := idx.order.Back(); el != nil && idx.total > idx.maxSize; {
+		prev := el.Prev()
+		entry := el.Value.(*lruEntry)
+		if entry.path != keep {
+			if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+				logging.Warnf("Failed to evict cache file %s: %v", entry.path, err)
+				el = prev
+				continue
+			}
+			_ = os.Remove(metaPathFor(entry.path))
+			freed += entry.size
+			evicted++
+			metrics.CacheEvictions.Inc("max-size")
+			idx.removeLocked(entry.path)
+		}
+		el = prev
+	}
+	if evicted > 0 {
+		logging.Infof("Cache max-size %d exceeded: evicted %d least recently used entries (%d bytes), now using %d bytes", idx.maxSize, evicted, freed, idx.total)
+	}
+}
+
+// fileSize returns the size of the file at path, or 0 if it can't be read.
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
@@ -0,0 +1,116 @@
+package forwardproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+	"github.com/mohammedhabas11/admin-bot/pkg/metrics"
+)
+
+// metaExt is the extension of the metadata file stored next to each cache entry.
+const metaExt = ".meta"
+
+// cacheMeta describes a cache entry. Keys are hashed, so this is the only
+// place the original request URL can be recovered from. The body file holds
+// the raw bytes, the origin's status and headers are kept here.
+type cacheMeta struct {
+	URL      string      `json:"url"`
+	Method   string      `json:"method"`
+	StoredAt time.Time   `json:"stored_at"`
+	Status   int         `json:"status"`             // Origin status code, 0 in entries from before headers were stored
+	Header   http.Header `json:"header"`             // Origin response headers, minus hop-by-hop ones
+	Encoding string      `json:"encoding,omitempty"` // "gzip" if the body file is stored compressed
+
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // Freshness from the origin's Cache-Control/Expires, nil = cache-ttl applies
+}
+
+// metaPathFor returns the metadata file path for a cache entry path.
+func metaPathFor(cachePath string) string {
+	return strings.TrimSuffix(cachePath, filepath.Ext(cachePath)) + metaExt
+}
+
+// writeMeta stores the metadata for the cache entry at cachePath.
+func writeMeta(cachePath string, meta cacheMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache metadata: %w", err)
+	}
+	return writeFileAtomic(metaPathFor(cachePath), data, 0640)
+}
+
+// readMeta loads a metadata file.
+func readMeta(metaPath string) (cacheMeta, error) {
+	var meta cacheMeta
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return meta, err
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, fmt.Errorf("corrupt cache metadata %s: %w", metaPath, err)
+	}
+	return meta, nil
+}
+
+// EntryExpiry returns the origin-supplied expiry of the cache entry whose body
+// or metadata file is at path. ok is false when the entry has none (or its
+// metadata can't be read), in which case the configured cache-ttl applies.
+func EntryExpiry(path string) (expiresAt time.Time, ok bool) {
+	meta, err := readMeta(metaPathFor(path))
+	if err != nil || meta.ExpiresAt == nil {
+		return time.Time{}, false
+	}
+	return *meta.ExpiresAt, true
+}
+
+// PurgePrefix removes every cache entry whose original URL starts with prefix
+// (e.g. "https://example.com/assets/"). Returns the number of entries removed.
+func (h *CacheHandler) PurgePrefix(prefix string) (int, error) {
+	if prefix == "" {
+		return 0, errors.New("purge prefix cannot be empty")
+	}
+
+	purged := 0
+	err := walkCacheDirs(h.cacheDirs, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			logging.Warnf("Error accessing %s during cache purge: %v", path, err)
+			return nil // Keep purging what we can reach
+		}
+		if d.IsDir() || filepath.Ext(path) != metaExt {
+			return nil
+		}
+		meta, err := readMeta(path)
+		if err != nil {
+			logging.Warnf("Skipping unreadable cache metadata %s: %v", path, err)
+			return nil
+		}
+		if !strings.HasPrefix(meta.URL, prefix) {
+			return nil
+		}
+
+		entryPath := strings.TrimSuffix(path, metaExt) + ".cache"
+		if err := os.Remove(entryPath); err != nil && !os.IsNotExist(err) {
+			logging.Warnf("Failed to purge cache file %s: %v", entryPath, err)
+			return nil // Keep the metadata so the entry can still be found
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			logging.Warnf("Failed to remove cache metadata %s: %v", path, err)
+		}
+		h.lru.remove(entryPath)
+		metrics.CacheEvictions.Inc("purge")
+		purged++
+		return nil
+	})
+	if err != nil {
+		return purged, fmt.Errorf("cache purge walk failed: %w", err)
+	}
+	logging.Infof("Cache PURGED %d entries matching prefix %s", purged, prefix)
+	return purged, nil
+}
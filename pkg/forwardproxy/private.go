@@ -0,0 +1,73 @@
+package forwardproxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+)
+
+// privatePrefixes are internal ranges the netip predicates don't cover:
+// shared address space (carrier-grade NAT, also used by some clouds for
+// metadata and internal services) and IETF protocol assignments.
+var privatePrefixes = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"), // RFC 6598
+	netip.MustParsePrefix("192.0.0.0/24"),  // RFC 6890
+}
+
+// isPrivateAddr reports whether ip is loopback, private (RFC 1918), unique
+// local (fc00::/7), link-local (e.g. 169.254.169.254 metadata services),
+// unspecified (0.0.0.0 reaches the local host on most systems) or in one of
+// privatePrefixes.
+func isPrivateAddr(ip netip.Addr) bool {
+	ip = ip.Unmap() // ::ffff:10.0.0.1 is 10.0.0.1
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, prefix := range privatePrefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPrivateDestination resolves hostPort's host and refuses it if any of
+// the returned addresses is private, so a name with one public and one
+// internal record can't be used to reach the internal one.
+func checkPrivateDestination(ctx context.Context, hostPort string) error {
+	host := stripPort(hostPort)
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if isPrivateAddr(ip) {
+			return fmt.Errorf("%s is a private address: %w", host, ErrDestinationBlocked)
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil // Let the dial report the resolution failure (502)
+	}
+	for _, ip := range addrs {
+		if isPrivateAddr(ip) {
+			return fmt.Errorf("%s resolves to private address %s: %w", host, ip.Unmap(), ErrDestinationBlocked)
+		}
+	}
+	return nil
+}
+
+// denyPrivateControl is a net.Dialer Control hook refusing connections to
+// private addresses. It sees the address actually being dialed, so a DNS
+// answer that changes between checkPrivateDestination and the dial (DNS
+// rebinding) is still caught.
+func denyPrivateControl(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("unexpected dial address %q: %w", address, err)
+	}
+	if isPrivateAddr(addrPort.Addr()) {
+		return fmt.Errorf("dial to private address %s: %w", addrPort.Addr().Unmap(), ErrDestinationBlocked)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package forwardproxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestPrivateDestinations(t *testing.T) {
+	tests := []struct {
+		ip      string
+		blocked bool
+	}{
+		{"127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true}, // Cloud metadata
+		{"100.64.0.1", true},      // Shared address space
+		{"100.127.255.254", true},
+		{"192.0.0.8", true},
+		{"0.0.0.0", true},
+		{"::1", true},
+		{"fd00::1", true},
+		{"fe80::1", true},
+		{"::", true},
+		{"::ffff:10.0.0.1", true}, // IPv4-mapped
+		{"::ffff:169.254.169.254", true},
+		{"::ffff:127.0.0.1", true},
+		{"93.184.216.34", false},
+		{"100.128.0.1", false},
+		{"192.0.2.1", false},
+		{"2606:4700::6810:84e5", false},
+		{"::ffff:93.184.216.34", false},
+	}
+	for _, tt := range tests {
+		hostPort := net.JoinHostPort(tt.ip, "443")
+		err := checkPrivateDestination(context.Background(), hostPort)
+		if blocked := errors.Is(err, ErrDestinationBlocked); blocked != tt.blocked {
+			t.Errorf("checkPrivateDestination(%q) = %v, want blocked %v", hostPort, err, tt.blocked)
+		}
+		err = denyPrivateControl("tcp", hostPort, nil)
+		if blocked := errors.Is(err, ErrDestinationBlocked); blocked != tt.blocked {
+			t.Errorf("denyPrivateControl(%q) = %v, want blocked %v", hostPort, err, tt.blocked)
+		}
+	}
+}
+
+func TestCheckPrivateDestinationResolvesNames(t *testing.T) {
+	if err := checkPrivateDestination(context.Background(), "localhost:80"); !errors.Is(err, ErrDestinationBlocked) {
+		t.Errorf("checkPrivateDestination(localhost:80) = %v, want blocked", err)
+	}
+}
@@ -1,111 +1,400 @@
 package forwardproxy
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"io"
-	"log"
+	"io/fs"
+	"mime"
 	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/mohammedhabas11/admin-bot/pkg/accesslog"
+	"github.com/mohammedhabas11/admin-bot/pkg/compression"
 	"github.com/mohammedhabas11/admin-bot/pkg/config"
+	"github.com/mohammedhabas11/admin-bot/pkg/hostheader"
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+	"github.com/mohammedhabas11/admin-bot/pkg/metrics"
 )
 
 // ProxyHandler struct definition remains the same
 type ProxyHandler struct {
-	config config.ProxyConfig
-	cache  *CacheHandler
+	config      config.ProxyConfig
+	cache       *CacheHandler
+	timeoutPage *errorPage        // Optional custom 504 body for upstream timeouts
+	limiter     *hostLimiter      // Per-origin concurrency cap, nil when unlimited
+	transport   http.RoundTripper // Shared pooled transport for origin fetches
+	auth        *proxyAuth        // Proxy-Authorization checker, nil when auth is off
+
+	compressor     *compression.Compressor // Gzips relayed responses, nil when compression is off
+	tunnels        *tunnelRegistry         // Established CONNECT tunnels not yet closed
+	streamingTypes []string                // Lowercase media types relayed as streams, see SetStreamingTypes
+	tunnelIdle     time.Duration           // CONNECT tunnels without traffic this long are closed (0 = never)
 }
 
 // NewHandler function remains the same
 func NewHandler(cfg config.ProxyConfig) *ProxyHandler {
+	handler := &ProxyHandler{
+		config:      cfg,
+		timeoutPage: loadErrorPage(cfg.TimeoutPage),
+		transport:   newUpstreamTransport(cfg),
+		auth:        newProxyAuth(cfg.Auth),
+		tunnels:     newTunnelRegistry(),
+	}
+	if idle, err := cfg.GetTunnelIdleTimeout(); err != nil {
+		logging.Warnf("Invalid proxy tunnel-idle-timeout, tunnels won't time out: %v", err)
+	} else {
+		handler.tunnelIdle = idle
+	}
+	if cfg.MaxConnsPerHost > 0 {
+		queueTimeout, err := cfg.GetConnQueueTimeout()
+		if err != nil {
+			logging.Warnf("Invalid proxy conn-queue-timeout, not queueing: %v", err)
+		}
+		handler.limiter = newHostLimiter(cfg.MaxConnsPerHost, queueTimeout)
+		logging.Infof("Outbound fetches limited to %d concurrent per origin (queue timeout %s)", cfg.MaxConnsPerHost, queueTimeout)
+	}
+
 	var cacheInstance *CacheHandler = nil
-	if cfg.Cache.Enabled && cfg.Cache.CacheDir != "" {
+	if cacheDirs := cfg.Cache.GetCacheDirs(); cfg.Cache.Enabled && len(cacheDirs) > 0 {
 		cacheTTL, err := cfg.Cache.GetCacheTTL()
 		if err != nil {
-			log.Printf("WARNING: Invalid proxy cache TTL ('%s'), disabling caching: %v", cfg.Cache.CacheTTL, err)
+			logging.Warnf("Invalid proxy cache TTL ('%s'), disabling caching: %v", cfg.Cache.CacheTTL, err)
 		} else if cacheTTL <= 0 {
-			log.Printf("Proxy caching disabled due to TTL being zero or negative.")
+			logging.Infof("Proxy caching disabled due to TTL being zero or negative.")
 		} else {
-			fetchDelegate := func(r *http.Request) (*http.Response, []byte, error) {
-				// Pass bodyBytes back from PerformFetch, needed by cache handler
-				resp, body, err := PerformFetch(r)
-				return resp, body, err
+			cacheInstance = NewCacheHandler(cacheDirs, cacheTTL, handler.fetch)
+			if minSize, err := cfg.Cache.GetMinObjectSize(); err != nil {
+				logging.Warnf("Invalid proxy cache min-object-size, caching all sizes: %v", err)
+			} else {
+				cacheInstance.minObjectSize = minSize
+			}
+			if fillTimeout, err := cfg.Timeouts.GetRequest(); err == nil {
+				cacheInstance.fillTimeout = fillTimeout
+			}
+			if maxSize, err := cfg.Cache.GetMaxObjectSize(); err != nil {
+				logging.Warnf("Invalid proxy cache max-object-size, not limiting: %v", err)
+			} else {
+				cacheInstance.maxObjectSize = maxSize
+			}
+			if ttls, err := cfg.Cache.GetDomainTTLs(); err != nil {
+				logging.Warnf("Invalid proxy cache domain-ttls, using cache-ttl for all domains: %v", err)
+			} else {
+				cacheInstance.domainTTLs = ttls
+			}
+			if quotas, err := cfg.Cache.GetDomainQuotas(); err != nil {
+				logging.Warnf("Invalid proxy cache domain-quotas, quotas disabled: %v", err)
+			} else {
+				cacheInstance.domainQuotas = quotas
 			}
-			cacheInstance = NewCacheHandler(cfg.Cache.CacheDir, cacheTTL, fetchDelegate)
-			log.Printf("Proxy caching enabled: Dir=%s, TTL=%s", cfg.Cache.CacheDir, cacheTTL)
+			cacheInstance.compress = cfg.Cache.Compress
+			cacheInstance.honorHeaders = cfg.Cache.HonorHeaders
+			if negTTL, err := cfg.Cache.GetNegativeTTL(); err != nil {
+				logging.Warnf("Invalid proxy cache negative-ttl, not caching error responses: %v", err)
+			} else {
+				cacheInstance.negativeTTL = negTTL
+				cacheInstance.negativeStatuses = cfg.Cache.NegativeStatuses
+			}
+			cacheInstance.ttlHeader = cfg.Cache.TTLHeader
+			if len(cfg.Cache.CaseInsensitivePaths) > 0 {
+				cacheInstance.foldPathCase = cfg.Cache.PathCaseInsensitive
+			}
+			cacheInstance.honorClientNoCache = cfg.Cache.HonorClientNoCache
+			if maxSize, err := cfg.Cache.GetMaxSize(); err != nil {
+				logging.Warnf("Invalid proxy cache max-size, not capping the cache: %v", err)
+			} else if maxSize > 0 {
+				cacheInstance.lru = newLRUIndex(cacheDirs, maxSize)
+			}
+			if ra := cfg.Cache.RefreshAhead; ra.Enabled {
+				window, errW := ra.GetWindow()
+				interval, errI := ra.GetInterval()
+				if errW != nil || errI != nil || window >= cacheTTL {
+					logging.Warnf("Invalid proxy cache refresh-ahead settings, refresh-ahead disabled")
+				} else {
+					cacheInstance.refresher = startRefresher(cacheInstance, window, interval, ra.MinHits)
+				}
+			}
+			logging.Infof("Proxy caching enabled: Dirs=%s, TTL=%s", strings.Join(cacheDirs, ","), cacheTTL)
 		}
 	} else {
-		log.Println("Proxy caching is disabled (globally, or no cache dir specified).")
+		logging.Infof("Proxy caching is disabled (globally, or no cache dir specified).")
+	}
+
+	handler.cache = cacheInstance
+	return handler
+}
+
+// SetStaleRetention keeps expired cache entries on disk for d past their
+// expiry (proxy-cache-cleanup.ttl) instead of deleting them when they are
+// next requested; the cleaner removes them later.
+func (h *ProxyHandler) SetStaleRetention(d time.Duration) {
+	if h.cache != nil {
+		h.cache.keepStale = d
+	}
+}
+
+// SetCompression makes HandleHTTP gzip relayed responses with c (nil turns
+// compression off). Bodies the origin or cache already encoded are sent as-is.
+func (h *ProxyHandler) SetCompression(c *compression.Compressor) {
+	h.compressor = c
+}
+
+// CacheStats reports the number of cache entries on disk and the bytes they
+// use (bodies and metadata). ok is false when caching is disabled.
+func (h *ProxyHandler) CacheStats() (files int64, bytes int64, ok bool) {
+	if h.cache == nil {
+		return 0, 0, false
 	}
+	_ = walkCacheDirs(h.cache.cacheDirs, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		ext := filepath.Ext(path)
+		if ext != ".cache" && ext != metaExt {
+			return nil // Temp files and anything else that isn't an entry
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if ext == ".cache" {
+			files++
+		}
+		bytes += info.Size()
+		return nil
+	})
+	return files, bytes, true
+}
 
-	return &ProxyHandler{
-		config: cfg,
-		cache:  cacheInstance,
+// Close stops the handler's background work (cache refresh-ahead) and drops
+// its idle upstream connections. Requests still in flight are unaffected.
+func (h *ProxyHandler) Close() {
+	if h.cache != nil {
+		h.cache.refresher.stopWorker()
+	}
+	if t, ok := h.transport.(interface{ CloseIdleConnections() }); ok {
+		t.CloseIdleConnections()
 	}
 }
 
+// Cache statuses of proxied requests, as counted in metrics and the access log.
+// Clients see them under the configured status-header name and values.
+const (
+	cacheStatusHit    = "HIT"
+	cacheStatusMiss   = "MISS"
+	cacheStatusBypass = "BYPASS"
+)
+
+// setCacheStatus sets the cache status header of the response, if one is
+// configured, with the configured value for status.
+func (h *ProxyHandler) setCacheStatus(w http.ResponseWriter, status string) {
+	sh := h.config.Cache.StatusHeader
+	if sh.Name == "" {
+		return
+	}
+	value := status
+	switch status {
+	case cacheStatusHit:
+		value = sh.Hit
+	case cacheStatusMiss:
+		value = sh.Miss
+	case cacheStatusBypass:
+		value = sh.Bypass
+	}
+	w.Header().Set(sh.Name, value)
+}
+
+// fetch performs an origin fetch within the per-host concurrency limit. The
+// response body is streamed (bodyBytes is nil) and the slot is held until the
+// caller closes it.
+func (h *ProxyHandler) fetch(r *http.Request) (*http.Response, []byte, error) {
+	release, err := h.limiter.acquire(r.Context(), r.URL.Host)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := PerformFetch(r, h.config, h.transport)
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+	return resp, nil, nil
+}
+
+// PurgeCachePrefix removes all cached entries whose URL starts with prefix.
+func (h *ProxyHandler) PurgeCachePrefix(prefix string) (int, error) {
+	if h.cache == nil {
+		return 0, errors.New("proxy caching is disabled")
+	}
+	return h.cache.PurgePrefix(prefix)
+}
+
 // HandleConnect method remains the same
 func (h *ProxyHandler) HandleConnect(w http.ResponseWriter, r *http.Request) {
-	log.Printf(">>> HandleConnect: Entered for target %s", r.URL.Host)
+	logging.Debugf("HandleConnect: Entered for target %s", r.URL.Host)
+	start := time.Now()
+	status := http.StatusOK // Reply status, for metrics and the access log
+	tunneled := false       // Established tunnels are access-logged when they close
+	defer func() {
+		metrics.ProxyRequests.Inc(http.MethodConnect, strconv.Itoa(status))
+		if !tunneled {
+			rec := accesslog.NewRecord(r, start)
+			rec.Status, rec.Duration = status, time.Since(start)
+			accesslog.Log(rec)
+		}
+	}()
+
+	if !h.auth.allowed(r) {
+		status = http.StatusProxyAuthRequired
+		h.auth.challenge(w, r)
+		return
+	}
+
 	targetHost := r.URL.Host // CONNECT request URI is the target host:port
 	if targetHost == "" {
-		log.Printf("ERROR: HandleConnect: Bad Request: CONNECT requires host:port target (URI: %s)", r.RequestURI)
+		logging.Errorf("HandleConnect: Bad Request: CONNECT requires host:port target (URI: %s)", r.RequestURI)
+		status = http.StatusBadRequest
 		http.Error(w, "Bad Request: CONNECT requires host:port target", http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("CONNECT request to %s", targetHost)
+	if !h.config.DestinationAllowed(targetHost) {
+		logging.Warnf("HandleConnect: Destination %s blocked by allow/deny lists", targetHost)
+		status = http.StatusForbidden
+		http.Error(w, "Forbidden: destination not allowed by proxy policy", http.StatusForbidden)
+		return
+	}
 
-	destConn, err := net.DialTimeout("tcp", targetHost, 15*time.Second)
+	if h.config.BlockPrivateNetworks {
+		if err := checkPrivateDestination(r.Context(), targetHost); err != nil {
+			logging.Warnf("HandleConnect: %v", err)
+			status = http.StatusForbidden
+			http.Error(w, "Forbidden: destination not allowed by proxy policy", http.StatusForbidden)
+			return
+		}
+	}
+
+	logging.Debugf("CONNECT request to %s", targetHost)
+
+	destConn, err := newDialer(h.config, 15*time.Second).Dial("tcp", targetHost)
+	if errors.Is(err, ErrDestinationBlocked) {
+		logging.Warnf("HandleConnect: %v", err) // Name re-resolved to a private address at dial time
+		status = http.StatusForbidden
+		http.Error(w, "Forbidden: destination not allowed by proxy policy", http.StatusForbidden)
+		return
+	}
 	if err != nil {
-		log.Printf("ERROR: HandleConnect: Failed to dial target %s: %v", targetHost, err)
+		logging.Errorf("HandleConnect: Failed to dial target %s: %v", targetHost, err)
+		status = http.StatusBadGateway
 		http.Error(w, "Failed to connect to target server: "+err.Error(), http.StatusBadGateway)
 		return
 	}
 
 	hijacker, ok := w.(http.Hijacker)
 	if !ok {
-		log.Println("ERROR: HandleConnect: Hijacking not supported by ResponseWriter")
+		logging.Errorf("HandleConnect: Hijacking not supported by ResponseWriter")
+		status = http.StatusInternalServerError
 		http.Error(w, "Internal Server Error: Hijacking not supported", http.StatusInternalServerError)
 		destConn.Close()
 		return
 	}
 	clientConn, _, err := hijacker.Hijack()
 	if err != nil {
-		log.Printf("ERROR: HandleConnect: Failed to hijack client connection: %v", err)
+		logging.Errorf("HandleConnect: Failed to hijack client connection: %v", err)
 		clientConn.Close()
 		destConn.Close()
 		return
 	}
 
-	_, err = clientConn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+	_, err = clientConn.Write(connectEstablishedResponse(h.config.ProxyAgent))
 	if err != nil {
-		log.Printf("ERROR: HandleConnect: Failed to send 200 OK to client for %s: %v", targetHost, err)
+		logging.Errorf("HandleConnect: Failed to send 200 OK to client for %s: %v", targetHost, err)
 		clientConn.Close()
 		destConn.Close()
 		return
 	}
 
-	log.Printf("Tunnel established for %s", targetHost)
+	logging.Debugf("Tunnel established for %s", targetHost)
+	tunneled = true
+	tun := h.tunnels.add(clientConn, destConn, h.tunnelIdle)
 
-	go transfer(destConn, clientConn, targetHost+" (server->client)")
-	go transfer(clientConn, destConn, targetHost+" (client->server)")
+	go transfer(destConn, clientConn, targetHost+" (server->client)", tun)
+	go func() {
+		// Either direction ending closes both connections, this one ends the tunnel
+		toClient := transfer(clientConn, destConn, targetHost+" (client->server)", tun)
+		h.tunnels.remove(tun)
+		rec := accesslog.NewRecord(r, start)
+		rec.Status, rec.Bytes, rec.Duration = status, toClient, time.Since(start)
+		accesslog.Log(rec)
+	}()
+}
+
+// connectEstablishedResponse builds the 200 reply to a CONNECT request,
+// optionally advertising the configured Proxy-Agent.
+func connectEstablishedResponse(proxyAgent string) []byte {
+	var b strings.Builder
+	b.WriteString("HTTP/1.1 200 Connection Established\r\n")
+	if proxyAgent != "" {
+		b.WriteString("Proxy-Agent: " + proxyAgent + "\r\n")
+	}
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
+
+// rejectSelfRequest answers a request targeting the proxy itself with the
+// configured status and message instead of proxying it.
+func (h *ProxyHandler) rejectSelfRequest(w http.ResponseWriter, r *http.Request) {
+	sr := h.config.SelfRequest
+	status := sr.Status
+	if status == 0 {
+		status = http.StatusNotFound
+	}
+	if sr.LogClient {
+		logging.Warnf("HandleHTTP: Detected potential self-request loop for %s %s from %s (User-Agent: %q). Returning %d.", r.Method, r.RequestURI, r.RemoteAddr, r.UserAgent(), status)
+	} else {
+		logging.Warnf("HandleHTTP: Detected potential self-request loop for %s %s. Returning %d.", r.Method, r.RequestURI, status)
+	}
+	message := sr.Message
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	http.Error(w, message, status)
 }
 
 // HandleHTTP handles standard HTTP GET, POST, etc. requests passed from the top-level handler.
 func (h *ProxyHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
 	// log.Printf(">>> HandleHTTP: Entered for %s %s", r.Method, r.RequestURI) // Optional Debug
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	w = rec
+	cacheStatus := "" // HIT, MISS or BYPASS once known, whatever the header says
+	defer func() {
+		metrics.ProxyRequests.Inc(r.Method, strconv.Itoa(rec.status))
+		entry := accesslog.NewRecord(r, start) // r.URL is absolute by now
+		entry.Status, entry.Bytes, entry.Duration = rec.status, rec.bytes, time.Since(start)
+		entry.CacheStatus = cacheStatus
+		accesslog.Log(entry)
+	}()
+
+	if !h.auth.allowed(r) {
+		h.auth.challenge(w, r)
+		return
+	}
 
 	// --- Check for self-request loop ---
 	// Get the server's listening address (this requires access to config, maybe pass it?)
 	// Or approximate by checking common loopback addresses.
 	// A more robust way is needed if Addr can be different from 0.0.0.0 or ::
-	serverHost := "localhost"                  // Approximation
-	serverPort := config.GetConfig().HTTP.Port // Get configured port
-	requestHostPort := r.Host                  // e.g., "localhost:8080" or "example.com"
+	serverHost := "localhost" // Approximation
+	requestHostPort := r.Host // e.g., "localhost:8080" or "example.com"
 
 	// Split host and port from request
 	reqHost, reqPortStr, _ := net.SplitHostPort(requestHostPort)
@@ -117,19 +406,43 @@ func (h *ProxyHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// Check if the request target appears to be the proxy itself
 	isLoopback := net.ParseIP(reqHost) != nil && net.ParseIP(reqHost).IsLoopback()
-	isSelfRequest := (reqHost == serverHost || isLoopback) && (reqPort == serverPort || reqPort == 0) // Port 0 means unspecified
+	isOwnPort := reqPort == 0 // Port 0 means unspecified
+	for _, l := range config.GetConfig().HTTP.GetListeners() {
+		isOwnPort = isOwnPort || reqPort == l.Port
+	}
+	isSelfRequest := (reqHost == serverHost || isLoopback) && isOwnPort
 
 	if isSelfRequest && !r.URL.IsAbs() { // Check if it's a relative request to self
-		log.Printf("WARN: HandleHTTP: Detected potential self-request loop for %s %s. Returning 404.", r.Method, r.RequestURI)
-		http.NotFound(w, r) // Return 404 instead of proxying
+		h.rejectSelfRequest(w, r)
 		return
 	}
 	// --- End self-request check ---
 
+	// For absolute-form requests the URL host is authoritative; check it against
+	// the Host header as sent, which net/http has replaced with the URL host in r.Host
+	if hostHeader, ok := hostheader.Lookup(r); ok && hostHeader != "" && !sameHost(r.URL, hostHeader) {
+		switch h.config.HostMismatch {
+		case config.HostMismatchReject:
+			logging.Warnf("HandleHTTP: Rejecting %s %s: Host header '%s' does not match URL host '%s'", r.Method, r.URL.String(), hostHeader, r.URL.Host)
+			http.Error(w, "Bad Request: Host header does not match request URL", http.StatusBadRequest)
+			return
+		case config.HostMismatchIgnore:
+			// Proxy to the URL host without comment
+		default: // config.HostMismatchLog
+			logging.Warnf("HandleHTTP: Host header '%s' does not match URL host '%s' for %s %s, using URL host", hostHeader, r.URL.Host, r.Method, r.URL.String())
+		}
+	}
+
 	// Reconstruct URL if necessary (for explicit proxy requests with relative paths)
 	if !r.URL.IsAbs() { // Only reconstruct if it's not already absolute
+		if r.Host == "" && isHTTP10(r) {
+			// HTTP/1.0 has no Host header, a proxy can only learn the destination from the URI
+			logging.Warnf("HandleHTTP: Bad Request: HTTP/1.0 request without an absolute URI (URI: %s)", r.RequestURI)
+			http.Error(w, "Bad Request: HTTP/1.0 proxy requests must use an absolute URI (GET http://host/path HTTP/1.0)", http.StatusBadRequest)
+			return
+		}
 		if r.Host == "" {
-			log.Printf("ERROR: HandleHTTP: Bad Request: Missing host information (URI: %s)", r.RequestURI)
+			logging.Errorf("HandleHTTP: Bad Request: Missing host information (URI: %s)", r.RequestURI)
 			http.Error(w, "Bad Request: Missing host information", http.StatusBadRequest)
 			return
 		}
@@ -139,69 +452,319 @@ func (h *ProxyHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
 		// log.Printf("DBG: HandleHTTP: Reconstructed relative URL for request: %s", r.URL.String()) // Optional Debug
 	}
 
-	// Check if caching is enabled and applicable for this domain
-	shouldCache := h.cache != nil && h.config.ShouldCacheDomain(r.URL.Host)
+	// Credentials in the URL are never forwarded as part of it (or cached under it)
+	hadCredentials := r.URL.User != nil
+	if hadCredentials {
+		switch h.config.URLCredentials {
+		case config.URLCredentialsReject:
+			logging.Warnf("HandleHTTP: Rejecting %s request to %s: credentials in the URL", r.Method, r.URL.Redacted())
+			http.Error(w, "Bad Request: credentials in the request URL are not allowed", http.StatusBadRequest)
+			return
+		case config.URLCredentialsStrip:
+			logging.Debugf("HandleHTTP: Stripping credentials from %s", r.URL.Redacted())
+			r.URL.User = nil
+		default: // config.URLCredentialsAuthorization
+			moveURLCredentials(r)
+		}
+	}
+
+	if h.config.NormalizePaths {
+		normalizeURLPath(r.URL)
+	}
+
+	if !h.config.DestinationAllowed(r.URL.Host) {
+		logging.Warnf("HandleHTTP: Destination %s blocked by allow/deny lists", r.URL.Host)
+		http.Error(w, "Forbidden: destination not allowed by proxy policy", http.StatusForbidden)
+		return
+	}
+	if h.config.BlockPrivateNetworks {
+		if err := checkPrivateDestination(r.Context(), r.URL.Host); err != nil {
+			h.writeFetchError(w, err)
+			return
+		}
+	}
+
+	// Check if caching is enabled and applicable for this domain/URL
+	shouldCache := h.cache != nil && h.config.ShouldCacheURL(r.URL) && !hadCredentials
 
 	var response *http.Response
+	var cachedBody []byte
 	var err error
 	var cacheHit bool
 
 	if shouldCache {
-		// Assign bodyBytes to the blank identifier '_' to ignore it
-		response, _, cacheHit, err = h.cache.ServeFromCacheOrFetch(r) // <-- Use _
+		response, cachedBody, cacheHit, err = h.cache.ServeFromCacheOrFetch(r)
 		if err != nil {
-			http.Error(w, "Proxy Error: "+err.Error(), http.StatusBadGateway)
+			h.writeFetchError(w, err)
 			return
 		}
 		if cacheHit {
-			w.Header().Set("X-Cache-Status", "HIT")
+			cacheStatus = cacheStatusHit
 		} else {
-			w.Header().Set("X-Cache-Status", "MISS")
+			cacheStatus = cacheStatusMiss
 		}
+		h.setCacheStatus(w, cacheStatus)
+		metrics.CacheRequests.Inc(cacheStatus)
 	} else {
-		w.Header().Set("X-Cache-Status", "BYPASS")
+		cacheStatus = cacheStatusBypass
+		h.setCacheStatus(w, cacheStatus)
+		metrics.CacheRequests.Inc(cacheStatus)
 		// Assign bodyBytes to the blank identifier '_' to ignore it
-		response, _, err = PerformFetch(r) // <-- Use _
+		response, _, err = h.fetch(r) // <-- Use _
 		if err != nil {
-			http.Error(w, "Proxy Error: "+err.Error(), http.StatusBadGateway)
+			h.writeFetchError(w, err)
 			return
 		}
 	}
 
 	if response == nil {
-		log.Printf("ERROR: HandleHTTP: Response is nil after fetch/cache check for %s", r.URL.String())
+		logging.Errorf("HandleHTTP: Response is nil after fetch/cache check for %s", r.URL.String())
 		http.Error(w, "Internal Proxy Error: Failed to get response", http.StatusInternalServerError)
 		return
 	}
 	defer response.Body.Close()
 
+	// Consume whatever the upstream fetch didn't (e.g. cache hits) so the
+	// inbound connection can be reused for the next request
+	if !drainRequestBody(r.Body) {
+		w.Header().Set("Connection", "close")
+	}
+	if h.config.ForceClose {
+		w.Header().Set("Connection", "close") // Client gets one request per connection
+	} else if isHTTP10(r) {
+		prepareHTTP10(w, h.config.HTTP10KeepAlive)
+	}
+
+	aborted := false
+	if h.compressor != nil {
+		cw := h.compressor.Wrap(w, r)
+		defer func() {
+			if !aborted { // A completed gzip stream would pass a cut off body as whole
+				cw.Close()
+			}
+		}()
+		w = cw
+	}
 	copyHeaders(w.Header(), response.Header)
+	h.setCacheStatus(w, cacheStatus) // Replaces a same-named origin header (e.g. a CDN's X-Cache)
+	if h.config.Cache.TTLHeader != "" {
+		w.Header().Del(h.config.Cache.TTLHeader) // Cache control for the proxy, not the client
+	}
+	if cacheHit && cachedBody != nil && response.StatusCode == http.StatusOK {
+		serveCachedContent(w, r, cachedBody) // Honors Range and conditional headers
+		return
+	}
+	h.rewriteLocation(w.Header(), response.StatusCode, r.URL)
+	streaming := h.isStreaming(response.Header.Get("Content-Type"))
+	if streaming {
+		clearDeadlines(w, r)
+	}
 	w.WriteHeader(response.StatusCode)
 
-	copiedBytes, err := io.Copy(w, response.Body)
+	var copiedBytes int64
+	if streaming {
+		copiedBytes, err = copyFlushing(w, response.Body)
+	} else {
+		copiedBytes, err = io.Copy(w, response.Body)
+	}
 	if err != nil {
+		if errors.Is(err, ErrResponseTooLarge) {
+			// The status is already out, abort the connection so the client
+			// can't take the truncated body for a complete one
+			logging.Warnf("HandleHTTP: Response for %s cut off after %d bytes: %v", r.URL.String(), copiedBytes, err)
+			aborted = true
+			panic(http.ErrAbortHandler)
+		}
 		if !isConnectionClosed(err) {
-			log.Printf("WARN: HandleHTTP: Error writing response body for %s after %d bytes: %v", r.URL.String(), copiedBytes, err)
+			logging.Warnf("HandleHTTP: Error writing response body for %s after %d bytes: %v", r.URL.String(), copiedBytes, err)
 		}
 	}
 }
 
+// serveCachedContent writes a cached 200 body through http.ServeContent, so
+// Range (206/416), If-Range and the If-None-Match/If-Modified-Since
+// preconditions are answered from disk. The stored headers must already be in
+// w; Last-Modified is always set on cache hits.
+func serveCachedContent(w http.ResponseWriter, r *http.Request, body []byte) {
+	modTime, _ := http.ParseTime(w.Header().Get("Last-Modified"))
+	w.Header().Del("Content-Length") // ServeContent sets it to the length actually sent
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(body))
+}
+
+// rewriteLocation applies the location-rewrites rules to a redirect's Location
+// header, so the client's follow-up request can be steered back through the
+// proxy. Relative targets are resolved against the request URL first.
+func (h *ProxyHandler) rewriteLocation(header http.Header, status int, reqURL *url.URL) {
+	if len(h.config.LocationRewrites) == 0 || status < 300 || status > 399 {
+		return
+	}
+	loc := header.Get("Location")
+	if loc == "" {
+		return
+	}
+	target, err := reqURL.Parse(loc)
+	if err != nil {
+		logging.Warnf("Not rewriting unparsable Location '%s' from %s: %v", loc, reqURL.String(), err)
+		return
+	}
+	if rewritten, ok := h.config.RewriteLocation(target.String()); ok {
+		logging.Debugf("Rewrote Location '%s' -> '%s'", loc, rewritten)
+		header.Set("Location", rewritten)
+	}
+}
+
+// moveURLCredentials removes the userinfo from r.URL and sends it as an
+// Authorization: Basic header instead, unless the client set its own.
+func moveURLCredentials(r *http.Request) {
+	user := r.URL.User
+	r.URL.User = nil
+	if r.Header.Get("Authorization") != "" {
+		logging.Debugf("HandleHTTP: Dropping URL credentials for %s, the request has an Authorization header", r.URL.String())
+		return
+	}
+	password, _ := user.Password()
+	r.SetBasicAuth(user.Username(), password)
+}
+
+// normalizeURLPath collapses duplicate slashes and resolves dot-segments in
+// u's path (e.g. "//a/./b" becomes "/a/b"), keeping any trailing slash and the
+// original percent-encoding.
+func normalizeURLPath(u *url.URL) {
+	escaped := u.EscapedPath()
+	if escaped == "" {
+		return
+	}
+	cleaned := path.Clean("/" + escaped)
+	if strings.HasSuffix(escaped, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	if cleaned == escaped {
+		return
+	}
+	unescaped, err := url.PathUnescape(cleaned)
+	if err != nil {
+		return // EscapedPath output always unescapes, keep the path as-is just in case
+	}
+	logging.Debugf("Normalized request path '%s' -> '%s'", escaped, cleaned)
+	u.Path = unescaped
+	u.RawPath = cleaned
+}
+
 // Helper functions (transfer, copyHeaders, isConnectionClosed, dumpRequest) remain the same
-// transfer copies data between two connections and closes them when done.
-func transfer(destination io.WriteCloser, source io.ReadCloser, direction string) {
+// errorPage is a preloaded response body for proxy error responses.
+type errorPage struct {
+	body        []byte
+	contentType string
+}
+
+// loadErrorPage reads an error page file, deriving its content type from the
+// extension (e.g. .html, .json). Returns nil if path is empty or unreadable.
+func loadErrorPage(path string) *errorPage {
+	if path == "" {
+		return nil
+	}
+	body, err := os.ReadFile(path)
+	if err != nil {
+		logging.Warnf("Failed to read proxy error page %s, using default: %v", path, err)
+		return nil
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = "text/plain; charset=utf-8"
+	}
+	return &errorPage{body: body, contentType: contentType}
+}
+
+// writeFetchError answers a failed upstream fetch: 504 (with the configured
+// page, if any) for timeouts, 503 when the origin's connection cap is
+// saturated, 502 for oversized responses and everything else, and nothing if the client already went away.
+func (h *ProxyHandler) writeFetchError(w http.ResponseWriter, err error) {
+	if errors.Is(err, context.Canceled) {
+		// The client disconnected, nobody is left to read an error page
+		logging.Infof("Client went away, upstream fetch cancelled: %v", err)
+		if rec, ok := w.(*statusRecorder); ok {
+			rec.status = statusClientClosedRequest
+		}
+		return
+	}
+	if errors.Is(err, ErrDestinationBlocked) {
+		logging.Warnf("%v", err)
+		http.Error(w, "Forbidden: destination not allowed by proxy policy", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, ErrResponseTooLarge) {
+		logging.Warnf("%v", err)
+		http.Error(w, "Bad Gateway: the upstream response is too large", http.StatusBadGateway)
+		return
+	}
+	if errors.Is(err, ErrOriginBusy) {
+		logging.Warnf("%v", err)
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Service Unavailable: too many concurrent requests to the origin", http.StatusServiceUnavailable)
+		return
+	}
+	if !errors.Is(err, ErrUpstreamTimeout) {
+		http.Error(w, "Proxy Error: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	logging.Warnf("Upstream timeout: %v", err)
+	if h.timeoutPage == nil {
+		http.Error(w, "Gateway Timeout: the upstream server did not respond in time", http.StatusGatewayTimeout)
+		return
+	}
+	w.Header().Set("Content-Type", h.timeoutPage.contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusGatewayTimeout)
+	w.Write(h.timeoutPage.body)
+}
+
+// maxDrainBytes caps how much unread request body is discarded to keep a
+// connection reusable; larger leftovers close the connection instead.
+const maxDrainBytes = 256 << 10
+
+// drainRequestBody discards any unread request body. Returns false if the
+// body could not be fully consumed and the connection should not be reused.
+func drainRequestBody(body io.ReadCloser) bool {
+	if body == nil || body == http.NoBody {
+		return true
+	}
+	n, err := io.Copy(io.Discard, io.LimitReader(body, maxDrainBytes+1))
+	if err != nil && !errors.Is(err, http.ErrBodyReadAfterClose) {
+		return false
+	}
+	return n <= maxDrainBytes
+}
+
+// transfer copies data between two connections of tun and closes them when
+// done, or when the tunnel has been idle for its timeout. Returns the number
+// of bytes copied.
+func transfer(destination, source net.Conn, direction string, tun *tunnel) int64 {
 	defer destination.Close()
 	defer source.Close()
 	// log.Printf("DBG: Starting transfer %s", direction) // Optional Debug
-	_, err := io.Copy(destination, source)
+	var n int64
+	var err error
+	if tun.idle > 0 {
+		n, err = tun.copyIdle(destination, source)
+	} else {
+		n, err = io.Copy(destination, source) // Can splice, without deadlines to keep
+	}
 	// log.Printf("DBG: Finished transfer %s (err: %v)", direction, err) // Optional Debug
+	if errors.Is(err, errTunnelIdle) {
+		logging.Infof("Closing tunnel %s: no traffic for %v", direction, tun.idle)
+		return n
+	}
 	if err != nil {
 		if !isConnectionClosed(err) { // Use helper to avoid logging expected closure errors
-			log.Printf("WARN: Error during transfer %s: %v", direction, err)
+			logging.Warnf("Error during transfer %s: %v", direction, err)
 		}
 	}
+	return n
 }
 
 // copyHeaders copies headers from source to destination, filtering hop-by-hop headers.
+// Every value of a multi-value header is kept, in the origin's order: Set-Cookie
+// in particular must never be folded into one line (RFC 6265 section 3).
 func copyHeaders(dst, src http.Header) {
 	hopByHopHeaders := map[string]struct{}{
 		"Connection":          {},
@@ -219,13 +782,32 @@ func copyHeaders(dst, src http.Header) {
 		if _, ok := hopByHopHeaders[http.CanonicalHeaderKey(k)]; ok {
 			continue
 		}
-		// Copy other headers
+		// Copy other headers, Add (not Set) keeps repeated headers like Set-Cookie
 		for _, v := range vv {
 			dst.Add(k, v)
 		}
 	}
 }
 
+// sameHost reports whether the Host header value refers to the same host as u,
+// ignoring case and the scheme's default port.
+func sameHost(u *url.URL, hostHeader string) bool {
+	return normalizeHostPort(u.Host, u.Scheme) == normalizeHostPort(hostHeader, u.Scheme)
+}
+
+// normalizeHostPort lowercases hostPort and strips the default port for scheme.
+func normalizeHostPort(hostPort, scheme string) string {
+	hostPort = strings.ToLower(hostPort)
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return strings.Trim(hostPort, "[]") // No port present
+	}
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
 // isConnectionClosed checks for common network errors indicating expected closure.
 func isConnectionClosed(err error) bool {
 	if err == nil {
@@ -260,3 +842,30 @@ func isConnectionClosed(err error) bool {
 // 	}
 // 	log.Printf("Request Dump:\n%s\n--------------------\n", string(dump))
 // }
+
+// statusClientClosedRequest is recorded (not sent) for requests whose client
+// disconnected before a response could be written, following nginx's 499.
+const statusClientClosedRequest = 499
+
+// statusRecorder remembers the status code and body bytes written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	n, err := sr.ResponseWriter.Write(b)
+	sr.bytes += int64(n)
+	return n, err
+}
+
+func (sr *statusRecorder) WriteHeader(code int) {
+	sr.status = code
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
@@ -0,0 +1,134 @@
+package forwardproxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/config"
+	"github.com/mohammedhabas11/admin-bot/pkg/hostheader"
+)
+
+// newTestProxy serves h's plain HTTP proxying on a local server and returns
+// a client sending its requests through it.
+func newTestProxy(t *testing.T, h *ProxyHandler) *http.Client {
+	t.Helper()
+	proxy := httptest.NewServer(http.HandlerFunc(h.HandleHTTP))
+	t.Cleanup(proxy.Close)
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := &http.Transport{Proxy: http.ProxyURL(proxyURL)}
+	t.Cleanup(transport.CloseIdleConnections)
+	return &http.Client{Transport: transport}
+}
+
+func TestSetCookieOrderKept(t *testing.T) {
+	cookies := []string{"a=1; Path=/", "b=2; HttpOnly", "c=3; Secure"}
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, c := range cookies {
+			w.Header().Add("Set-Cookie", c)
+		}
+		io.WriteString(w, "page")
+	}))
+	defer origin.Close()
+
+	h := NewHandler(config.ProxyConfig{
+		Enabled: true,
+		Domains: []string{"127.0.0.1"},
+		Cache: config.CacheCfg{
+			Enabled:       true,
+			CacheDir:      t.TempDir(),
+			CacheTTL:      "1h",
+			SkipQueryURLs: true, // So "?bypass" goes around the cache
+			StatusHeader:  config.CacheStatusHeaderConfig{Name: "X-Cache-Status", Hit: "HIT", Miss: "MISS", Bypass: "BYPASS"},
+		},
+	})
+	defer h.Close()
+	client := newTestProxy(t, h)
+
+	tests := []struct {
+		path        string
+		wantStatus  string
+		wantCookies []string
+	}{
+		{"/page", "MISS", cookies},
+		{"/page?bypass", "BYPASS", cookies},
+		{"/page", "HIT", nil}, // Cookies are never replayed from the cache
+	}
+	for _, tt := range tests {
+		resp, err := client.Get(origin.URL + tt.path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", tt.path, err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if got := resp.Header.Get("X-Cache-Status"); got != tt.wantStatus {
+			t.Errorf("GET %s: cache status %q, want %q", tt.path, got, tt.wantStatus)
+		}
+		if got := resp.Header.Values("Set-Cookie"); !slices.Equal(got, tt.wantCookies) {
+			t.Errorf("GET %s (%s): Set-Cookie %q, want %q", tt.path, tt.wantStatus, got, tt.wantCookies)
+		}
+	}
+}
+
+func TestHostMismatchPolicy(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "origin")
+	}))
+	defer origin.Close()
+	originHost := origin.Listener.Addr().String()
+
+	tests := []struct {
+		policy     string
+		hostHeader string
+		wantStatus int
+	}{
+		{config.HostMismatchReject, "b.example", http.StatusBadRequest},
+		{config.HostMismatchReject, originHost, http.StatusOK},
+		{config.HostMismatchReject, "", http.StatusOK}, // HTTP/1.0 style, nothing to compare
+		{config.HostMismatchLog, "b.example", http.StatusOK},
+		{config.HostMismatchIgnore, "b.example", http.StatusOK},
+	}
+	for _, tt := range tests {
+		h := NewHandler(config.ProxyConfig{Enabled: true, HostMismatch: tt.policy})
+		// Served like the real listeners, which record Host headers before net/http drops them
+		proxy := httptest.NewUnstartedServer(http.HandlerFunc(h.HandleHTTP))
+		proxy.Listener = hostheader.NewListener(proxy.Listener)
+		proxy.Config.ConnContext = hostheader.ConnContext
+		proxy.Start()
+
+		conn, err := net.Dial("tcp", proxy.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader := bufio.NewReader(conn)
+		// Twice on one connection: each request is matched with its own head.
+		// HTTP/1.0 has no Host header and gets its connection closed.
+		head, requests := "GET http://"+originHost+"/ HTTP/1.0\r\n\r\n", 1
+		if tt.hostHeader != "" {
+			head, requests = "GET http://"+originHost+"/ HTTP/1.1\r\nHost: "+tt.hostHeader+"\r\n\r\n", 2
+		}
+		for i := 0; i < requests; i++ {
+			io.WriteString(conn, head)
+			resp, err := http.ReadResponse(reader, nil)
+			if err != nil {
+				t.Fatalf("%s policy, Host %q: %v", tt.policy, tt.hostHeader, err)
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("%s policy, Host %q, request %d: status %d, want %d", tt.policy, tt.hostHeader, i+1, resp.StatusCode, tt.wantStatus)
+			}
+		}
+		conn.Close()
+		proxy.Close()
+		h.Close()
+	}
+}
@@ -0,0 +1,164 @@
+package forwardproxy
+
+import (
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+)
+
+// refresher proactively refetches hot cache entries shortly before their TTL
+// runs out, so clients keep hitting a fresh entry instead of paying for a MISS.
+// An entry is hot once it was served minHits times since it was last stored.
+type refresher struct {
+	cache    *CacheHandler
+	window   time.Duration // Refresh entries whose remaining TTL is below this
+	interval time.Duration // How often to scan the hot entries
+	minHits  int64
+
+	hits sync.Map      // Cache path -> *atomic.Int64 hits since last (re)store
+	stop chan struct{} // Closed to stop the worker
+	once sync.Once
+}
+
+// startRefresher starts the refresh-ahead worker for h. It runs until stop is called.
+func startRefresher(h *CacheHandler, window, interval time.Duration, minHits int) *refresher {
+	rf := &refresher{
+		cache:    h,
+		window:   window,
+		interval: interval,
+		minHits:  int64(minHits),
+		stop:     make(chan struct{}),
+	}
+	logging.Infof("Cache refresh-ahead enabled: Window=%s, Interval=%s, MinHits=%d", window, interval, minHits)
+	go rf.run()
+	return rf
+}
+
+// recordHit counts a cache hit for the entry at path. Safe on a nil refresher.
+func (rf *refresher) recordHit(path string) {
+	if rf == nil {
+		return
+	}
+	counter, _ := rf.hits.LoadOrStore(path, new(atomic.Int64))
+	counter.(*atomic.Int64).Add(1)
+}
+
+// stopWorker stops the worker. Safe to call more than once, and on a nil refresher.
+func (rf *refresher) stopWorker() {
+	if rf == nil {
+		return
+	}
+	rf.once.Do(func() { close(rf.stop) })
+}
+
+func (rf *refresher) run() {
+	ticker := time.NewTicker(rf.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			rf.refreshDue()
+		case <-rf.stop:
+			logging.Infof("Stopping cache refresh-ahead worker.")
+			return
+		}
+	}
+}
+
+// refreshDue refetches every hot entry that is within the window of expiring.
+// Entries that disappeared (expired, evicted, purged) stop being tracked.
+func (rf *refresher) refreshDue() {
+	refreshed, failed := 0, 0
+	rf.hits.Range(func(key, value any) bool {
+		path := key.(string)
+		fi, err := os.Stat(path)
+		if err != nil {
+			rf.hits.Delete(path) // Gone, the next MISS stores it again
+			return true
+		}
+		if value.(*atomic.Int64).Load() < rf.minHits {
+			return true // Not hot (yet)
+		}
+		expiresAt := fi.ModTime().Add(rf.cache.cacheTTL)
+		if exp, ok := EntryExpiry(path); ok {
+			expiresAt = exp
+		}
+		if time.Until(expiresAt) > rf.window {
+			return true // Not due yet
+		}
+		if rf.refresh(path) {
+			refreshed++
+			rf.hits.Delete(path) // Must prove itself hot again before the next refresh
+		} else {
+			failed++
+		}
+		select {
+		case <-rf.stop:
+			return false
+		default:
+			return true
+		}
+	})
+	if refreshed > 0 || failed > 0 {
+		logging.Infof("Cache refresh-ahead: refreshed %d entries, %d failed", refreshed, failed)
+	}
+}
+
+// refresh refetches one entry from its origin and stores it again, which also
+// restarts its TTL. Returns false if the entry couldn't be refreshed; the old
+// entry is then left to expire normally.
+func (rf *refresher) refresh(path string) bool {
+	h := rf.cache
+	meta, err := readMeta(metaPathFor(path))
+	if err != nil || meta.Status == 0 {
+		logging.Warnf("Cache refresh-ahead skipping %s: no usable metadata", path)
+		return false
+	}
+	req, err := http.NewRequest(http.MethodGet, meta.URL, nil)
+	if err != nil {
+		logging.Warnf("Cache refresh-ahead skipping %s: %v", meta.URL, err)
+		return false
+	}
+
+	resp, body, err := h.fetchOrigin(req)
+	if err != nil {
+		logging.Warnf("Cache refresh-ahead fetch failed for %s: %v", meta.URL, err)
+		return false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		logging.Warnf("Cache refresh-ahead for %s got status %d, keeping the current entry", meta.URL, resp.StatusCode)
+		return false
+	}
+	if body == nil {
+		var complete bool
+		body, complete, err = readUpTo(resp.Body, h.maxObjectSize, req.URL.Host, h.fillTimeout)
+		if err != nil {
+			logging.Warnf("Cache refresh-ahead failed reading %s: %v", meta.URL, err)
+			return false
+		}
+		if !complete {
+			logging.Infof("Cache refresh-ahead for %s: body now exceeds max-object-size %d, letting the entry expire", meta.URL, h.maxObjectSize)
+			return false
+		}
+	}
+
+	lifetime := time.Duration(0)
+	if h.honorHeaders {
+		var storable bool
+		var reason string
+		if lifetime, storable, reason = originFreshness(resp.Header, time.Now()); !storable {
+			logging.Infof("Cache refresh-ahead for %s: origin no longer allows caching (%s), letting the entry expire", meta.URL, reason)
+			return false
+		}
+	}
+	if !h.storeResponse(path, req.URL, meta.Method, resp, body, lifetime) {
+		return false
+	}
+	logging.Infof("Cache REFRESHED %s ahead of expiry", meta.URL)
+	return true
+}
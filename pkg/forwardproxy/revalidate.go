@@ -0,0 +1,155 @@
+package forwardproxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/compression"
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+)
+
+// revalidatedHeaders are the headers a 304 Not Modified may update on the
+// stored entry (RFC 9111 section 4.3.4), as far as this cache uses them.
+var revalidatedHeaders = []string{"Cache-Control", "Date", "ETag", "Expires", "Last-Modified"}
+
+// hasValidators reports whether a stored response can be revalidated with a
+// conditional request instead of being downloaded again.
+func hasValidators(meta cacheMeta) bool {
+	return meta.Status == http.StatusOK && (meta.Header.Get("ETag") != "" || meta.Header.Get("Last-Modified") != "")
+}
+
+// staleEntry returns the metadata of an expired entry at cachePath that is
+// still on disk and can be revalidated.
+func (h *CacheHandler) staleEntry(cachePath string) (cacheMeta, bool) {
+	if _, err := os.Stat(cachePath); err != nil {
+		return cacheMeta{}, false
+	}
+	meta, err := readMeta(metaPathFor(cachePath))
+	if err != nil || !hasValidators(meta) {
+		return cacheMeta{}, false
+	}
+	return meta, true
+}
+
+// revalidate asks the origin whether the stale entry at cachePath is still
+// current, using its ETag and Last-Modified. On 304 Not Modified the entry's
+// timestamps and freshness headers are renewed and the stored response is
+// returned with fresh=true. Any other answer is returned as a regular origin
+// response (fresh=false) and the stale entry is dropped, unless it's a server
+// error and stale entries are kept for the fallback; a 200 replaces it
+// through the normal store path.
+func (h *CacheHandler) revalidate(r *http.Request, cachePath string, meta cacheMeta) (resp *http.Response, body []byte, fresh bool, err error) {
+	condReq := r.Clone(r.Context())
+	condReq.Header.Del("If-None-Match") // Our validators, not the client's
+	condReq.Header.Del("If-Modified-Since")
+	if etag := meta.Header.Get("ETag"); etag != "" {
+		condReq.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := meta.Header.Get("Last-Modified"); lastModified != "" {
+		condReq.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	originResp, originBody, err := h.fetchOrigin(condReq)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if originResp.StatusCode != http.StatusNotModified {
+		if originResp.StatusCode < 500 || h.keepStale <= 0 {
+			h.removeEntry(cachePath) // A server error leaves it for the stale fallback
+		}
+		return originResp, originBody, false, nil
+	}
+	originResp.Body.Close()
+
+	for _, name := range revalidatedHeaders {
+		if values := originResp.Header.Values(name); len(values) > 0 {
+			meta.Header[name] = values
+		}
+	}
+	lifetime := time.Duration(0)
+	if ttl, ok := h.headerTTL(originResp.Header); ok && ttl > 0 {
+		lifetime = ttl // The 304 may set a new per-response TTL too
+	} else if h.honorHeaders {
+		var storable bool
+		var reason string
+		if lifetime, storable, reason = originFreshness(meta.Header, time.Now()); !storable {
+			// The entry may no longer be kept, so get a full response instead
+			logging.Infof("Cache entry %s may no longer be stored (%s), refetching", meta.URL, reason)
+			h.removeEntry(cachePath)
+			resp, body, err := h.fetchOrigin(r)
+			return resp, body, false, err
+		}
+	}
+	if err := h.renewEntry(cachePath, meta, lifetime); err != nil {
+		return nil, nil, false, fmt.Errorf("failed to renew revalidated cache entry: %w", err)
+	}
+	logging.Infof("Cache REVALIDATED %s (304 Not Modified)", meta.URL)
+
+	resp, body, found, err := h.serveFromCacheFile(cachePath, compression.AcceptsGzip(r), false)
+	if err != nil || !found {
+		return nil, nil, false, fmt.Errorf("revalidated cache entry %s could not be read back", cachePath)
+	}
+	return resp, body, true, nil
+}
+
+// renewEntry restarts the freshness lifetime of the entry at cachePath after a
+// successful revalidation, storing the updated metadata.
+func (h *CacheHandler) renewEntry(cachePath string, meta cacheMeta, lifetime time.Duration) error {
+	now := time.Now()
+	meta.StoredAt = now
+	meta.ExpiresAt = nil
+	if u, err := url.Parse(meta.URL); err == nil && lifetime <= 0 {
+		lifetime = h.domainTTL(u.Host)
+	}
+	if lifetime > 0 {
+		expiresAt := now.Add(lifetime)
+		meta.ExpiresAt = &expiresAt
+	}
+	if err := os.Chtimes(cachePath, now, now); err != nil { // cacheTTL and the cleaner go by mtime
+		return err
+	}
+	if err := writeMeta(cachePath, meta); err != nil {
+		return err
+	}
+	h.lru.touch(cachePath)
+	return nil
+}
+
+// removeEntry deletes a cache entry's body and metadata (best effort).
+func (h *CacheHandler) removeEntry(cachePath string) {
+	if err := os.Remove(cachePath); err != nil && !os.IsNotExist(err) {
+		logging.Warnf("Failed to remove cache file %s: %v", cachePath, err)
+	}
+	_ = os.Remove(metaPathFor(cachePath))
+	h.lru.remove(cachePath)
+}
+
+// staleFallback serves the expired entry at cachePath when the origin could
+// not be reached or answered with a server error, as long as the cleaner
+// still keeps it (proxy-cache-cleanup.ttl longer than cache-ttl). The origin
+// response, if any, is discarded. The reply carries "Warning: 111" so clients
+// can tell it's stale.
+func (h *CacheHandler) staleFallback(r *http.Request, cachePath string, originResp *http.Response, fetchErr error) (*http.Response, []byte, bool) {
+	if h.keepStale <= 0 {
+		return nil, nil, false
+	}
+	resp, body, found, err := h.serveFromCacheFile(cachePath, compression.AcceptsGzip(r), true)
+	if err != nil || !found {
+		return nil, nil, false
+	}
+	reason := fmt.Sprint(fetchErr)
+	if originResp != nil {
+		reason = originResp.Status
+		originResp.Body.Close()
+	}
+	logging.Warnf("Origin failed for %s (%s), serving stale cache entry", r.URL.String(), reason)
+	resp.Header.Add("Warning", `111 - "Revalidation Failed"`)
+	if r.Method == http.MethodHead {
+		resp.Body = http.NoBody
+		return resp, nil, true
+	}
+	return resp, body, true
+}
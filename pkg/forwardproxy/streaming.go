@@ -0,0 +1,75 @@
+package forwardproxy
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+)
+
+// SetStreamingTypes sets the media types (e.g. "text/event-stream") of
+// responses relayed as streams: exempt from the server's read and write
+// timeouts and flushed to the client as the origin sends them.
+func (h *ProxyHandler) SetStreamingTypes(types []string) {
+	h.streamingTypes = nil
+	for _, t := range types {
+		h.streamingTypes = append(h.streamingTypes, strings.ToLower(strings.TrimSpace(t)))
+	}
+}
+
+// isStreaming reports whether a response of contentType is relayed as a stream.
+func (h *ProxyHandler) isStreaming(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range h.streamingTypes {
+		if mediaType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// clearDeadlines lifts the connection's read and write deadlines for the rest
+// of the response, so http.timeouts.write (and read, whose expiry would cancel
+// the request) can't cut off a stream that legitimately runs for hours.
+func clearDeadlines(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		logging.Debugf("HandleHTTP: Can't lift write deadline for stream %s: %v", r.URL.String(), err)
+	}
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		logging.Debugf("HandleHTTP: Can't lift read deadline for stream %s: %v", r.URL.String(), err)
+	}
+}
+
+// copyFlushing copies src to w, flushing after every read so each event
+// reaches the client as soon as the origin sent it.
+func copyFlushing(w http.ResponseWriter, src io.Reader) (int64, error) {
+	rc := http.NewResponseController(w)
+	buf := make([]byte, 32<<10)
+	var written int64
+	for {
+		n, readErr := src.Read(buf)
+		if n > 0 {
+			m, err := w.Write(buf[:n])
+			written += int64(m)
+			if err != nil {
+				return written, err
+			}
+			if err := rc.Flush(); err != nil {
+				return written, err
+			}
+		}
+		if readErr == io.EOF {
+			return written, nil
+		}
+		if readErr != nil {
+			return written, readErr
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package forwardproxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+)
+
+// fetchTrace records the phase timings of one upstream fetch via httptrace.
+// Phases that didn't happen (e.g. DNS and connect on a reused connection) are
+// reported as "-".
+type fetchTrace struct {
+	mu         sync.Mutex // Callbacks may run on transport goroutines
+	start      time.Time
+	dnsStart   time.Time
+	dns        time.Duration
+	connStart  time.Time
+	connect    time.Duration
+	tlsStart   time.Time
+	tls        time.Duration
+	ttfb       time.Duration
+	reused     bool
+	remoteAddr string
+}
+
+// withTrace attaches a fetchTrace to req, returning the traced request.
+func withTrace(req *http.Request) (*http.Request, *fetchTrace) {
+	ft := &fetchTrace{start: time.Now()}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { ft.set(func() { ft.dnsStart = time.Now() }) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { ft.set(func() { ft.dns = time.Since(ft.dnsStart) }) },
+		ConnectStart: func(network, addr string) {
+			ft.set(func() {
+				if ft.connStart.IsZero() { // Happy Eyeballs may dial several addresses
+					ft.connStart = time.Now()
+				}
+			})
+		},
+		ConnectDone: func(network, addr string, err error) {
+			ft.set(func() {
+				if err == nil {
+					ft.connect = time.Since(ft.connStart)
+				}
+			})
+		},
+		TLSHandshakeStart: func() { ft.set(func() { ft.tlsStart = time.Now() }) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			ft.set(func() { ft.tls = time.Since(ft.tlsStart) })
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			ft.set(func() {
+				ft.reused = info.Reused
+				if info.Conn != nil {
+					ft.remoteAddr = info.Conn.RemoteAddr().String()
+				}
+			})
+		},
+		GotFirstResponseByte: func() { ft.set(func() { ft.ttfb = time.Since(ft.start) }) },
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace)), ft
+}
+
+func (ft *fetchTrace) set(fn func()) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	fn()
+}
+
+// log writes the recorded timings for the fetch of req.
+func (ft *fetchTrace) log(req *http.Request, err error) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+
+	phase := func(d time.Duration) string {
+		if d <= 0 {
+			return "-"
+		}
+		return d.Round(time.Microsecond).String()
+	}
+	fields := []string{
+		"dns=" + phase(ft.dns),
+		"connect=" + phase(ft.connect),
+		"tls=" + phase(ft.tls),
+		"ttfb=" + phase(ft.ttfb),
+		"total=" + phase(time.Since(ft.start)),
+		fmt.Sprintf("reused=%t", ft.reused),
+	}
+	if ft.remoteAddr != "" {
+		fields = append(fields, "remote="+ft.remoteAddr)
+	}
+	if err != nil {
+		fields = append(fields, fmt.Sprintf("error=%q", err.Error()))
+	}
+	logging.Infof("TRACE: %s %s %s", req.Method, req.URL, strings.Join(fields, " "))
+}
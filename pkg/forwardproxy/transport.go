@@ -0,0 +1,105 @@
+package forwardproxy
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/config"
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+)
+
+// upstreamTransport is the RoundTripper shared by every origin fetch, so
+// keep-alive connections are pooled across requests. Origins covered by the
+// tls overrides get their own pool, since a transport has a single TLS config,
+// and so do origins listed in http1-domains, which must not negotiate HTTP/2.
+type upstreamTransport struct {
+	cfg       config.ProxyConfig
+	plain     *http.Transport // Origins outside the tls overrides
+	overrides *http.Transport // Origins the tls overrides apply to, nil if none are set
+
+	// HTTP/1.1-only counterparts of plain and overrides for http1-domains,
+	// nil unless HTTP/2 is on and some domains opt out of it
+	plainHTTP1     *http.Transport
+	overridesHTTP1 *http.Transport
+}
+
+// newUpstreamTransport builds the shared outbound transport from cfg.
+func newUpstreamTransport(cfg config.ProxyConfig) *upstreamTransport {
+	t := &upstreamTransport{
+		cfg:   cfg,
+		plain: newHTTPTransport(cfg, newUpstreamTLSConfig(cfg, false), cfg.HTTP2),
+	}
+	withOverrides := cfg.TLS.InsecureSkipVerify || cfg.TLS.CAFile != ""
+	if withOverrides {
+		t.overrides = newHTTPTransport(cfg, newUpstreamTLSConfig(cfg, true), cfg.HTTP2)
+	}
+	if cfg.HTTP2 && len(cfg.HTTP1Domains) > 0 {
+		t.plainHTTP1 = newHTTPTransport(cfg, newUpstreamTLSConfig(cfg, false), false)
+		if withOverrides {
+			t.overridesHTTP1 = newHTTPTransport(cfg, newUpstreamTLSConfig(cfg, true), false)
+		}
+	}
+	return t
+}
+
+// newHTTPTransport builds one pooled transport with the configured timeouts.
+// Without http2 it speaks HTTP/1.1 only, even to origins offering h2.
+func newHTTPTransport(cfg config.ProxyConfig, tlsConfig *tls.Config, http2 bool) *http.Transport {
+	// Parse errors were rejected by validation, the zero value just disables a timeout
+	connectTimeout, _ := cfg.Timeouts.GetConnect()
+	tlsHandshakeTimeout, _ := cfg.Timeouts.GetTLSHandshake()
+	responseHeaderTimeout, _ := cfg.Timeouts.GetResponseHeader()
+	idleConnTimeout, _ := cfg.Timeouts.GetIdleConn()
+
+	maxHeaderBytes, err := cfg.GetMaxResponseHeaderSize()
+	if err != nil {
+		logging.Warnf("Invalid max response header size, using default: %v", err)
+		maxHeaderBytes = 1 << 20
+	}
+
+	t := &http.Transport{
+		Proxy: nil, // Explicitly disable proxy use for this client
+		// Copy settings from http.DefaultTransport for robustness
+		DialContext:            newDialer(cfg, connectTimeout).DialContext,
+		ForceAttemptHTTP2:      http2,
+		MaxIdleConns:           100,
+		MaxIdleConnsPerHost:    10, // The default of 2 churns connections to busy origins
+		IdleConnTimeout:        idleConnTimeout,
+		TLSHandshakeTimeout:    tlsHandshakeTimeout,
+		ExpectContinueTimeout:  1 * time.Second,
+		ResponseHeaderTimeout:  responseHeaderTimeout, // Time to first response headers
+		MaxResponseHeaderBytes: maxHeaderBytes,        // Transport errors out on oversized headers
+		TLSClientConfig:        tlsConfig,
+	}
+	if !http2 {
+		// A non-nil empty map keeps the transport from ever upgrading to h2
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return t
+}
+
+// RoundTrip sends req through the pool matching its origin's TLS and HTTP/2
+// settings.
+func (t *upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	withOverrides := t.overrides != nil && t.cfg.TLS.AppliesTo(req.URL.Host)
+	http1Only := t.plainHTTP1 != nil && !t.cfg.UpstreamHTTP2(req.URL.Host)
+	switch {
+	case withOverrides && http1Only:
+		return t.overridesHTTP1.RoundTrip(req)
+	case withOverrides:
+		return t.overrides.RoundTrip(req)
+	case http1Only:
+		return t.plainHTTP1.RoundTrip(req)
+	}
+	return t.plain.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of every pool.
+func (t *upstreamTransport) CloseIdleConnections() {
+	for _, pool := range []*http.Transport{t.plain, t.overrides, t.plainHTTP1, t.overridesHTTP1} {
+		if pool != nil {
+			pool.CloseIdleConnections()
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package forwardproxy
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errTunnelIdle ends a relay whose tunnel carried no bytes, either way, for
+// the tunnel idle timeout.
+var errTunnelIdle = errors.New("tunnel idle timeout")
+
+// tunnel is an established CONNECT tunnel: the hijacked client connection and
+// the connection to the target.
+type tunnel struct {
+	client     net.Conn
+	dest       net.Conn
+	idle       time.Duration // Close after this long without traffic (0 = never)
+	lastActive atomic.Int64  // UnixNano of the last bytes read from either end
+}
+
+// close closes both ends, ending the tunnel's transfer goroutines.
+func (t *tunnel) close() {
+	t.client.Close()
+	t.dest.Close()
+}
+
+// copyIdle copies src to dst like io.Copy, but gives up with errTunnelIdle
+// once neither direction of the tunnel has carried bytes for t.idle. Read
+// deadlines count from the last activity on either side, so a busy download
+// keeps a quiet upload direction alive.
+func (t *tunnel) copyIdle(dst, src net.Conn) (int64, error) {
+	buf := make([]byte, 32*1024)
+	var written int64
+	for {
+		deadline := time.Unix(0, t.lastActive.Load()).Add(t.idle)
+		if err := src.SetReadDeadline(deadline); err != nil {
+			return written, err
+		}
+		nr, rerr := src.Read(buf)
+		if nr > 0 {
+			t.lastActive.Store(time.Now().UnixNano())
+			nw, werr := dst.Write(buf[:nr])
+			written += int64(nw)
+			if werr != nil {
+				return written, werr
+			}
+		}
+		var netErr net.Error
+		switch {
+		case rerr == nil:
+		case errors.As(rerr, &netErr) && netErr.Timeout():
+			if time.Since(time.Unix(0, t.lastActive.Load())) < t.idle {
+				continue // The other direction moved bytes meanwhile
+			}
+			return written, errTunnelIdle
+		case errors.Is(rerr, io.EOF):
+			return written, nil
+		default:
+			return written, rerr
+		}
+	}
+}
+
+// tunnelRegistry tracks open CONNECT tunnels. They are hijacked connections
+// http.Server.Shutdown knows nothing about, so the registry is the only way
+// to close them on shutdown. It's shared by the handlers a reload replaces,
+// so tunnels opened before the reload are still reachable.
+type tunnelRegistry struct {
+	mu   sync.Mutex
+	open map[*tunnel]struct{}
+}
+
+func newTunnelRegistry() *tunnelRegistry {
+	return &tunnelRegistry{open: make(map[*tunnel]struct{})}
+}
+
+// add registers a tunnel between client and dest, closed after idle without
+// traffic if positive.
+func (r *tunnelRegistry) add(client, dest net.Conn, idle time.Duration) *tunnel {
+	t := &tunnel{client: client, dest: dest, idle: idle}
+	t.lastActive.Store(time.Now().UnixNano())
+	r.mu.Lock()
+	r.open[t] = struct{}{}
+	r.mu.Unlock()
+	return t
+}
+
+// remove forgets a tunnel once its transfers have finished.
+func (r *tunnelRegistry) remove(t *tunnel) {
+	r.mu.Lock()
+	delete(r.open, t)
+	r.mu.Unlock()
+}
+
+// count returns the number of open tunnels.
+func (r *tunnelRegistry) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.open)
+}
+
+// closeAll closes every open tunnel and returns how many there were. They
+// leave the registry as their transfers notice the closed connections.
+func (r *tunnelRegistry) closeAll() int {
+	r.mu.Lock()
+	open := make([]*tunnel, 0, len(r.open))
+	for t := range r.open {
+		open = append(open, t)
+	}
+	r.mu.Unlock()
+
+	for _, t := range open {
+		t.close()
+	}
+	return len(open)
+}
+
+// ActiveTunnels returns how many CONNECT tunnels are currently open.
+func (h *ProxyHandler) ActiveTunnels() int64 {
+	return int64(h.tunnels.count())
+}
+
+// CloseAllTunnels closes every open CONNECT tunnel, for shutdown, and
+// returns how many were closed.
+func (h *ProxyHandler) CloseAllTunnels() int {
+	return h.tunnels.closeAll()
+}
+
+// InheritTunnels makes h track its tunnels together with those of old, the
+// handler it replaces, so CloseAllTunnels and ActiveTunnels still cover
+// tunnels opened before a reload. Must be called before h serves requests.
+func (h *ProxyHandler) InheritTunnels(old *ProxyHandler) {
+	if old != nil {
+		h.tunnels = old.tunnels
+	}
+}
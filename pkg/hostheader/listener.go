@@ -0,0 +1,252 @@
+// Package hostheader records the Host header of absolute-form HTTP/1.x
+// requests ("GET http://a.example/ HTTP/1.1") as the client sent it. net/http
+// replaces r.Host with the URL host for such requests and drops the header
+// before any handler runs, so a proxy can't otherwise tell whether the two
+// disagreed.
+//
+// Connections are wrapped at the listener and their request heads scanned as
+// net/http reads them, skipping bodies by Content-Length or chunked framing.
+// Only plaintext listeners can be scanned: over TLS the listener sees
+// encrypted bytes, and HTTP/2 has no absolute-form requests.
+package hostheader
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxHead caps the request head the scanner will buffer. net/http refuses
+// heads larger than its MaxHeaderBytes (1MB by default) anyway.
+const maxHead = 1 << 20
+
+// maxPending caps the recorded heads of a connection whose requests aren't
+// looked up (e.g. served by a handler other than the proxy).
+const maxPending = 16
+
+// Listener wraps a net.Listener so accepted connections record the Host
+// header of their absolute-form requests.
+type Listener struct {
+	net.Listener
+}
+
+// NewListener wraps inner. Serve with ConnContext so handlers can use Lookup.
+func NewListener(inner net.Listener) *Listener {
+	return &Listener{Listener: inner}
+}
+
+// Accept waits for the next connection and wraps it.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{Conn: conn}, nil
+}
+
+// head is what's recorded of one absolute-form request.
+type head struct {
+	method, target string
+	host           string
+}
+
+// scanner states
+const (
+	stateHead      = iota // Reading the request line and headers
+	stateBody             // Skipping remaining Content-Length bytes
+	stateChunkSize        // Reading a chunk-size line
+	stateChunkData        // Skipping remaining chunk bytes
+	stateChunkEnd         // Reading the CRLF closing a chunk
+	stateTrailer          // Reading trailer lines up to the empty line
+	stateDone             // Not HTTP/1.x request heads any more (CONNECT, Upgrade, h2c, parse error)
+)
+
+// Conn is a connection whose request heads are scanned as they're read.
+type Conn struct {
+	net.Conn
+
+	// Scanner state, only touched by Read (which net/http never calls concurrently)
+	state     int
+	line      []byte   // Current, incomplete line
+	lines     []string // Lines of the current head
+	headSize  int      // Bytes buffered for the current head
+	remaining int64    // Bytes left in a body or chunk
+
+	mu      sync.Mutex
+	pending []head
+}
+
+// Read reads from the connection, scanning what was read.
+func (c *Conn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 && c.state != stateDone {
+		c.scan(b[:n])
+	}
+	return n, err
+}
+
+// scan advances the scanner over data.
+func (c *Conn) scan(data []byte) {
+	for len(data) > 0 && c.state != stateDone {
+		if c.state == stateBody || c.state == stateChunkData {
+			skip := min(int64(len(data)), c.remaining)
+			data = data[skip:]
+			if c.remaining -= skip; c.remaining == 0 {
+				if c.state == stateBody {
+					c.state = stateHead
+				} else {
+					c.state = stateChunkEnd
+				}
+			}
+			continue
+		}
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			c.appendLine(data)
+			return
+		}
+		c.appendLine(data[:i])
+		data = data[i+1:]
+		line := string(bytes.TrimSuffix(c.line, []byte("\r")))
+		c.line = c.line[:0]
+		c.endLine(line)
+	}
+}
+
+func (c *Conn) appendLine(data []byte) {
+	if c.headSize += len(data); c.headSize > maxHead {
+		c.state = stateDone
+		return
+	}
+	c.line = append(c.line, data...)
+}
+
+// endLine handles one complete line in the line-based states.
+func (c *Conn) endLine(line string) {
+	if c.state != stateHead {
+		c.headSize = 0 // Chunk and trailer lines are capped one at a time
+	}
+	switch c.state {
+	case stateHead:
+		if line != "" {
+			c.lines = append(c.lines, line)
+		} else if len(c.lines) > 0 { // Empty lines before a request line are ignored
+			c.endHead()
+		}
+		if len(c.lines) == 0 {
+			c.headSize = 0
+		}
+	case stateChunkSize:
+		sizeStr, _, _ := strings.Cut(line, ";") // Chunk extensions
+		size, err := strconv.ParseInt(strings.TrimSpace(sizeStr), 16, 64)
+		switch {
+		case err != nil || size < 0:
+			c.state = stateDone
+		case size == 0:
+			c.state = stateTrailer
+		default:
+			c.state, c.remaining = stateChunkData, size
+		}
+	case stateChunkEnd:
+		c.state = stateChunkSize
+	case stateTrailer:
+		if line == "" {
+			c.state = stateHead
+		}
+	}
+}
+
+// endHead records the head just read and sets up skipping its body.
+func (c *Conn) endHead() {
+	lines := c.lines
+	c.lines = c.lines[:0]
+	method, rest, ok1 := strings.Cut(lines[0], " ")
+	target, proto, ok2 := strings.Cut(rest, " ")
+	if !ok1 || !ok2 || !strings.HasPrefix(proto, "HTTP/1.") || method == http.MethodConnect {
+		c.state = stateDone // HTTP/2 preface, garbage, or a tunnel follows
+		return
+	}
+
+	var host string
+	var contentLength int64
+	chunked := false
+	for _, line := range lines[1:] {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch http.CanonicalHeaderKey(strings.TrimSpace(name)) {
+		case "Host":
+			host = value
+		case "Upgrade":
+			c.state = stateDone // The connection is handed over to another protocol
+			return
+		case "Transfer-Encoding":
+			chunked = chunked || strings.Contains(strings.ToLower(value), "chunked")
+		case "Content-Length":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				c.state = stateDone
+				return
+			}
+			contentLength = n
+		}
+	}
+
+	if strings.Contains(target, "://") {
+		c.mu.Lock()
+		if len(c.pending) >= maxPending {
+			c.pending = c.pending[1:]
+		}
+		c.pending = append(c.pending, head{method: method, target: target, host: host})
+		c.mu.Unlock()
+	}
+	switch {
+	case chunked:
+		c.state = stateChunkSize
+	case contentLength > 0:
+		c.state, c.remaining = stateBody, contentLength
+	}
+}
+
+// take returns the Host header recorded for the oldest pending request with
+// method and target, dropping it and any older heads.
+func (c *Conn) take(method, target string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, h := range c.pending {
+		if h.method == method && h.target == target {
+			c.pending = c.pending[i+1:]
+			return h.host, true
+		}
+	}
+	return "", false
+}
+
+type connKey struct{}
+
+// ConnContext is an http.Server ConnContext hook making the connection
+// available to Lookup.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	if conn, ok := c.(*Conn); ok {
+		return context.WithValue(ctx, connKey{}, conn)
+	}
+	return ctx
+}
+
+// Lookup returns the Host header an absolute-form request was sent with
+// ("" if it had none). ok is false when it isn't known: the request isn't
+// absolute-form, arrived on a connection that isn't scanned, or was already
+// looked up.
+func Lookup(r *http.Request) (host string, ok bool) {
+	conn, _ := r.Context().Value(connKey{}).(*Conn)
+	if conn == nil || !r.URL.IsAbs() {
+		return "", false
+	}
+	return conn.take(r.Method, r.RequestURI)
+}
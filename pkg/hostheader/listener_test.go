@@ -0,0 +1,75 @@
+package hostheader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// scanned feeds stream to a Conn in pieces of size bytes.
+func scanned(stream string, size int) *Conn {
+	c := &Conn{}
+	for len(stream) > 0 {
+		n := min(size, len(stream))
+		c.scan([]byte(stream[:n]))
+		stream = stream[n:]
+	}
+	return c
+}
+
+func TestScanRecordsAbsoluteFormHosts(t *testing.T) {
+	stream := "GET http://a.example/ HTTP/1.1\r\nHost: b.example\r\n\r\n" +
+		"GET /local HTTP/1.1\r\nHost: proxy.local\r\n\r\n" +
+		// The body looks like a request head and must be skipped
+		"POST http://a.example/form HTTP/1.1\r\nHost: a.example\r\nContent-Length: 46\r\n\r\n" +
+		"GET http://evil.example/ HTTP/1.1\r\nHost: x\r\n\r\n" +
+		"PUT http://a.example/up HTTP/1.1\r\nhost: C.example\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"1a;ext=1\r\nGET http://evil.example/\r\n\r\n0\r\nTrailer: x\r\n\r\n" +
+		"\r\nGET http://a.example/last HTTP/1.0\n\n"
+	for _, size := range []int{1, 7, len(stream)} {
+		c := scanned(stream, size)
+		want := []head{
+			{"GET", "http://a.example/", "b.example"},
+			{"POST", "http://a.example/form", "a.example"},
+			{"PUT", "http://a.example/up", "C.example"},
+			{"GET", "http://a.example/last", ""},
+		}
+		if len(c.pending) != len(want) {
+			t.Fatalf("read in %d-byte pieces: recorded %+v, want %+v", size, c.pending, want)
+		}
+		for i := range want {
+			if c.pending[i] != want[i] {
+				t.Errorf("read in %d-byte pieces: head %d = %+v, want %+v", size, i, c.pending[i], want[i])
+			}
+		}
+	}
+}
+
+func TestScanStopsAtTunnels(t *testing.T) {
+	c := scanned("CONNECT a.example:443 HTTP/1.1\r\nHost: a.example:443\r\n\r\n"+
+		"GET http://tunnelled.example/ HTTP/1.1\r\nHost: x\r\n\r\n", 5)
+	if c.state != stateDone || len(c.pending) != 0 {
+		t.Errorf("after CONNECT: state %d, recorded %+v, want done with nothing", c.state, c.pending)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	c := scanned("GET http://a.example/ HTTP/1.1\r\nHost: b.example\r\n\r\n"+
+		"GET http://a.example/ HTTP/1.1\r\nHost: a.example\r\n\r\n", 64)
+	ctx := ConnContext(context.Background(), c)
+	request := func(target string) *http.Request {
+		return httptest.NewRequest(http.MethodGet, target, nil).WithContext(ctx)
+	}
+	for _, want := range []string{"b.example", "a.example"} {
+		if host, ok := Lookup(request("http://a.example/")); !ok || host != want {
+			t.Errorf("Lookup = %q, %v, want %q, true", host, ok, want)
+		}
+	}
+	if _, ok := Lookup(request("http://a.example/")); ok {
+		t.Error("Lookup found a head for a request that was already looked up")
+	}
+	if _, ok := Lookup(request("/relative")); ok {
+		t.Error("Lookup found a head for an origin-form request")
+	}
+}
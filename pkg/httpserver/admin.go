@@ -0,0 +1,84 @@
+package httpserver
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/config"
+	"github.com/mohammedhabas11/admin-bot/pkg/forwardproxy"
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+)
+
+// AdminBaseUrlPath is the root path under which all admin endpoints are served.
+const AdminBaseUrlPath = "/admin/"
+
+// registerAdminRoutes sets up the token protected management endpoints.
+// proxyHandler may be nil when the forward proxy is disabled. absFallback
+// receives absolute-form requests that happen to hit an admin path.
+func registerAdminRoutes(mux *http.ServeMux, cfg config.AdminConfig, proxyHandler *forwardproxy.ProxyHandler, absFallback http.Handler) {
+	logging.Infof("Registering admin routes...")
+
+	mux.Handle(AdminBaseUrlPath+"cache", adminOnly(cfg.Token, absFallback, func(w http.ResponseWriter, r *http.Request) {
+		handleCachePurge(w, r, proxyHandler)
+	}))
+	logging.Infof("  Route '%scache' -> Cache purge (DELETE ?prefix=<url-prefix>)", AdminBaseUrlPath)
+}
+
+// adminOnly guards an admin endpoint. Absolute-form requests are proxy traffic
+// that merely share the path, so they go to absFallback (the proxy, when the
+// listener serves it) instead. Everything else must present the bearer token.
+func adminOnly(token string, absFallback http.Handler, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.IsAbs() {
+			absFallback.ServeHTTP(w, r)
+			return
+		}
+
+		presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			logging.Warnf("Rejected unauthorized admin request %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin-bot"`)
+			writeJSON(w, http.StatusUnauthorized, map[string]any{"error": "unauthorized"})
+			return
+		}
+		next(w, r)
+	})
+}
+
+// handleCachePurge serves DELETE /admin/cache?prefix=<url-prefix>.
+func handleCachePurge(w http.ResponseWriter, r *http.Request, proxyHandler *forwardproxy.ProxyHandler) {
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", http.MethodDelete)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method not allowed"})
+		return
+	}
+	prefix := r.URL.Query().Get("prefix")
+	if prefix == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "missing required 'prefix' query parameter"})
+		return
+	}
+	if proxyHandler == nil {
+		writeJSON(w, http.StatusConflict, map[string]any{"error": "forward proxy is disabled"})
+		return
+	}
+
+	purged, err := proxyHandler.PurgeCachePrefix(prefix)
+	if err != nil {
+		logging.Errorf("Cache purge for prefix %s failed: %v", prefix, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error(), "purged": purged})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"prefix": prefix, "purged": purged})
+}
+
+// writeJSON writes v as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.Warnf("Failed to write JSON response: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package httpserver
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/config"
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+)
+
+// Probe endpoints for load balancers and Kubernetes.
+const (
+	HealthzPath = "/healthz" // Liveness: the process is up and serving
+	ReadyzPath  = "/readyz"  // Readiness: listeners are bound and the cache dir is usable
+)
+
+// registerHealthRoutes sets up /healthz and /readyz. They're registered on the
+// mux ahead of the proxy fallback so probes are never forwarded upstream;
+// absolute-form requests for the same paths still go to absFallback.
+func (s *Server) registerHealthRoutes(mux *http.ServeMux, cfg *config.Config, absFallback http.Handler) {
+	var cacheDirs []string
+	if cfg.HTTP.ForwardProxy.Enabled && cfg.HTTP.ForwardProxy.Cache.Enabled {
+		cacheDirs = cfg.HTTP.ForwardProxy.Cache.GetCacheDirs()
+	}
+
+	probe := func(readiness bool) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.IsAbs() {
+				absFallback.ServeHTTP(w, r)
+				return
+			}
+			body := map[string]any{
+				"status":         "ok",
+				"uptime_seconds": int64(time.Since(s.started).Seconds()),
+			}
+			status := http.StatusOK
+			if len(cacheDirs) > 0 {
+				writable := true
+				for _, dir := range cacheDirs {
+					writable = writable && dirWritable(dir) // Any unwritable disk fails the cache
+				}
+				body["cache_dir_writable"] = writable
+				if readiness && !writable {
+					status = http.StatusServiceUnavailable
+				}
+			}
+			if readiness && !s.isReady() {
+				status = http.StatusServiceUnavailable
+			}
+			if status != http.StatusOK {
+				body["status"] = "unavailable"
+			}
+			writeJSON(w, status, body)
+		})
+	}
+	mux.Handle(HealthzPath, probe(false))
+	mux.Handle(ReadyzPath, probe(true))
+	logging.Infof("  Routes '%s', '%s' -> Liveness and readiness probes", HealthzPath, ReadyzPath)
+}
+
+// isReady reports whether the listeners are bound and serving.
+func (s *Server) isReady() bool {
+	select {
+	case <-s.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// dirWritable reports whether a file can be created in dir.
+func dirWritable(dir string) bool {
+	f, err := os.CreateTemp(dir, ".probe-*")
+	if err != nil {
+		return false
+	}
+	name := f.Name()
+	f.Close()
+	os.Remove(name)
+	return true
+}
@@ -0,0 +1,55 @@
+package httpserver
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/config"
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+)
+
+// defaultMaintenancePage is served when no custom page is configured or readable.
+const defaultMaintenancePage = `<!DOCTYPE html>
+<html>
+<head><title>Service Unavailable</title></head>
+<body>
+<h1>Down for maintenance</h1>
+<p>This service is undergoing planned maintenance. Please try again later.</p>
+</body>
+</html>
+`
+
+// maintenanceMiddleware answers every request with a 503 maintenance page,
+// except requests whose path matches one of the configured exempt prefixes.
+func maintenanceMiddleware(next http.Handler, cfg config.MaintenanceConfig) http.Handler {
+	page := []byte(defaultMaintenancePage)
+	if cfg.Page != "" {
+		data, err := os.ReadFile(cfg.Page)
+		if err != nil {
+			logging.Warnf("Failed to read maintenance page %s, using built-in page: %v", cfg.Page, err)
+		} else {
+			page = data
+		}
+	}
+	logging.Infof("Maintenance mode is ENABLED. Exempt paths: %v", cfg.ExemptPaths)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, prefix := range cfg.ExemptPaths {
+			if prefix != "" && strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		if cfg.RetryAfter != "" {
+			w.Header().Set("Retry-After", cfg.RetryAfter)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if r.Method != http.MethodHead {
+			w.Write(page)
+		}
+	})
+}
@@ -0,0 +1,44 @@
+package httpserver
+
+import (
+	"net/http"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/forwardproxy"
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+	"github.com/mohammedhabas11/admin-bot/pkg/metrics"
+)
+
+// registerMetricsRoute serves the Prometheus metrics at path. proxyHandler
+// may be nil when the forward proxy is disabled. Like admin routes,
+// absolute-form requests for the same path are proxy traffic and go to absFallback.
+func registerMetricsRoute(mux *http.ServeMux, path string, proxyHandler *forwardproxy.ProxyHandler, absFallback http.Handler) {
+	mux.Handle(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.IsAbs() {
+			absFallback.ServeHTTP(w, r)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		handleMetrics(w, proxyHandler)
+	}))
+	logging.Infof("  Route '%s' -> Prometheus metrics", path)
+}
+
+// handleMetrics writes the package counters plus the gauges sampled now.
+func handleMetrics(w http.ResponseWriter, proxyHandler *forwardproxy.ProxyHandler) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.WriteAll(w)
+	metrics.WriteCounter(w, "adminbot_cache_corrupt_reads_total",
+		"Cache entries discarded because they couldn't be read back intact.", float64(forwardproxy.CacheCorruptReads()))
+	if proxyHandler == nil {
+		return
+	}
+	metrics.WriteGauge(w, "adminbot_proxy_tunnels_active", "CONNECT tunnels currently open.", float64(proxyHandler.ActiveTunnels()))
+	if files, bytes, ok := proxyHandler.CacheStats(); ok {
+		metrics.WriteGauge(w, "adminbot_cache_files", "Cache entries currently on disk.", float64(files))
+		metrics.WriteGauge(w, "adminbot_cache_size_bytes", "Disk space used by cache entries and their metadata.", float64(bytes))
+	}
+}
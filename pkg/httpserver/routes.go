@@ -0,0 +1,30 @@
+package httpserver
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/config"
+)
+
+// routeTable maps configured path prefixes to the handler they are pinned to.
+type routeTable []config.RouteConfig
+
+// newRouteTable returns the routes sorted longest prefix first, so match
+// finds the most specific one.
+func newRouteTable(routes []config.RouteConfig) routeTable {
+	t := append(routeTable(nil), routes...)
+	sort.SliceStable(t, func(i, j int) bool { return len(t[i].Prefix) > len(t[j].Prefix) })
+	return t
+}
+
+// match returns the handler (config.FeatureProxy or config.FeatureStatic) of
+// the longest prefix matching path.
+func (t routeTable) match(path string) (handler string, ok bool) {
+	for _, rt := range t {
+		if strings.HasPrefix(path, rt.Prefix) {
+			return rt.Handler, true
+		}
+	}
+	return "", false
+}
@@ -4,92 +4,304 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"net"
 	"net/http"
-
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/mohammedhabas11/admin-bot/pkg/accesslog"
+	"github.com/mohammedhabas11/admin-bot/pkg/compression"
 	"github.com/mohammedhabas11/admin-bot/pkg/config"
 	"github.com/mohammedhabas11/admin-bot/pkg/forwardproxy"
+	"github.com/mohammedhabas11/admin-bot/pkg/hostheader"
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+	"github.com/mohammedhabas11/admin-bot/pkg/proxyprotocol"
 	"github.com/mohammedhabas11/admin-bot/pkg/staticfiles"
 )
 
 type Server struct {
 	initialConfig *config.Config
-	server        *http.Server
+	listeners     []*listener   // One per configured listener, in config order
+	ready         chan struct{} // Closed once the listeners are bound
+	startErr      chan error    // Receives an error if no listener could bind
+	started       time.Time     // For the uptime reported by health probes
+	stopped       chan struct{} // Closed by Stop, ends Start
+	stopOnce      sync.Once
+
+	shutdownTimeout atomic.Int64 // time.Duration Stop waits for in-flight requests, updated on Reload
+
+	proxyHandler atomic.Pointer[forwardproxy.ProxyHandler] // Shared proxy of the current handlers, nil if disabled
+	inFlight     atomic.Int64                              // Requests being served (hijacked CONNECTs count as tunnels instead)
+}
+
+// ErrNoListeners is returned by Start (and WaitReady) when not a single
+// configured listener could be bound.
+var ErrNoListeners = errors.New("no HTTP listener could be started")
+
+// listener is a single bound address together with the handler it serves.
+type listener struct {
+	cfg         config.ListenerConfig
+	server      *http.Server
+	rootHandler atomic.Value // Current http.Handler, swappable via Reload
 }
 
 // NewServer creates a new Server instance but doesn't start it yet.
 func NewServer(cfg *config.Config) *Server {
-	return &Server{
+	s := &Server{
 		initialConfig: cfg,
+		ready:         make(chan struct{}),
+		startErr:      make(chan error, 1),
+		started:       time.Now(),
+		stopped:       make(chan struct{}),
 	}
+	s.setShutdownTimeout(cfg)
+	return s
 }
 
-// createRootHandler builds the main handler.
-// It intercepts CONNECT requests for the proxy.
+// setShutdownTimeout stores the shutdown timeout of cfg, falling back to the
+// default if it's invalid.
+func (s *Server) setShutdownTimeout(cfg *config.Config) {
+	timeout, err := cfg.HTTP.GetShutdownTimeout()
+	if err != nil {
+		logging.Warnf("Invalid shutdown timeout, using default: %v", err)
+		timeout = 15 * time.Second
+	}
+	s.shutdownTimeout.Store(int64(timeout))
+}
+
+// WaitReady blocks until the server's listeners are accepting connections,
+// the server fails to start, or the timeout elapses.
+func (s *Server) WaitReady(timeout time.Duration) error {
+	select {
+	case <-s.ready:
+		return nil
+	case err := <-s.startErr:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("timed out after %v waiting for HTTP server to listen", timeout)
+	}
+}
+
+// Reload rebuilds the request handlers (static routes, proxy, cache, admin...)
+// from cfg and swaps them in without touching the listeners. In-flight requests
+// finish on the old handlers. Listener settings (addr, port) need a restart.
+func (s *Server) Reload(cfg *config.Config) {
+	logging.Infof("Rebuilding HTTP handlers with new configuration...")
+	s.storeHandlers(cfg)
+	s.setShutdownTimeout(cfg)
+	logging.Infof("HTTP handlers reloaded.")
+}
+
+// storeHandlers builds each listener's root handler from cfg. The proxy (and
+// with it the cache) is created once and shared by every listener serving it.
+func (s *Server) storeHandlers(cfg *config.Config) {
+	if err := accesslog.Configure(cfg.HTTP.AccessLog); err != nil {
+		logging.Errorf("Access log not changed: %v", err)
+	}
+	var proxyHandler *forwardproxy.ProxyHandler
+	if cfg.HTTP.ForwardProxy.Enabled {
+		logging.Infof("Forward proxy is enabled.")
+		proxyHandler = forwardproxy.NewHandler(cfg.HTTP.ForwardProxy)
+		if keepStale, err := cfg.GetStaleRetention(); err == nil {
+			proxyHandler.SetStaleRetention(keepStale)
+		}
+		proxyHandler.SetCompression(compression.New(cfg.HTTP.Compression))
+		proxyHandler.SetStreamingTypes(cfg.HTTP.Timeouts.StreamingContentTypes)
+		proxyHandler.InheritTunnels(s.proxyHandler.Load()) // So Stop can still close tunnels opened before a reload
+	} else {
+		logging.Infof("Forward proxy is disabled.")
+	}
+
+	for _, l := range s.listeners {
+		l.rootHandler.Store(s.createRootHandler(cfg, l.cfg, proxyHandler))
+	}
+	if old := s.proxyHandler.Swap(proxyHandler); old != nil {
+		old.Close() // Stop the replaced proxy's background workers
+	}
+}
+
+// createRootHandler builds the main handler for one listener.
+// It intercepts CONNECT and absolute-form requests for the proxy.
 // All other requests are passed to a ServeMux which handles static files
 // and then falls back to the proxy's HTTP handler if enabled.
-func (s *Server) createRootHandler(cfg *config.Config) http.Handler {
+// Features the listener doesn't declare are never registered, so requests
+// for them get a 404 on that listener.
+func (s *Server) createRootHandler(cfg *config.Config, lc config.ListenerConfig, proxyHandler *forwardproxy.ProxyHandler) http.Handler {
 	// --- Create Handlers ---
 	requestMux := http.NewServeMux() // Mux for non-CONNECT requests
-	var specificProxyHandler *forwardproxy.ProxyHandler
+	addr := lc.Address()
 
-	// Register Static File Routes if enabled
-	if cfg.HTTP.Static.Enabled {
-		staticfiles.RegisterStaticRoutes(requestMux, cfg.HTTP.Static) // Register on requestMux
-	} else {
-		log.Println("Static file serving is disabled.")
+	serveStatic := cfg.HTTP.Static.Enabled && lc.ServesFeature(config.FeatureStatic)
+	serveAdmin := cfg.HTTP.Admin.Enabled && lc.ServesFeature(config.FeatureAdmin)
+	serveMetrics := cfg.HTTP.Metrics.Enabled && lc.ServesFeature(config.FeatureMetrics)
+	var specificProxyHandler *forwardproxy.ProxyHandler
+	if proxyHandler != nil && lc.ServesFeature(config.FeatureProxy) {
+		specificProxyHandler = proxyHandler
 	}
 
-	// Initialize Proxy Handler if enabled (needed for both CONNECT and HTTP fallback)
-	if cfg.HTTP.ForwardProxy.Enabled {
-		log.Println("Forward proxy is enabled.")
-		specificProxyHandler = forwardproxy.NewHandler(cfg.HTTP.ForwardProxy)
+	// Register Static File Routes if enabled. They get a mux of their own so
+	// routes pinned to static files never fall back to the proxy
+	staticMux := http.NewServeMux()
+	if serveStatic {
+		staticfiles.RegisterStaticRoutes(staticMux, cfg.HTTP.Static, compression.New(cfg.HTTP.Compression))
+	} else if cfg.HTTP.Static.Enabled {
+		logging.Infof("Static file serving is not exposed on listener %s.", addr)
+	}
 
+	var fallback http.Handler
+	if specificProxyHandler != nil {
 		// Register the proxy's HTTP handler as the fallback for the mux
-		requestMux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fallback = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// This function is called only if no /static/ route matched
-			log.Printf("DBG: Mux fallback: Routing to proxy handler for %s", r.URL.Path)
+			logging.Debugf("Mux fallback: Routing to proxy handler for %s", r.URL.Path)
 			specificProxyHandler.HandleHTTP(w, r)
 		})
-
 	} else {
-		log.Println("Forward proxy is disabled.")
-		// Add a default 404 handler to requestMux ONLY if proxy is also disabled
-		// This handles requests that don't match /static/
-		if !cfg.HTTP.Static.Enabled || len(cfg.HTTP.Static.Dirs) == 0 {
-			requestMux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-				log.Printf("No handler configured for path: %s", r.URL.Path)
+		if proxyHandler != nil {
+			logging.Infof("Forward proxy is not exposed on listener %s.", addr)
+		}
+		// Requests that don't match /static/ (or admin) end up here
+		fallback = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logging.Infof("No handler configured for path: %s (listener %s)", r.URL.Path, addr)
+			http.NotFound(w, r)
+		})
+	}
+	requestMux.Handle("/", fallback)
+	requestMux.Handle(staticfiles.StaticBaseUrlPath, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := staticMux.Handler(r); pattern != "" {
+			staticMux.ServeHTTP(w, r)
+			return
+		}
+		fallback.ServeHTTP(w, r) // No static dir matched
+	}))
+
+	// Routes pinned to one handler, looked up before the mux
+	routes := newRouteTable(cfg.HTTP.Routes)
+	routeHandlers := map[string]http.Handler{
+		config.FeatureStatic: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, pattern := staticMux.Handler(r); pattern == "" {
+				logging.Infof("No static dir for %s pinned to static files (listener %s)", r.URL.Path, addr)
 				http.NotFound(w, r)
-			})
-		} else {
-			// If static is enabled but proxy is disabled, requests not matching /static/
-			// should also result in 404. ServeMux handles this by default if "/" isn't explicitly handled.
-			// We could add an explicit 404 handler for "/" here too if desired.
-			requestMux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-				log.Printf("Path %s not found (no static match, proxy disabled)", r.URL.Path)
+				return
+			}
+			staticMux.ServeHTTP(w, r)
+		}),
+		config.FeatureProxy: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if specificProxyHandler == nil {
+				logging.Infof("Proxy not served for %s pinned to the proxy (listener %s)", r.URL.Path, addr)
 				http.NotFound(w, r)
-			})
-		}
+				return
+			}
+			specificProxyHandler.HandleHTTP(w, r)
+		}),
+	}
+
+	// Register admin endpoints (ServeMux prefers them over the "/" fallback)
+	if serveAdmin {
+		registerAdminRoutes(requestMux, cfg.HTTP.Admin, proxyHandler, fallback)
+	} else if cfg.HTTP.Admin.Enabled {
+		logging.Infof("Admin endpoints are not exposed on listener %s.", addr)
 	}
+	if cfg.HTTP.Health.Enabled {
+		s.registerHealthRoutes(requestMux, cfg, fallback)
+	}
+	if serveMetrics {
+		registerMetricsRoute(requestMux, cfg.HTTP.Metrics.Path, proxyHandler, fallback)
+	} else if cfg.HTTP.Metrics.Enabled {
+		logging.Infof("Metrics endpoint is not exposed on listener %s.", addr)
+	}
+
+	// Build the method allowlist (empty means every method is allowed)
+	allowedMethods := make(map[string]struct{}, len(cfg.HTTP.AllowedMethods))
+	for _, method := range cfg.HTTP.AllowedMethods {
+		allowedMethods[strings.ToUpper(method)] = struct{}{}
+	}
+	allowHeader := strings.ToUpper(strings.Join(cfg.HTTP.AllowedMethods, ", "))
 
 	// --- Top-Level Handler ---
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// 1. Handle CONNECT directly if proxy is enabled
-		if cfg.HTTP.ForwardProxy.Enabled && r.Method == http.MethodConnect {
-			if specificProxyHandler != nil {
-				specificProxyHandler.HandleConnect(w, r)
-			} else {
-				log.Printf("ERROR: Proxy enabled but handler is nil for CONNECT %s", r.RequestURI)
-				http.Error(w, "Proxy configuration error", http.StatusInternalServerError)
+	var rootHandler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 0. Enforce the method allowlist (CONNECT is governed by the proxy setting)
+		isProxyConnect := specificProxyHandler != nil && r.Method == http.MethodConnect
+		if len(allowedMethods) > 0 && !isProxyConnect {
+			if _, ok := allowedMethods[r.Method]; !ok {
+				logging.Infof("Method %s not allowed for %s", r.Method, r.URL.Path)
+				w.Header().Set("Allow", allowHeader)
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+				return
 			}
+		}
+
+		// 1. Handle CONNECT directly if this listener serves the proxy
+		if isProxyConnect {
+			specificProxyHandler.HandleConnect(w, r)
 			return // CONNECT handled
 		}
 
-		// 2. For all other methods, delegate to the requestMux
+		// CONNECT without the proxy would otherwise reach the mux and get a confusing 404
+		if r.Method == http.MethodConnect {
+			logging.Infof("Rejecting CONNECT %s: forward proxy is not served on listener %s", r.RequestURI, addr)
+			rejectConnect(w, cfg.HTTP.ConnectRejectStatus, allowHeader)
+			return
+		}
+
+		// 2. Absolute-form requests are proxy traffic. They skip the mux, which would
+		// otherwise answer paths like "//a/./b" with a redirect instead of forwarding them
+		if specificProxyHandler != nil && r.URL.IsAbs() {
+			specificProxyHandler.HandleHTTP(w, r)
+			return
+		}
+
+		// 3. Configured routes win over the default order
+		if target, ok := routes.match(r.URL.Path); ok {
+			logging.Debugf("Route match: %s -> %s", r.URL.Path, target)
+			routeHandlers[target].ServeHTTP(w, r)
+			return
+		}
+
+		// 4. For all other requests, delegate to the requestMux
 		requestMux.ServeHTTP(w, r)
 	})
+
+	// Maintenance mode short-circuits everything except exempt paths
+	if cfg.HTTP.Maintenance.Enabled {
+		maintenanceCfg := cfg.HTTP.Maintenance
+		if serveAdmin {
+			// Admin endpoints must keep working to manage the service during maintenance
+			maintenanceCfg.ExemptPaths = append([]string{AdminBaseUrlPath}, maintenanceCfg.ExemptPaths...)
+		}
+		if cfg.HTTP.Health.Enabled {
+			// Probes must not take the instance out of rotation during maintenance
+			maintenanceCfg.ExemptPaths = append([]string{HealthzPath, ReadyzPath}, maintenanceCfg.ExemptPaths...)
+		}
+		if serveMetrics {
+			// Monitoring keeps scraping through maintenance
+			maintenanceCfg.ExemptPaths = append([]string{cfg.HTTP.Metrics.Path}, maintenanceCfg.ExemptPaths...)
+		}
+		rootHandler = maintenanceMiddleware(rootHandler, maintenanceCfg)
+	}
+
+	// Outermost, so requests answered by maintenance are audited too
+	if cfg.HTTP.LogTLS {
+		rootHandler = tlsLogMiddleware(rootHandler)
+	}
+
+	return rootHandler
+}
+
+// rejectConnect answers a CONNECT the server can't serve with 501 Not
+// Implemented or 405 Method Not Allowed (with an Allow header, as required).
+func rejectConnect(w http.ResponseWriter, status int, allowHeader string) {
+	if status == http.StatusNotImplemented {
+		http.Error(w, "Not Implemented: CONNECT is not supported (forward proxy disabled)", http.StatusNotImplemented)
+		return
+	}
+	if allowHeader == "" {
+		allowHeader = "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS"
+	}
+	w.Header().Set("Allow", allowHeader)
+	http.Error(w, "Method Not Allowed: CONNECT requires the forward proxy", http.StatusMethodNotAllowed)
 }
 
 // Start runs the HTTP server. It takes a context for graceful shutdown.
@@ -97,50 +309,169 @@ func (s *Server) Start(ctx context.Context) error {
 	cfg := s.initialConfig
 
 	if !cfg.HTTP.Enabled {
-		return fmt.Errorf("HTTP server is disabled")
+		err := fmt.Errorf("HTTP server is disabled")
+		s.startErr <- err
+		return err
 	}
 
-	rootHandler := s.createRootHandler(cfg)
+	// Parse errors were rejected by validation, the zero value just disables a timeout
+	readHeaderTimeout, _ := cfg.HTTP.Timeouts.GetReadHeader()
+	readTimeout, _ := cfg.HTTP.Timeouts.GetRead()
+	writeTimeout, _ := cfg.HTTP.Timeouts.GetWrite()
+	idleTimeout, _ := cfg.HTTP.Timeouts.GetIdle()
 
-	addr := fmt.Sprintf("%s:%d", cfg.HTTP.Addr, cfg.HTTP.Port)
-	s.server = &http.Server{
-		Addr:         addr,
-		Handler:      rootHandler,
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 60 * time.Second,
-		IdleTimeout:  120 * time.Second,
+	s.listeners = nil
+	for _, lc := range cfg.HTTP.GetListeners() {
+		s.listeners = append(s.listeners, &listener{cfg: lc})
 	}
+	s.storeHandlers(cfg)
 
-	go func() {
-		log.Printf("HTTP server listening on %s", addr)
-		if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Printf("ERROR: ListenAndServe failed: %v", err)
+	// Bind every listener up front so readiness can be confirmed before serving.
+	// A listener that fails to bind is logged and skipped; the others still serve.
+	var bound []net.Listener
+	var running []*listener
+	var bindErrs []error
+	for _, l := range s.listeners {
+		addr := l.cfg.Address()
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			err = fmt.Errorf("failed to listen on %s: %w", addr, err)
+			logging.Errorf("%v", err)
+			bindErrs = append(bindErrs, err)
+			continue
+		}
+		if cfg.HTTP.ProxyProtocol {
+			ln = proxyprotocol.NewListener(ln)
+		}
+		if !l.cfg.TLS {
+			ln = hostheader.NewListener(ln) // Raw Host headers for the proxy's host-mismatch check
 		}
-	}()
 
-	<-ctx.Done()
-	log.Println("Shutdown signal received by HTTP server...")
-	return s.Stop()
+		l.server = &http.Server{
+			Addr: addr,
+			// Indirect through rootHandler so Reload can swap handlers on a live listener
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				s.inFlight.Add(1)
+				defer s.inFlight.Add(-1)
+				l.rootHandler.Load().(http.Handler).ServeHTTP(w, r)
+			}),
+			ConnContext:       hostheader.ConnContext,
+			ReadHeaderTimeout: readHeaderTimeout, // Drops slow-loris clients trickling headers
+			ReadTimeout:       readTimeout,
+			WriteTimeout:      writeTimeout,
+			IdleTimeout:       idleTimeout,
+		}
+		bound = append(bound, ln)
+		running = append(running, l)
+	}
+	if len(running) == 0 {
+		err := fmt.Errorf("%w: %w", ErrNoListeners, errors.Join(bindErrs...))
+		s.startErr <- err
+		return err
+	}
+	if cfg.HTTP.ProxyProtocol {
+		logging.Infof("PROXY protocol is enabled, client addresses are taken from PROXY headers.")
+	}
+	s.listeners = running
+	close(s.ready) // Listeners are bound, connections will be accepted
+
+	for i, l := range s.listeners {
+		go func(server *http.Server, ln net.Listener, lc config.ListenerConfig) {
+			scheme := "HTTP"
+			if lc.TLS {
+				scheme = "HTTPS"
+			}
+			if len(lc.Serves) == 0 {
+				logging.Infof("%s server listening on %s", scheme, server.Addr)
+			} else {
+				logging.Infof("%s server listening on %s (serves: %s)", scheme, server.Addr, strings.Join(lc.Serves, ", "))
+			}
+			var err error
+			if lc.TLS {
+				err = server.ServeTLS(ln, cfg.HTTP.TLS.CertFile, cfg.HTTP.TLS.KeyFile)
+			} else {
+				err = server.Serve(ln)
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logging.Errorf("Serve failed on %s: %v", server.Addr, err)
+			}
+		}(l.server, bound[i], l.cfg)
+	}
+
+	select {
+	case <-ctx.Done():
+		logging.Infof("Shutdown signal received by HTTP server...")
+		return s.Stop()
+	case <-s.stopped: // Stopped directly, Start's caller is waiting for it to return
+		return nil
+	}
 }
 
-// Stop gracefully stops the HTTP server.
+// ListenerCount returns how many listeners are bound and serving.
+func (s *Server) ListenerCount() int {
+	return len(s.listeners)
+}
+
+// Stop gracefully stops every listener of the HTTP server. Requests still in
+// flight when http.shutdown-timeout expires are cut off, and a summary of what
+// was drained and what was forcibly closed is logged. Established CONNECT
+// tunnels are hijacked connections Shutdown doesn't know about: they aren't
+// waited for, and are closed once the listeners are down.
 func (s *Server) Stop() error {
-	if s.server == nil {
-		log.Println("Server Stop() called but server was not running or already stopped.")
+	defer s.stopOnce.Do(func() { close(s.stopped) })
+	if len(s.listeners) == 0 {
+		logging.Infof("Server Stop() called but server was not running or already stopped.")
 		return nil
 	}
 
-	serverAddr := s.server.Addr // Capture address before server becomes nil
-	log.Printf("Attempting to stop server on %s gracefully...", serverAddr)
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	timeout := time.Duration(s.shutdownTimeout.Load())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	err := s.server.Shutdown(shutdownCtx)
-	s.server = nil
-	if err != nil {
-		return fmt.Errorf("server shutdown failed for %s: %w", serverAddr, err)
+	start := time.Now()
+	requests := s.inFlight.Load()
+	ph := s.proxyHandler.Load()
+	var tunnels int64
+	if ph != nil {
+		tunnels = ph.ActiveTunnels()
+	}
+	logging.Infof("Draining %d in-flight request(s) and %d CONNECT tunnel(s) (timeout %v)...", requests, tunnels, timeout)
+
+	var errs []error
+	var undrained []*http.Server // Listeners still serving requests when time ran out
+	for _, l := range s.listeners {
+		if l.server == nil {
+			continue
+		}
+		serverAddr := l.server.Addr
+		logging.Infof("Attempting to stop server on %s gracefully...", serverAddr)
+		if err := l.server.Shutdown(shutdownCtx); err != nil {
+			errs = append(errs, fmt.Errorf("server shutdown failed for %s: %w", serverAddr, err))
+			undrained = append(undrained, l.server)
+			continue
+		}
+		logging.Infof("Server on %s stopped gracefully.", serverAddr)
+	}
+	var forced int64
+	if len(undrained) > 0 {
+		forced = s.inFlight.Load()
+		for _, server := range undrained {
+			server.Close() // Cuts off the requests that didn't finish in time
+		}
 	}
 
-	log.Printf("Server on %s stopped gracefully.", serverAddr)
-	return nil
+	// Hijacked tunnels are invisible to Shutdown and would otherwise stay open
+	// (with their goroutines) until their endpoints close them
+	var closedTunnels int
+	if ph != nil {
+		closedTunnels = ph.CloseAllTunnels()
+	}
+	logging.Infof("Drain summary: %d request(s) and %d tunnel(s) in flight, drained in %v; %d request(s) forcibly closed, %d tunnel(s) closed.",
+		requests, tunnels, time.Since(start).Round(time.Millisecond), forced, closedTunnels)
+
+	if ph := s.proxyHandler.Swap(nil); ph != nil {
+		ph.Close()
+	}
+	s.listeners = nil
+	return errors.Join(errs...)
 }
@@ -0,0 +1,91 @@
+package httpserver
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/config"
+)
+
+// freePort returns a local TCP port nothing is listening on.
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestStopClosesTunnels(t *testing.T) {
+	// Target that accepts the tunnel and then stays silent
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(io.Discard, conn) // Until the proxy closes its end
+				conn.Close()
+			}()
+		}
+	}()
+
+	cfg := &config.Config{HTTP: config.HTTPConfig{
+		Enabled:         true,
+		Addr:            "127.0.0.1",
+		Port:            freePort(t),
+		ShutdownTimeout: "2s",
+		ForwardProxy:    config.ProxyConfig{Enabled: true},
+	}}
+	server := NewServer(cfg)
+	started := make(chan error, 1)
+	go func() { started <- server.Start(context.Background()) }()
+	if err := server.WaitReady(5 * time.Second); err != nil {
+		t.Fatalf("server didn't start: %v", err)
+	}
+
+	client, err := net.Dial("tcp", cfg.HTTP.GetListeners()[0].Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	targetAddr := target.Addr().String()
+	io.WriteString(client, "CONNECT "+targetAddr+" HTTP/1.1\r\nHost: "+targetAddr+"\r\n\r\n")
+	reader := bufio.NewReader(client)
+	resp, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("CONNECT: status %v, err %v", resp, err)
+	}
+	if n := server.proxyHandler.Load().ActiveTunnels(); n != 1 {
+		t.Fatalf("%d active tunnels after CONNECT, want 1", n)
+	}
+
+	if err := server.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := reader.ReadByte(); err != io.EOF {
+		t.Errorf("reading the tunnel after Stop: err %v, want EOF", err)
+	}
+	select {
+	case err := <-started:
+		if err != nil {
+			t.Errorf("Start returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Start didn't return after Stop")
+	}
+}
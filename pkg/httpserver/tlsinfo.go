@@ -0,0 +1,33 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+)
+
+// tlsInfo describes the TLS session a request arrived on, for auditing.
+// Returns "" for plain HTTP requests.
+func tlsInfo(r *http.Request) string {
+	if r.TLS == nil {
+		return ""
+	}
+	sni := r.TLS.ServerName
+	if sni == "" {
+		sni = "-" // Client sent no SNI
+	}
+	return fmt.Sprintf("tls_version=%s cipher=%s sni=%s", tls.VersionName(r.TLS.Version), tls.CipherSuiteName(r.TLS.CipherSuite), sni)
+}
+
+// tlsLogMiddleware logs the negotiated TLS version, cipher suite and SNI of
+// every request that arrived over TLS. Plain HTTP requests aren't logged.
+func tlsLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info := tlsInfo(r); info != "" {
+			logging.Infof("TLS %s %s from %s: %s", r.Method, r.RequestURI, r.RemoteAddr, info)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,79 @@
+// Package logging is a small leveled front end to the standard log package,
+// gated by the log.level setting. Output format and destination stay those
+// of the standard logger; each level only adds its message prefix.
+package logging
+
+import (
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// Supported log.level values.
+const (
+	LevelDebug = "debug" // Per-request diagnostics (tunnels, fetches, cache writes...)
+	LevelInfo  = "info"  // Default: lifecycle messages, warnings and errors
+	LevelWarn  = "warn"  // Warnings and errors only
+	LevelError = "error" // Errors only
+)
+
+// Level is a log severity, ordered from most to least verbose.
+type Level int32
+
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+var minLevel atomic.Int32 // Info, the zero value of Level is Debug
+
+func init() {
+	minLevel.Store(int32(Info))
+}
+
+// ParseLevel maps a log.level value to its Level, case-insensitively.
+func ParseLevel(level string) (Level, bool) {
+	switch strings.ToLower(level) {
+	case LevelDebug:
+		return Debug, true
+	case LevelInfo:
+		return Info, true
+	case LevelWarn:
+		return Warn, true
+	case LevelError:
+		return Error, true
+	}
+	return Info, false
+}
+
+// SetLevel applies a log.level value. Unknown values fall back to info.
+func SetLevel(level string) {
+	l, _ := ParseLevel(level)
+	minLevel.Store(int32(l))
+}
+
+// Enabled reports whether messages at l are currently logged, for callers
+// that want to skip building an expensive message.
+func Enabled(l Level) bool {
+	return int32(l) >= minLevel.Load()
+}
+
+func logf(l Level, prefix, format string, args ...any) {
+	if Enabled(l) {
+		log.Printf(prefix+format, args...)
+	}
+}
+
+// Debugf logs with a "DBG: " prefix when the level is debug.
+func Debugf(format string, args ...any) { logf(Debug, "DBG: ", format, args...) }
+
+// Infof logs without a prefix unless the level is warn or error.
+func Infof(format string, args ...any) { logf(Info, "", format, args...) }
+
+// Warnf logs with a "WARN: " prefix unless the level is error.
+func Warnf(format string, args ...any) { logf(Warn, "WARN: ", format, args...) }
+
+// Errorf always logs, with an "ERROR: " prefix.
+func Errorf(format string, args ...any) { logf(Error, "ERROR: ", format, args...) }
@@ -0,0 +1,190 @@
+// Package metrics keeps the process-wide counters exposed on the /metrics
+// endpoint and renders them in the Prometheus text exposition format.
+// It's deliberately tiny (counters, one histogram type, gauges written at
+// scrape time) to avoid pulling in the Prometheus client library.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Process-wide metrics. They live at package level so they keep counting
+// across handler rebuilds on config reload.
+var (
+	ProxyRequests = newCounterVec("adminbot_proxy_requests_total",
+		"Proxied requests by method and response status code.", "method", "code")
+	CacheRequests = newCounterVec("adminbot_cache_requests_total",
+		"Proxied requests by cache status (HIT, MISS, BYPASS).", "status")
+	CacheEvictions = newCounterVec("adminbot_cache_evictions_total",
+		"Cache entries removed by the proxy, by reason.", "reason")
+	UpstreamFetchDuration = newHistogram("adminbot_upstream_fetch_duration_seconds",
+		"Time until an origin's response headers arrived.",
+		[]float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30})
+	CleanupRuns = newCounterVec("adminbot_cache_cleanup_runs_total",
+		"Cache cleaner passes by result (ok, error).", "result")
+	CleanupDeletedFiles = newCounterVec("adminbot_cache_cleanup_deleted_files_total",
+		"Files deleted by the cache cleaner, by reason (expired, max-size).", "reason")
+	CleanupFreedBytes = newCounterVec("adminbot_cache_cleanup_freed_bytes_total",
+		"Disk space freed by the cache cleaner.")
+	CleanupDuration = newHistogram("adminbot_cache_cleanup_duration_seconds",
+		"Time a cache cleaner pass over all cache dirs took.",
+		[]float64{0.01, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 900})
+)
+
+// registry lists the package metrics in the order they're written.
+var registry = []interface{ write(w io.Writer) }{
+	ProxyRequests,
+	CacheRequests,
+	CacheEvictions,
+	UpstreamFetchDuration,
+	CleanupRuns,
+	CleanupDeletedFiles,
+	CleanupFreedBytes,
+	CleanupDuration,
+}
+
+// WriteAll writes every package metric in Prometheus text format.
+func WriteAll(w io.Writer) {
+	for _, m := range registry {
+		m.write(w)
+	}
+}
+
+// WriteGauge writes a single unlabeled gauge sampled at scrape time.
+func WriteGauge(w io.Writer, name, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", name, help, name, name, formatFloat(value))
+}
+
+// WriteCounter writes a single unlabeled counter whose value is kept elsewhere.
+func WriteCounter(w io.Writer, name, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %s\n", name, help, name, name, formatFloat(value))
+}
+
+// CounterVec is a counter partitioned by a fixed set of labels.
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64 // Rendered label set -> value
+}
+
+func newCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+// Inc adds one to the counter for the given label values (in label order).
+func (c *CounterVec) Inc(labelValues ...string) {
+	key := renderLabels(c.labels, labelValues)
+	c.mu.Lock()
+	c.values[key]++
+	c.mu.Unlock()
+}
+
+// Add adds v (which must not be negative) to the counter for the given label values.
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	key := renderLabels(c.labels, labelValues)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys) // Stable output between scrapes
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, k, formatFloat(c.values[k]))
+	}
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	name    string
+	help    string
+	buckets []float64 // Upper bounds, ascending
+
+	mu     sync.Mutex
+	counts []uint64 // Per bucket, non-cumulative; the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(name, help string, buckets []float64) *Histogram {
+	return &Histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets)+1)}
+}
+
+// ObserveDuration records d in seconds.
+func (h *Histogram) ObserveDuration(d time.Duration) {
+	v := d.Seconds()
+	i := sort.SearchFloat64s(h.buckets, v) // First bucket with bound >= v
+	h.mu.Lock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+	h.mu.Unlock()
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	var cumulative uint64
+	for i, bound := range h.buckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name, formatFloat(bound), cumulative)
+	}
+	cumulative += h.counts[len(h.buckets)]
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, cumulative)
+	fmt.Fprintf(w, "%s_sum %s\n%s_count %d\n", h.name, formatFloat(h.sum), h.name, h.count)
+}
+
+// renderLabels formats a label set as {a="x",b="y"}.
+func renderLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
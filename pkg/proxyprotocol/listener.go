@@ -0,0 +1,183 @@
+// Package proxyprotocol implements a net.Listener that understands the
+// HAProxy PROXY protocol (v1 text and v2 binary), so connections accepted
+// behind an L4 load balancer report the original client address.
+package proxyprotocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+)
+
+// headerTimeout bounds how long a new connection may take to send its PROXY header.
+const headerTimeout = 10 * time.Second
+
+// v1MaxLength is the longest legal v1 header, including the trailing CRLF.
+const v1MaxLength = 107
+
+// v2Signature prefixes every PROXY protocol v2 header.
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// Listener wraps a net.Listener and parses a PROXY header on every connection.
+type Listener struct {
+	net.Listener
+}
+
+// NewListener wraps inner so accepted connections have their PROXY header
+// consumed and RemoteAddr reports the client address it carries.
+func NewListener(inner net.Listener) *Listener {
+	return &Listener{Listener: inner}
+}
+
+// Accept waits for the next connection. The PROXY header is parsed lazily on
+// first use so a slow client can't block the accept loop.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// Conn is a connection whose PROXY header has been (or will be) consumed.
+type Conn struct {
+	net.Conn
+	reader     *bufio.Reader
+	once       sync.Once
+	remoteAddr net.Addr
+	headerErr  error
+}
+
+// Read reads application data following the PROXY header.
+func (c *Conn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.headerErr != nil {
+		return 0, c.headerErr
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the client address from the PROXY header, falling back
+// to the socket's peer address for LOCAL/UNKNOWN headers.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readHeader consumes the PROXY header, recording any error for Read to return.
+func (c *Conn) readHeader() {
+	c.Conn.SetReadDeadline(time.Now().Add(headerTimeout))
+	defer c.Conn.SetReadDeadline(time.Time{})
+
+	addr, err := parseHeader(c.reader)
+	if err != nil {
+		logging.Warnf("Invalid PROXY protocol header from %s: %v", c.Conn.RemoteAddr(), err)
+		c.headerErr = err
+		c.Conn.Close() // Nothing sensible can be served on this connection
+		return
+	}
+	c.remoteAddr = addr
+}
+
+// parseHeader detects the protocol version and parses the header.
+// A nil address means the header carried no client address (LOCAL/UNKNOWN).
+func parseHeader(r *bufio.Reader) (net.Addr, error) {
+	prefix, err := r.Peek(len(v2Signature))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if bytes.Equal(prefix, v2Signature) {
+		return parseV2(r)
+	}
+	if bytes.HasPrefix(prefix, []byte("PROXY ")) {
+		return parseV1(r)
+	}
+	return nil, errors.New("connection did not start with a PROXY protocol header")
+}
+
+// parseV1 parses a text header such as "PROXY TCP4 1.2.3.4 5.6.7.8 1234 80\r\n".
+func parseV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < v1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read v1 header: %w", err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("v1 header is too long or not CRLF terminated")
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed v1 header %q", string(line))
+	}
+	ip := net.ParseIP(fields[2])
+	if ip == nil {
+		return nil, fmt.Errorf("invalid v1 source address %q", fields[2])
+	}
+	port, err := strconv.Atoi(fields[4])
+	if err != nil || port < 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid v1 source port %q", fields[4])
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// parseV2 parses a binary header: signature, version/command, family, length, addresses.
+func parseV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read v2 header: %w", err)
+	}
+	if header[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported v2 version %d", header[12]>>4)
+	}
+	command := header[12] & 0x0F
+	family := header[13]
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("failed to read v2 addresses: %w", err)
+	}
+
+	if command == 0x0 {
+		return nil, nil // LOCAL: health check from the balancer itself
+	}
+	if command != 0x1 {
+		return nil, fmt.Errorf("unsupported v2 command %d", command)
+	}
+
+	switch family {
+	case 0x11, 0x12: // TCP/UDP over IPv4
+		if len(payload) < 12 {
+			return nil, errors.New("v2 IPv4 address block is too short")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 0x21, 0x22: // TCP/UDP over IPv6
+		if len(payload) < 36 {
+			return nil, errors.New("v2 IPv6 address block is too short")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	default:
+		return nil, nil // UNSPEC or unix sockets: keep the socket address
+	}
+}
@@ -0,0 +1,66 @@
+// Package reloadhook tells an optional reload-webhook URL about config reloads.
+package reloadhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+)
+
+// sendTimeout bounds a single webhook POST, a slow receiver must not pile up goroutines.
+const sendTimeout = 10 * time.Second
+
+// Event is the JSON payload POSTed for every reload.
+type Event struct {
+	Timestamp time.Time `json:"timestamp"`
+	Success   bool      `json:"success"`
+	Restarted []string  `json:"restarted"`       // Services restarted by the reload, e.g. "http-server"
+	Error     string    `json:"error,omitempty"` // Why the reload was rejected
+}
+
+// Notify POSTs ev to url in the background. An empty url does nothing; delivery
+// failures are only logged, a reload never waits on or fails because of the hook.
+func Notify(url string, ev Event) {
+	if url == "" {
+		return
+	}
+	if ev.Timestamp.IsZero() {
+		ev.Timestamp = time.Now().UTC()
+	}
+	if ev.Restarted == nil {
+		ev.Restarted = []string{} // [] rather than null for receivers
+	}
+	go func() {
+		if err := send(url, ev); err != nil {
+			logging.Warnf("Reload webhook %s failed: %v", url, err)
+		}
+	}()
+}
+
+func send(url string, ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package staticfiles
+
+import (
+	"net/http"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/basicauth"
+	"github.com/mohammedhabas11/admin-bot/pkg/config"
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+)
+
+// basicAuthHandler lets only requests with valid Authorization: Basic
+// credentials through to next and answers the rest with 401 and a challenge
+// for the configured realm (urlPrefix when unset).
+func basicAuthHandler(cfg config.StaticAuthConfig, urlPrefix string, next http.Handler) http.Handler {
+	checker := basicauth.New(cfg.Users, "static "+urlPrefix)
+	realm := cfg.Realm
+	if realm == "" {
+		realm = urlPrefix
+	}
+	logging.Infof("  Route '%s' requires basic auth for %d users (realm %q)", urlPrefix, checker.Users(), realm)
+	challenge := `Basic realm="` + realm + `", charset="UTF-8"`
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if checker.Check(r.Header.Get("Authorization")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		logging.Infof("Static authentication required for %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", challenge)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
@@ -0,0 +1,39 @@
+package staticfiles
+
+import (
+	"io/fs"
+	"sync"
+)
+
+// bundles are the embedded file systems static dirs with source "embedded"
+// can serve, by name.
+var (
+	bundlesMu sync.RWMutex
+	bundles   = map[string]fs.FS{}
+)
+
+// RegisterBundle makes fsys (typically an embed.FS, narrowed with fs.Sub to
+// the directory holding the assets) available to static dirs configured
+// with source: embedded and bundle: name. Call it from an init function so
+// the bundle exists before the routes are built; registering a name again
+// replaces it.
+//
+//	//go:embed web/dist
+//	var dist embed.FS
+//
+//	func init() {
+//		sub, _ := fs.Sub(dist, "web/dist")
+//		staticfiles.RegisterBundle("app", sub)
+//	}
+func RegisterBundle(name string, fsys fs.FS) {
+	bundlesMu.Lock()
+	defer bundlesMu.Unlock()
+	bundles[name] = fsys
+}
+
+func lookupBundle(name string) (fs.FS, bool) {
+	bundlesMu.RLock()
+	defer bundlesMu.RUnlock()
+	fsys, ok := bundles[name]
+	return fsys, ok
+}
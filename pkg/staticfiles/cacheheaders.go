@@ -0,0 +1,33 @@
+package staticfiles
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+)
+
+// cacheHeadersHandler adds cacheControl (if set) to GET/HEAD responses for
+// paths under urlPrefix that exist in fsys and, with etag, a strong ETag for
+// regular files. The ETag is set before next (the FileServer) runs, so
+// http.ServeContent answers a matching If-None-Match with 304.
+func cacheHeadersHandler(fsys fs.FS, urlPrefix, cacheControl string, etag bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if name, ok := fsName(urlPrefix, r); ok {
+			if info, err := fs.Stat(fsys, name); err == nil {
+				if cacheControl != "" {
+					w.Header().Set("Cache-Control", cacheControl)
+				}
+				if etag && info.Mode().IsRegular() && !info.ModTime().IsZero() {
+					w.Header().Set("ETag", fileETag(info)) // Embedded files have no mtime to go by
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// fileETag derives a strong ETag from a file's size and modification time,
+// which change whenever the file is replaced or rewritten.
+func fileETag(info fs.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano())
+}
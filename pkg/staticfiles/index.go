@@ -0,0 +1,59 @@
+package staticfiles
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// indexHandler serves index (instead of FileServer's fixed index.html) for
+// directory URLs under urlPrefix and, with spaFallback, the root's index for
+// paths that don't exist, so client-side-routed apps can handle them. Missing
+// paths with a file extension ("/app.js") are assets, not routes, and keep
+// their 404. Everything else is left to next, the prefix-stripped FileServer
+// for fsys.
+func indexHandler(fsys fs.FS, urlPrefix, index string, spaFallback bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := fsName(urlPrefix, r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		info, err := fs.Stat(fsys, name)
+		switch {
+		case err == nil && info.IsDir() && strings.HasSuffix(r.URL.Path, "/"):
+			if serveIndexFile(w, r, fsys, path.Join(name, index)) {
+				return
+			}
+		case errors.Is(err, fs.ErrNotExist) && spaFallback && path.Ext(name) == "":
+			if serveIndexFile(w, r, fsys, index) {
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serveIndexFile writes the regular file name of fsys with http.ServeContent
+// and reports whether it did. Unlike http.ServeFile it never redirects
+// requests for ".../index.html".
+func serveIndexFile(w http.ResponseWriter, r *http.Request, fsys fs.FS, name string) bool {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		return false
+	}
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		return false // Every disk and embedded file can seek
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), content)
+	return true
+}
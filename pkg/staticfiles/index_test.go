@@ -0,0 +1,57 @@
+package staticfiles
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/config"
+)
+
+func TestSPAFallback(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"index.html":    "<html>app</html>",
+		"assets/app.js": "console.log('app')",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mux := http.NewServeMux()
+	RegisterStaticRoutes(mux, config.StaticConfig{
+		Enabled: true,
+		Dirs:    map[string]config.StaticDirConfig{"app": {Path: dir, SPAFallback: true}},
+	}, nil)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"/static/app/", http.StatusOK, "<html>app</html>"},
+		{"/static/app/users/42/settings", http.StatusOK, "<html>app</html>"},
+		{"/static/app/assets/app.js", http.StatusOK, "console.log('app')"},
+		{"/static/app/assets/missing.js", http.StatusNotFound, ""},
+		{"/static/app/favicon.ico", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.wantStatus {
+			t.Errorf("GET %s: status %d, want %d", tt.path, rec.Code, tt.wantStatus)
+			continue
+		}
+		if tt.wantBody != "" && strings.TrimSpace(rec.Body.String()) != tt.wantBody {
+			t.Errorf("GET %s: body %q, want %q", tt.path, rec.Body.String(), tt.wantBody)
+		}
+	}
+}
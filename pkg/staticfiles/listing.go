@@ -0,0 +1,155 @@
+package staticfiles
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
+)
+
+// ListingEntry is one file or subdirectory shown in a directory listing.
+type ListingEntry struct {
+	Name    string    // Base name, with a trailing "/" for directories
+	URL     string    // Escaped link relative to the listed directory
+	Size    int64     // Bytes, 0 for directories
+	ModTime time.Time // Last modification time
+	IsDir   bool
+}
+
+// ListingData is the value a listing template is executed with.
+type ListingData struct {
+	Path    string // Request path of the listed directory (e.g. "/static/files/docs/")
+	Entries []ListingEntry
+}
+
+// loadListingTemplate parses a directory listing template. Besides the
+// html/template builtins it can use "humanSize" for byte counts.
+func loadListingTemplate(file string) (*template.Template, error) {
+	return template.New(filepath.Base(file)).Funcs(template.FuncMap{
+		"humanSize": humanSize,
+	}).ParseFiles(file)
+}
+
+// listingHandler renders directory listings under urlPrefix with tmpl and
+// leaves everything else (files, the index, redirects, errors) to next, the
+// prefix-stripped FileServer for fsys.
+func listingHandler(fsys fs.FS, urlPrefix, index string, tmpl *template.Template, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dir, ok := indexlessDir(fsys, urlPrefix, index, r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		dirEntries, err := fs.ReadDir(fsys, dir)
+		if err != nil {
+			logging.Warnf("Failed to read directory %s for listing: %v", dir, err)
+			http.Error(w, "Error reading directory", http.StatusInternalServerError)
+			return
+		}
+		data := ListingData{Path: r.URL.Path}
+		for _, de := range dirEntries {
+			info, err := de.Info()
+			if err != nil {
+				continue // Vanished or unreadable, skip it like FileServer does
+			}
+			entry := ListingEntry{Name: de.Name(), ModTime: info.ModTime(), IsDir: de.IsDir()}
+			if entry.IsDir {
+				entry.Name += "/"
+			} else {
+				entry.Size = info.Size()
+			}
+			entry.URL = (&url.URL{Path: entry.Name}).String()
+			data.Entries = append(data.Entries, entry)
+		}
+		sort.Slice(data.Entries, func(i, j int) bool { return data.Entries[i].Name < data.Entries[j].Name })
+
+		// Render first so a template error doesn't leave a half-written page
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			logging.Errorf("Directory listing template failed for %s: %v", r.URL.Path, err)
+			http.Error(w, "Error rendering directory listing", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if r.Method == http.MethodHead {
+			return
+		}
+		w.Write(buf.Bytes())
+	})
+}
+
+// indexlessDir returns the directory in fsys a GET/HEAD request for a
+// directory URL maps to, if that directory has no index file (i.e. it would
+// be answered with a listing). ok is false for every other request.
+func indexlessDir(fsys fs.FS, urlPrefix, index string, r *http.Request) (dir string, ok bool) {
+	dir, ok = fsName(urlPrefix, r)
+	if !ok || !strings.HasSuffix(r.URL.Path, "/") {
+		return "", false
+	}
+	if info, err := fs.Stat(fsys, dir); err != nil || !info.IsDir() {
+		return "", false
+	}
+	if _, err := fs.Stat(fsys, path.Join(dir, index)); err == nil {
+		return "", false // The index is served instead of a listing
+	}
+	return dir, true
+}
+
+// fsName maps a GET/HEAD request under urlPrefix to the name it refers to in
+// the directory's fs.FS ("." for the root). ok is false for other requests.
+func fsName(urlPrefix string, r *http.Request) (name string, ok bool) {
+	rel, ok := strings.CutPrefix(r.URL.Path, urlPrefix)
+	if !ok || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return "", false
+	}
+	name = strings.TrimPrefix(path.Clean("/"+rel), "/")
+	if name == "" {
+		name = "."
+	}
+	return name, true
+}
+
+// noListingHandler answers directory requests without an index file with
+// status (403 or 404) and the optional page body, instead of a listing.
+// Everything else is left to next.
+func noListingHandler(fsys fs.FS, urlPrefix, index string, status int, page []byte, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := indexlessDir(fsys, urlPrefix, index, r); !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if page == nil {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		w.Header().Set("Content-Type", http.DetectContentType(page))
+		w.WriteHeader(status)
+		if r.Method != http.MethodHead {
+			w.Write(page)
+		}
+	})
+}
+
+// humanSize formats a byte count for listings (e.g. "1.5 MB").
+func humanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -2,13 +2,19 @@
 package staticfiles
 
 import (
-	"log"
+	"bufio"
+	"fmt"
+	"io/fs"
+	"net"
 	"net/http"
+	"os"
 	"path"
 	"strings"
 	"time"
 
+	"github.com/mohammedhabas11/admin-bot/pkg/compression"
 	"github.com/mohammedhabas11/admin-bot/pkg/config"
+	"github.com/mohammedhabas11/admin-bot/pkg/logging"
 )
 
 // StaticBaseUrlPath is the root path under which all static directories are served.
@@ -18,46 +24,141 @@ const StaticBaseUrlPath = "/static/"
 func loggingMiddleware(h http.Handler, routePrefix string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		log.Printf("STATIC REQ: [%s] %s %s (Route: %s)", r.Method, r.URL.Path, r.RemoteAddr, routePrefix)
-		// Consider using a ResponseWriter wrapper to capture status code later
-		h.ServeHTTP(w, r) // Call the original handler (StripPrefix -> FileServer)
-		log.Printf("STATIC RSP: [%s] %s completed in %v", r.Method, r.URL.Path, time.Since(start))
+		logging.Infof("STATIC REQ: [%s] %s %s (Route: %s)", r.Method, r.URL.Path, r.RemoteAddr, routePrefix)
+		rec := &statusRecorder{ResponseWriter: w}
+		h.ServeHTTP(rec, r) // Call the original handler (StripPrefix -> FileServer)
+		if rec.status == 0 {
+			rec.status = http.StatusOK // Nothing written, net/http sends an empty 200
+		}
+		logging.Infof("STATIC RSP: [%s] %s %d %d bytes completed in %v", r.Method, r.URL.Path, rec.status, rec.bytes, time.Since(start))
 	})
 }
 
+// statusRecorder remembers the status code and body bytes written through it.
+// Flush and Hijack reach the underlying writer, so wrapping it changes nothing
+// for the handlers below.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int   // First status written, 0 until then
+	bytes  int64 // Body bytes written (compressed size when gzipped)
+}
+
+func (sr *statusRecorder) WriteHeader(code int) {
+	if sr.status == 0 {
+		sr.status = code
+	}
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK // Implicit WriteHeader(200)
+	}
+	n, err := sr.ResponseWriter.Write(b)
+	sr.bytes += int64(n)
+	return n, err
+}
+
+func (sr *statusRecorder) Flush() {
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := sr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not support hijacking", sr.ResponseWriter)
+	}
+	return hj.Hijack()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
 // RegisterStaticRoutes sets up handlers for serving static files based on config.
-func RegisterStaticRoutes(mux *http.ServeMux, cfg config.StaticConfig) {
+// Responses are gzipped by compressor, if not nil.
+func RegisterStaticRoutes(mux *http.ServeMux, cfg config.StaticConfig, compressor *compression.Compressor) {
 	if !cfg.Enabled {
 		return
 	}
 
-	log.Println("Registering static file routes...")
+	logging.Infof("Registering static file routes...")
 	if len(cfg.Dirs) == 0 {
-		log.Println("  No static directories configured.")
+		logging.Infof("  No static directories configured.")
 		return
 	}
 
 	for key, dirCfg := range cfg.Dirs {
 		routeKey := strings.Trim(key, "/")
 		if routeKey == "" {
-			log.Printf("  Skipping static route: Invalid key.")
+			logging.Warnf("  Skipping static route: Invalid key.")
 			continue
 		}
-		if dirCfg.Path == "" {
-			log.Printf("  Skipping static route '/static/%s/': Filesystem path is empty.", routeKey)
-			continue
-		}
-
 		urlPathPrefix := path.Join(StaticBaseUrlPath, routeKey) + "/"
 
-		fsHandler := http.FileServer(http.Dir(dirCfg.Path))
-		strippedHandler := http.StripPrefix(urlPathPrefix, fsHandler)
+		// Disk dirs keep http.Dir for FileServer; the other handlers only
+		// look things up, which the fs.FS view of the same dir does as well
+		var fsys fs.FS
+		var fsHandler http.Handler
+		source := dirCfg.Path
+		if dirCfg.Source == config.StaticSourceEmbedded {
+			bundle, ok := lookupBundle(dirCfg.Bundle)
+			if !ok {
+				logging.Warnf("  Skipping static route '%s': No embedded bundle '%s' is compiled in.", urlPathPrefix, dirCfg.Bundle)
+				continue
+			}
+			fsys, fsHandler = bundle, http.FileServer(http.FS(bundle))
+			source = "embedded bundle " + dirCfg.Bundle
+		} else {
+			if dirCfg.Path == "" {
+				logging.Infof("  Skipping static route '/static/%s/': Filesystem path is empty.", routeKey)
+				continue
+			}
+			fsys, fsHandler = os.DirFS(dirCfg.Path), http.FileServer(http.Dir(dirCfg.Path))
+		}
+		var strippedHandler http.Handler = http.StripPrefix(urlPathPrefix, fsHandler)
 
-		// Wrap the stripped handler with logging
+		// Directory listings use the dir's own template, else the global one
+		listingTemplate := dirCfg.ListingTemplate
+		if listingTemplate == "" {
+			listingTemplate = cfg.ListingTemplate
+		}
+		if dirCfg.DisableListing {
+			var page []byte
+			if dirCfg.MissingIndexPage != "" {
+				var err error
+				if page, err = os.ReadFile(dirCfg.MissingIndexPage); err != nil {
+					logging.Warnf("Failed to read missing-index page %s for '%s', using a plain response: %v", dirCfg.MissingIndexPage, urlPathPrefix, err)
+					page = nil
+				}
+			}
+			strippedHandler = noListingHandler(fsys, urlPathPrefix, dirCfg.GetIndex(), dirCfg.GetMissingIndexStatus(), page, strippedHandler)
+		} else if listingTemplate != "" {
+			if tmpl, err := loadListingTemplate(listingTemplate); err != nil {
+				logging.Warnf("Failed to load listing template %s for '%s', using the default listing: %v", listingTemplate, urlPathPrefix, err)
+			} else {
+				strippedHandler = listingHandler(fsys, urlPathPrefix, dirCfg.GetIndex(), tmpl, strippedHandler)
+			}
+		}
+		if dirCfg.Index != "" || dirCfg.SPAFallback {
+			strippedHandler = indexHandler(fsys, urlPathPrefix, dirCfg.GetIndex(), dirCfg.SPAFallback, strippedHandler)
+		}
+		if dirCfg.CacheControl != "" || dirCfg.ETag {
+			strippedHandler = cacheHeadersHandler(fsys, urlPathPrefix, dirCfg.CacheControl, dirCfg.ETag, strippedHandler)
+		}
+
+		// Wrap the stripped handler with compression, auth and logging
+		strippedHandler = compressor.Handler(strippedHandler)
+		if dirCfg.BasicAuth != nil {
+			strippedHandler = basicAuthHandler(*dirCfg.BasicAuth, urlPathPrefix, strippedHandler)
+		}
 		loggedHandler := loggingMiddleware(strippedHandler, urlPathPrefix)
 
 		mux.Handle(urlPathPrefix, loggedHandler) // Register the logged handler
 
-		log.Printf("  Route '%s' -> Serves files from '%s'", urlPathPrefix, dirCfg.Path)
+		logging.Infof("  Route '%s' -> Serves files from '%s'", urlPathPrefix, source)
 	}
 }